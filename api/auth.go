@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+)
+
+// Role determines which RPCs a client may call. Each role can call everything
+// the roles before it can.
+type Role string
+
+const (
+	// RoleReader can list and watch VMs, list images, and query capacity,
+	// pools and the server's info.
+	RoleReader Role = "reader"
+
+	// RoleOperator can additionally create, delete and snapshot VMs, and run
+	// commands inside them.
+	RoleOperator Role = "operator"
+
+	// RoleAdmin can additionally initialize and shutdown the hypervisor, and
+	// import, upload and delete images.
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) level() int {
+	switch r {
+	case RoleReader:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// methodRoles is the minimum role required for each RPC. RPCs not listed
+// require RoleAdmin.
+var methodRoles = map[string]Role{
+	proto.Nesting_List_FullMethodName:           RoleReader,
+	proto.Nesting_Watch_FullMethodName:          RoleReader,
+	proto.Nesting_Capacity_FullMethodName:       RoleReader,
+	proto.Nesting_GetInfo_FullMethodName:        RoleReader,
+	proto.Nesting_Pool_FullMethodName:           RoleReader,
+	proto.Nesting_ListImages_FullMethodName:     RoleReader,
+	proto.Nesting_Create_FullMethodName:         RoleOperator,
+	proto.Nesting_Delete_FullMethodName:         RoleOperator,
+	proto.Nesting_Exec_FullMethodName:           RoleOperator,
+	proto.Nesting_Snapshot_FullMethodName:       RoleOperator,
+	proto.Nesting_DeleteSnapshot_FullMethodName: RoleOperator,
+}
+
+func requiredRole(method string) Role {
+	if role, ok := methodRoles[method]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// Token is a bearer token and the role it grants.
+type Token struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// Tokens are the bearer tokens accepted by the server.
+type Tokens []Token
+
+// LoadTokens reads a tokens file, in the form:
+//
+//	{"tokens": [{"name": "runner", "token": "secret", "role": "operator"}]}
+func LoadTokens(path string) (Tokens, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tokens: %w", err)
+	}
+
+	var file struct {
+		Tokens Tokens `json:"tokens"`
+	}
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("unmarshaling tokens: %w", err)
+	}
+
+	if err := file.Tokens.validate(); err != nil {
+		return nil, err
+	}
+
+	return file.Tokens, nil
+}
+
+func (t Tokens) validate() error {
+	if len(t) == 0 {
+		return fmt.Errorf("no tokens configured")
+	}
+
+	for i, token := range t {
+		if token.Token == "" {
+			return fmt.Errorf("token %d (%s) is empty", i, token.Name)
+		}
+		if token.Role.level() == 0 {
+			return fmt.Errorf("token %d (%s) has unknown role %q", i, token.Name, token.Role)
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the token matching the bearer token. Every token is compared
+// in constant time, so that the time taken doesn't reveal a partial match.
+func (t Tokens) lookup(bearer string) (Token, bool) {
+	var (
+		match Token
+		found bool
+	)
+
+	for _, token := range t {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(bearer)) == 1 {
+			match, found = token, true
+		}
+	}
+
+	return match, found
+}
+
+// authorize checks that the bearer token in the incoming metadata grants a
+// role permitted to call the method.
+func (t Tokens) authorize(ctx context.Context, method string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var bearer string
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			bearer = token
+		}
+	}
+	if bearer == "" {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	token, ok := t.lookup(bearer)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+
+	if token.Role.level() < requiredRole(method).level() {
+		return status.Errorf(codes.PermissionDenied, "role %q cannot call %s", token.Role, method)
+	}
+
+	return nil
+}
+
+func (t Tokens) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := t.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (t Tokens) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := t.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// tokenCredentials attaches a bearer token to every RPC.
+type tokenCredentials string
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(c)}, nil
+}
+
+// RequireTransportSecurity is false, as the unix socket is local and doesn't
+// use TLS.
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
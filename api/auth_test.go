@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestAuthorize(t *testing.T) {
+	tokens := Tokens{
+		{Name: "reader", Token: "reader-token", Role: RoleReader},
+		{Name: "operator", Token: "operator-token", Role: RoleOperator},
+		{Name: "admin", Token: "admin-token", Role: RoleAdmin},
+	}
+
+	testCases := map[string]struct {
+		authorization []string
+		method        string
+		code          codes.Code
+	}{
+		"missing token": {
+			method: proto.Nesting_List_FullMethodName,
+			code:   codes.Unauthenticated,
+		},
+		"not a bearer token": {
+			authorization: []string{"Basic reader-token"},
+			method:        proto.Nesting_List_FullMethodName,
+			code:          codes.Unauthenticated,
+		},
+		"invalid token": {
+			authorization: []string{"Bearer reader"},
+			method:        proto.Nesting_List_FullMethodName,
+			code:          codes.Unauthenticated,
+		},
+		"reader list": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_List_FullMethodName,
+			code:          codes.OK,
+		},
+		"reader watch": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_Watch_FullMethodName,
+			code:          codes.OK,
+		},
+		"reader pool": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_Pool_FullMethodName,
+			code:          codes.OK,
+		},
+		"reader get info": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_GetInfo_FullMethodName,
+			code:          codes.OK,
+		},
+		"reader list images": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_ListImages_FullMethodName,
+			code:          codes.OK,
+		},
+		"operator import image": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_ImportImage_FullMethodName,
+			code:          codes.PermissionDenied,
+		},
+		"operator upload image": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_UploadImage_FullMethodName,
+			code:          codes.PermissionDenied,
+		},
+		"reader create": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_Create_FullMethodName,
+			code:          codes.PermissionDenied,
+		},
+		"operator delete": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_Delete_FullMethodName,
+			code:          codes.OK,
+		},
+		"reader exec": {
+			authorization: []string{"Bearer reader-token"},
+			method:        proto.Nesting_Exec_FullMethodName,
+			code:          codes.PermissionDenied,
+		},
+		"operator exec": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_Exec_FullMethodName,
+			code:          codes.OK,
+		},
+		"operator snapshot": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_Snapshot_FullMethodName,
+			code:          codes.OK,
+		},
+		"operator delete snapshot": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_DeleteSnapshot_FullMethodName,
+			code:          codes.OK,
+		},
+		"operator shutdown": {
+			authorization: []string{"Bearer operator-token"},
+			method:        proto.Nesting_Shutdown_FullMethodName,
+			code:          codes.PermissionDenied,
+		},
+		"admin shutdown": {
+			authorization: []string{"Bearer admin-token"},
+			method:        proto.Nesting_Shutdown_FullMethodName,
+			code:          codes.OK,
+		},
+		"unknown method requires admin": {
+			authorization: []string{"Bearer operator-token"},
+			method:        "/nesting.Nesting/Unknown",
+			code:          codes.PermissionDenied,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tc.authorization != nil {
+				md.Set("authorization", tc.authorization...)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			err := tokens.authorize(ctx, tc.method)
+			assert.Equal(t, tc.code, status.Code(err))
+		})
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	testCases := map[string]struct {
+		content string
+		tokens  Tokens
+		err     bool
+	}{
+		"valid": {
+			content: `{"tokens": [{"name": "runner", "token": "secret", "role": "operator"}]}`,
+			tokens:  Tokens{{Name: "runner", Token: "secret", Role: RoleOperator}},
+		},
+		"no tokens": {
+			content: `{"tokens": []}`,
+			err:     true,
+		},
+		"empty token": {
+			content: `{"tokens": [{"name": "runner", "role": "operator"}]}`,
+			err:     true,
+		},
+		"unknown role": {
+			content: `{"tokens": [{"name": "runner", "token": "secret", "role": "root"}]}`,
+			err:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			tokens, err := LoadTokens(path)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.tokens, tokens)
+		})
+	}
+}
+
+func TestServeTokens(t *testing.T) {
+	anonymous, ctx, cancel, errCh := serve(t, WithTokens(Tokens{
+		{Name: "reader", Token: "reader-token", Role: RoleReader},
+		{Name: "admin", Token: "admin-token", Role: RoleAdmin},
+	}))
+
+	dial := func(token string) Client {
+		conn, err := NewClientConn("", nil, WithToken(token))
+		require.NoError(t, err)
+
+		client := New(conn)
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	admin := dial("admin-token")
+	reader := dial("reader-token")
+
+	require.Eventually(t, func() bool {
+		return admin.Init(ctx, []byte(`{}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err := anonymous.List(ctx)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = reader.List(ctx)
+	assert.NoError(t, err)
+
+	_, _, err = reader.Create(ctx, "image", nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// streams are authorized too
+	err = anonymous.Watch(ctx, func(hypervisor.Event) error { return nil })
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// Resources are amounts of VMs, CPUs and memory.
+type Resources struct {
+	VMs         uint32
+	CPUs        uint32
+	MemoryBytes uint64
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{
+		VMs:         r.VMs + o.VMs,
+		CPUs:        r.CPUs + o.CPUs,
+		MemoryBytes: r.MemoryBytes + o.MemoryBytes,
+	}
+}
+
+func (r Resources) sub(o Resources) Resources {
+	return Resources{
+		VMs:         r.VMs - o.VMs,
+		CPUs:        r.CPUs - o.CPUs,
+		MemoryBytes: r.MemoryBytes - o.MemoryBytes,
+	}
+}
+
+func (r Resources) toProto() *proto.Resources {
+	return &proto.Resources{
+		Vms:         r.VMs,
+		Cpus:        r.CPUs,
+		MemoryBytes: r.MemoryBytes,
+	}
+}
+
+func resourcesFromProto(r *proto.Resources) Resources {
+	return Resources{
+		VMs:         r.GetVms(),
+		CPUs:        r.GetCpus(),
+		MemoryBytes: r.GetMemoryBytes(),
+	}
+}
+
+// Limits are the resources the server admits VMs up to. Zero values are
+// unlimited.
+type Limits struct {
+	MaxVMs         uint32
+	MaxCPUs        uint32
+	MaxMemoryBytes uint64
+
+	// DefaultCPUs and DefaultMemoryBytes are what a VM created without
+	// overrides is accounted as using, as the server doesn't know the
+	// image's defaults.
+	DefaultCPUs        uint32
+	DefaultMemoryBytes uint64
+}
+
+func (l Limits) max() Resources {
+	return Resources{
+		VMs:         l.MaxVMs,
+		CPUs:        l.MaxCPUs,
+		MemoryBytes: l.MaxMemoryBytes,
+	}
+}
+
+// resources returns what a VM created with the options is accounted as using.
+func (l Limits) resources(opts hypervisor.CreateOptions) Resources {
+	r := Resources{VMs: 1, CPUs: opts.CPUs, MemoryBytes: opts.MemoryBytes}
+	if r.CPUs == 0 {
+		r.CPUs = l.DefaultCPUs
+	}
+	if r.MemoryBytes == 0 {
+		r.MemoryBytes = l.DefaultMemoryBytes
+	}
+
+	return r
+}
+
+// Capacity is the resources used by VMs and the limits they're admitted
+// against.
+type Capacity struct {
+	Used   Resources
+	Limits Resources
+}
+
+// WithLimits rejects creating VMs that would exceed the limits with
+// codes.ResourceExhausted, before the hypervisor is called.
+func WithLimits(limits Limits) ServeOption {
+	return func(o *serveOptions) {
+		o.limits = limits
+	}
+}
+
+// admit reserves the resources for a VM, or returns a ResourceExhausted error
+// detailing each limit that would be exceeded. The caller must hold s.mu.
+func (s *server) admit(r Resources) error {
+	max := s.limits.max()
+	want := s.used.add(r)
+
+	var violations []*errdetails.QuotaFailure_Violation
+	check := func(subject string, want, used, max uint64) {
+		if max > 0 && want > max {
+			violations = append(violations, &errdetails.QuotaFailure_Violation{
+				Subject:     subject,
+				Description: fmt.Sprintf("requested %d, %d of %d in use", want-used, used, max),
+			})
+		}
+	}
+	check("vms", uint64(want.VMs), uint64(s.used.VMs), uint64(max.VMs))
+	check("cpus", uint64(want.CPUs), uint64(s.used.CPUs), uint64(max.CPUs))
+	check("memory_bytes", want.MemoryBytes, s.used.MemoryBytes, max.MemoryBytes)
+
+	if len(violations) > 0 {
+		st := status.New(codes.ResourceExhausted, "insufficient capacity")
+		if detailed, err := st.WithDetails(&errdetails.QuotaFailure{Violations: violations}); err == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+
+	s.used = want
+
+	return nil
+}
+
+// release returns the resources reserved by admit. The caller must hold s.mu.
+func (s *server) release(r Resources) {
+	s.used = s.used.sub(r)
+}
+
+// track accounts for an existing VM's resources. The caller must hold s.mu.
+func (s *server) track(id string, r Resources) {
+	s.usage[id] = r
+	s.used = s.used.add(r)
+}
+
+// untrack releases a VM's resources. The caller must hold s.mu.
+func (s *server) untrack(id string) {
+	if r, ok := s.usage[id]; ok {
+		s.release(r)
+		delete(s.usage, id)
+	}
+}
+
+func (s *server) Capacity(ctx context.Context, _ *proto.CapacityRequest) (*proto.CapacityResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &proto.CapacityResponse{
+		Used:   s.used.toProto(),
+		Limits: s.limits.max().toProto(),
+	}, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestAdmission(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+	s.limits = Limits{
+		MaxVMs:             3,
+		MaxCPUs:            8,
+		MaxMemoryBytes:     16 << 30,
+		DefaultCPUs:        4,
+		DefaultMemoryBytes: 8 << 30,
+	}
+
+	capacity := func() *proto.CapacityResponse {
+		res, err := s.Capacity(context.TODO(), &proto.CapacityRequest{})
+		require.NoError(t, err)
+		return res
+	}
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	// accounted as using the defaults
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1"}, nil)(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+
+	// a failed create releases its reservation
+	hvCreateWithOptions("name-2", hypervisor.CreateOptions{CPUs: 2, MemoryBytes: 4 << 30}, nil, fmt.Errorf("no can do"))(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-2", Cpus: 2, MemoryBytes: 4 << 30})
+	require.Error(t, err)
+
+	hvCreateWithOptions("name-2", hypervisor.CreateOptions{CPUs: 2, MemoryBytes: 4 << 30}, hypervisor.VirtualMachineInfo{Name: "name-2", Id: "id-2"}, nil)(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-2", Cpus: 2, MemoryBytes: 4 << 30})
+	require.NoError(t, err)
+
+	assert.True(t, protobuf.Equal(&proto.CapacityResponse{
+		Used:   &proto.Resources{Vms: 2, Cpus: 6, MemoryBytes: 12 << 30},
+		Limits: &proto.Resources{Vms: 3, Cpus: 8, MemoryBytes: 16 << 30},
+	}, capacity()))
+
+	// exceeds both cpus and memory, the hypervisor isn't called
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-3"})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	failure, ok := st.Details()[0].(*errdetails.QuotaFailure)
+	require.True(t, ok)
+	require.Len(t, failure.GetViolations(), 2)
+	assert.Equal(t, "cpus", failure.GetViolations()[0].GetSubject())
+	assert.Equal(t, "requested 4, 6 of 8 in use", failure.GetViolations()[0].GetDescription())
+	assert.Equal(t, "memory_bytes", failure.GetViolations()[1].GetSubject())
+
+	// deleting frees the capacity up again
+	hvDelete("id-1", nil)(m)
+	_, err = s.Delete(context.TODO(), &proto.DeleteRequest{Id: "id-1"})
+	require.NoError(t, err)
+
+	hvCreate("name-3", hypervisor.VirtualMachineInfo{Name: "name-3", Id: "id-3"}, nil)(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-3"})
+	require.NoError(t, err)
+
+	assert.True(t, protobuf.Equal(&proto.Resources{Vms: 2, Cpus: 6, MemoryBytes: 12 << 30}, capacity().GetUsed()))
+}
+
+func TestAdmissionStompsSlotFirst(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+	s.limits = Limits{MaxVMs: 1}
+
+	hvInit([]byte{}, nil)(m)
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1"}, nil)(m)
+	hvDelete("id-1", nil)(m)
+	hvCreate("name-2", hypervisor.VirtualMachineInfo{Name: "name-2", Id: "id-2"}, nil)(m)
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1", Slot: int32Ref(0)})
+	require.NoError(t, err)
+
+	// the vm being stomped makes room for its replacement
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-2", Slot: int32Ref(0)})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-3"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestReconcileTracksUsage(t *testing.T) {
+	st := &store{path: filepath.Join(t.TempDir(), "state.json")}
+	require.NoError(t, st.save(state{VMs: []stateVM{
+		{Id: "id-1", Name: "name-1", CPUs: 2, MemoryBytes: 2 << 30},
+	}}))
+
+	m := mocks.NewHypervisor(t)
+	hvList([]hypervisor.VirtualMachineInfo{
+		{Id: "id-1", Name: "name-1"},
+		{Id: "id-2", Name: "name-2"}, // unknown to the state, so uses the defaults
+	}, nil)(m)
+
+	s := newServer(m)
+	s.store = st
+	s.limits = Limits{DefaultCPUs: 4, DefaultMemoryBytes: 8 << 30}
+	require.NoError(t, s.reconcile(context.TODO(), ReconcileAdopt))
+
+	assert.Equal(t, Resources{VMs: 2, CPUs: 6, MemoryBytes: 10 << 30}, s.used)
+
+	got, err := st.load()
+	require.NoError(t, err)
+	assert.Equal(t, state{VMs: []stateVM{
+		{Id: "id-1", Name: "name-1", CPUs: 2, MemoryBytes: 2 << 30},
+		{Id: "id-2", Name: "name-2", CPUs: 4, MemoryBytes: 8 << 30},
+	}}, got)
+}
@@ -2,12 +2,20 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
@@ -18,9 +26,21 @@ import (
 type Client interface {
 	Init(ctx context.Context, config []byte) error
 	Shutdown(ctx context.Context) error
-	Create(ctx context.Context, name string, slot *int32) (vm hypervisor.VirtualMachine, stompedVmId *string, err error)
+	Create(ctx context.Context, name string, slot *int32, options ...CreateOption) (vm hypervisor.VirtualMachine, stompedVmId *string, err error)
 	Delete(ctx context.Context, id string) error
+	DeleteWithOptions(ctx context.Context, id string, opts DeleteOptions) (hypervisor.StopMethod, error)
+	Snapshot(ctx context.Context, id, name string) error
+	DeleteSnapshot(ctx context.Context, name string) error
 	List(ctx context.Context) ([]hypervisor.VirtualMachine, error)
+	Watch(ctx context.Context, fn func(hypervisor.Event) error) error
+	Capacity(ctx context.Context) (Capacity, error)
+	GetInfo(ctx context.Context) (Info, error)
+	Pool(ctx context.Context) ([]PoolStats, error)
+	ListImages(ctx context.Context) ([]hypervisor.Image, error)
+	ImportImage(ctx context.Context, name, source string) error
+	DeleteImage(ctx context.Context, name string) error
+	UploadImage(ctx context.Context, name string, archive io.ReadSeeker, progress func(sent, total uint64)) error
+	Exec(ctx context.Context, id string, command []string, stdin io.Reader, stdout, stderr io.Writer) (exitCode int, err error)
 	Close() error
 }
 
@@ -40,11 +60,39 @@ func New(c *grpc.ClientConn) Client {
 	}
 }
 
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	tlsConfig *tls.Config
+	token     string
+}
+
+// WithTLS connects using TLS, such as with the config returned by
+// ClientTLSConfig, rather than without transport security.
+func WithTLS(tlsConfig *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithToken attaches a bearer token to every RPC, for servers configured with
+// WithTokens.
+func WithToken(token string) ClientOption {
+	return func(o *clientOptions) {
+		o.token = token
+	}
+}
+
 func DefaultConn() (*grpc.ClientConn, error) {
 	return NewClientConn("", nil)
 }
 
-func NewClientConn(target string, dialer Dialer) (*grpc.ClientConn, error) {
+func NewClientConn(target string, dialer Dialer, options ...ClientOption) (*grpc.ClientConn, error) {
+	var o clientOptions
+	for _, opt := range options {
+		opt(&o)
+	}
+
 	if target == "" {
 		target = socketPath()
 		if filepath.IsAbs(target) {
@@ -54,8 +102,17 @@ func NewClientConn(target string, dialer Dialer) (*grpc.ClientConn, error) {
 		}
 	}
 
+	creds := insecure.NewCredentials()
+	if o.tlsConfig != nil {
+		creds = credentials.NewTLS(o.tlsConfig)
+	}
+
 	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
+	}
+
+	if o.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(o.token)))
 	}
 
 	if dialer != nil {
@@ -108,10 +165,59 @@ func (c *client) Shutdown(ctx context.Context) error {
 	return err
 }
 
-func (c *client) Create(ctx context.Context, name string, slot *int32) (vm hypervisor.VirtualMachine, stompedVmId *string, err error) {
+// CreateOption configures the VM created by Create. Without any, the VM is
+// booted with the image's resources.
+type CreateOption func(*hypervisor.CreateOptions)
+
+// WithCPUs overrides the number of cpus the image gives the VM.
+func WithCPUs(cpus uint32) CreateOption {
+	return func(o *hypervisor.CreateOptions) {
+		o.CPUs = cpus
+	}
+}
+
+// WithMemory overrides the memory, in bytes, the image gives the VM.
+func WithMemory(bytes uint64) CreateOption {
+	return func(o *hypervisor.CreateOptions) {
+		o.MemoryBytes = bytes
+	}
+}
+
+// WithDiskSize overrides the disk size, in bytes, the image gives the VM.
+func WithDiskSize(bytes uint64) CreateOption {
+	return func(o *hypervisor.CreateOptions) {
+		o.DiskSizeBytes = bytes
+	}
+}
+
+// WithSnapshot restores the VM from the snapshot, instead of booting it.
+func WithSnapshot(snapshot string) CreateOption {
+	return func(o *hypervisor.CreateOptions) {
+		o.Snapshot = snapshot
+	}
+}
+
+// WithPorts makes the VM reachable on guest ports, in addition to the image's.
+func WithPorts(ports ...hypervisor.PortForward) CreateOption {
+	return func(o *hypervisor.CreateOptions) {
+		o.Ports = append(o.Ports, ports...)
+	}
+}
+
+func (c *client) Create(ctx context.Context, name string, slot *int32, options ...CreateOption) (vm hypervisor.VirtualMachine, stompedVmId *string, err error) {
+	var opts hypervisor.CreateOptions
+	for _, o := range options {
+		o(&opts)
+	}
+
 	response, err := c.client.Create(ctx, &proto.CreateRequest{
-		Name: name,
-		Slot: slot,
+		Name:          name,
+		Slot:          slot,
+		Cpus:          opts.CPUs,
+		MemoryBytes:   opts.MemoryBytes,
+		DiskSizeBytes: opts.DiskSizeBytes,
+		Snapshot:      opts.Snapshot,
+		Ports:         portsToProto(opts.Ports),
 	})
 	if err != nil {
 		return nil, nil, err
@@ -119,17 +225,59 @@ func (c *client) Create(ctx context.Context, name string, slot *int32) (vm hyper
 	if response == nil {
 		return nil, nil, nil
 	}
-	return response.Vm, response.StompedVmId, nil
+	return vmFromProto(response.Vm), response.StompedVmId, nil
+}
+
+// DeleteOptions configure how a VM is stopped before it's deleted.
+type DeleteOptions struct {
+	// GracePeriod, if set, is how long the guest is given to shut down before
+	// the VM is forcibly stopped. It's rounded up to whole seconds, and only
+	// honoured by hypervisors with the graceful_delete feature.
+	GracePeriod time.Duration
 }
 
 func (c *client) Delete(ctx context.Context, id string) error {
-	_, err := c.client.Delete(ctx, &proto.DeleteRequest{
-		Id: id,
+	_, err := c.DeleteWithOptions(ctx, id, DeleteOptions{})
+	return err
+}
+
+// DeleteWithOptions deletes a VM, reporting how it was stopped.
+func (c *client) DeleteWithOptions(ctx context.Context, id string, opts DeleteOptions) (hypervisor.StopMethod, error) {
+	var grace uint32
+	if opts.GracePeriod > 0 {
+		grace = uint32((opts.GracePeriod + time.Second - 1) / time.Second)
+	}
+
+	res, err := c.client.Delete(ctx, &proto.DeleteRequest{
+		Id:                 id,
+		GracePeriodSeconds: grace,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hypervisor.StopMethod(res.GetStopMethod()), nil
+}
+
+// Snapshot saves a VM's state as the named snapshot, which VMs can be
+// restored from with CreateOptions.Snapshot. The VM no longer exists once
+// it's saved.
+func (c *client) Snapshot(ctx context.Context, id, name string) error {
+	_, err := c.client.Snapshot(ctx, &proto.SnapshotRequest{
+		Id:   id,
+		Name: name,
 	})
 
 	return err
 }
 
+// DeleteSnapshot deletes the named snapshot. VMs already restored from it are
+// unaffected.
+func (c *client) DeleteSnapshot(ctx context.Context, name string) error {
+	_, err := c.client.DeleteSnapshot(ctx, &proto.DeleteSnapshotRequest{Name: name})
+	return err
+}
+
 func (c *client) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
 	results, err := c.client.List(ctx, &proto.ListRequest{})
 	if err != nil {
@@ -138,12 +286,273 @@ func (c *client) List(ctx context.Context) ([]hypervisor.VirtualMachine, error)
 
 	vms := make([]hypervisor.VirtualMachine, 0, len(results.Vms))
 	for _, vm := range results.Vms {
-		vms = append(vms, vm)
+		vms = append(vms, vmFromProto(vm))
 	}
 
 	return vms, nil
 }
 
+// Watch calls fn for each VM lifecycle event until the context is cancelled,
+// the server ends the stream, or fn returns an error.
+func (c *client) Watch(ctx context.Context, fn func(hypervisor.Event) error) error {
+	stream, err := c.client.Watch(ctx, &proto.WatchRequest{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(hypervisor.Event{
+			Type:   eventTypeFromProto(ev.GetType()),
+			Id:     ev.GetId(),
+			Name:   ev.GetName(),
+			Time:   ev.GetTimestamp().AsTime(),
+			Reason: ev.GetReason(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *client) Capacity(ctx context.Context) (Capacity, error) {
+	response, err := c.client.Capacity(ctx, &proto.CapacityRequest{})
+	if err != nil {
+		return Capacity{}, err
+	}
+
+	return Capacity{
+		Used:   resourcesFromProto(response.GetUsed()),
+		Limits: resourcesFromProto(response.GetLimits()),
+	}, nil
+}
+
+// GetInfo returns the server's version and what its hypervisor supports, so
+// that clients can adapt to the hypervisor.
+func (c *client) GetInfo(ctx context.Context) (Info, error) {
+	response, err := c.client.GetInfo(ctx, &proto.GetInfoRequest{})
+	if err != nil {
+		return Info{}, err
+	}
+
+	return infoFromProto(response), nil
+}
+
+// Pool returns the stats of each image's warm pool.
+func (c *client) Pool(ctx context.Context) ([]PoolStats, error) {
+	response, err := c.client.Pool(ctx, &proto.PoolRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]PoolStats, 0, len(response.GetPools()))
+	for _, pool := range response.GetPools() {
+		stats = append(stats, PoolStats{
+			Name:    pool.GetName(),
+			Target:  int(pool.GetTarget()),
+			Ready:   int(pool.GetReady()),
+			Filling: int(pool.GetFilling()),
+		})
+	}
+
+	return stats, nil
+}
+
+func (c *client) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	response, err := c.client.ListImages(ctx, &proto.ListImagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]hypervisor.Image, 0, len(response.GetImages()))
+	for _, image := range response.GetImages() {
+		images = append(images, hypervisor.Image{
+			Name:      image.GetName(),
+			SizeBytes: image.GetSizeBytes(),
+		})
+	}
+
+	return images, nil
+}
+
+// ImportImage copies the image at source, a path on the server's host, into
+// the hypervisor's images as name.
+func (c *client) ImportImage(ctx context.Context, name, source string) error {
+	_, err := c.client.ImportImage(ctx, &proto.ImportImageRequest{Name: name, Source: source})
+	return err
+}
+
+func (c *client) DeleteImage(ctx context.Context, name string) error {
+	_, err := c.client.DeleteImage(ctx, &proto.DeleteImageRequest{Name: name})
+	return err
+}
+
+// UploadImage uploads an image archive, a zstd compressed tar, resuming a
+// previous upload of the same archive if the server has one. Progress, if not
+// nil, is called as data is sent, with the offset reached and the archive's
+// size.
+func (c *client) UploadImage(ctx context.Context, name string, archive io.ReadSeeker, progress func(sent, total uint64)) error {
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("reading archive size: %w", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, archive); err != nil {
+		return fmt.Errorf("hashing archive: %w", err)
+	}
+
+	start := &proto.UploadImageStart{
+		Name:   name,
+		Size:   uint64(size),
+		Sha256: hex.EncodeToString(h.Sum(nil)),
+	}
+
+	// the first attempt learns the offset to resume from, if the server
+	// already has part of the archive
+	for attempt := 0; attempt < 2; attempt++ {
+		resp, err := c.uploadFrom(ctx, start, archive, progress)
+		if err != nil {
+			return err
+		}
+		if resp.GetComplete() {
+			return nil
+		}
+		if resp.GetOffset() == start.Offset {
+			break
+		}
+		start.Offset = resp.GetOffset()
+	}
+
+	return fmt.Errorf("upload incomplete at offset %d of %d", start.GetOffset(), start.GetSize())
+}
+
+func (c *client) uploadFrom(ctx context.Context, start *proto.UploadImageStart, archive io.ReadSeeker, progress func(sent, total uint64)) (*proto.UploadImageResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if _, err := archive.Seek(int64(start.GetOffset()), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+
+	stream, err := c.client.UploadImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// a send fails with io.EOF once the server has responded, such as when
+	// the upload is to be resumed from a different offset, and the response
+	// is returned by CloseAndRecv
+	err = stream.Send(&proto.UploadImageRequest{Request: &proto.UploadImageRequest_Start{Start: start}})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	sent := start.GetOffset()
+	buf := make([]byte, uploadChunkSize)
+	for err == nil {
+		var n int
+		n, err = archive.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&proto.UploadImageRequest{Request: &proto.UploadImageRequest_Data{Data: buf[:n]}}); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+
+			sent += uint64(n)
+			if progress != nil {
+				progress(sent, start.GetSize())
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// Exec runs a command inside a VM's guest, streaming stdin to it and its
+// output to stdout and stderr, and returns its exit code. Stdin may be nil for
+// no input. If the command exits before stdin is exhausted, the remainder
+// isn't read.
+func (c *client) Exec(ctx context.Context, id string, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = stream.Send(&proto.ExecRequest{Request: &proto.ExecRequest_Start{Start: &proto.ExecStart{
+		Id:      id,
+		Command: command,
+	}}})
+	if err != nil {
+		return 0, err
+	}
+
+	go func() {
+		defer stream.CloseSend()
+		if stdin == nil {
+			return
+		}
+
+		buf := make([]byte, execChunkSize)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				if err := stream.Send(&proto.ExecRequest{Request: &proto.ExecRequest_Stdin{Stdin: buf[:n]}}); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("exec stream ended without an exit code")
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch r := resp.GetResponse().(type) {
+		case *proto.ExecResponse_Stdout:
+			if stdout != nil {
+				if _, err := stdout.Write(r.Stdout); err != nil {
+					return 0, fmt.Errorf("writing stdout: %w", err)
+				}
+			}
+		case *proto.ExecResponse_Stderr:
+			if stderr != nil {
+				if _, err := stderr.Write(r.Stderr); err != nil {
+					return 0, fmt.Errorf("writing stderr: %w", err)
+				}
+			}
+		case *proto.ExecResponse_ExitCode:
+			return int(r.ExitCode), nil
+		}
+	}
+}
+
 func (c *client) Close() error {
 	return c.conn.Close()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
@@ -15,6 +16,7 @@ func TestCreate(t *testing.T) {
 	testCases := map[string]struct {
 		name            string
 		slot            *int32
+		opts            []CreateOption
 		expect          clientExpectation
 		wantVm          hypervisor.VirtualMachine
 		wantStompedVmId *string
@@ -26,6 +28,16 @@ func TestCreate(t *testing.T) {
 				&proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name"}}, nil),
 			wantVm: &hypervisor.VirtualMachineInfo{Name: "name"},
 		},
+		"with endpoints": {
+			name: "name",
+			expect: clientCreate(&proto.CreateRequest{Name: "name"},
+				&proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name", Addr: "1.1.1.1", Endpoints: []*proto.Endpoint{
+					{Host: "1.1.1.1", Port: 5986, Protocol: "tcp", Purpose: "winrm"},
+				}}}, nil),
+			wantVm: &hypervisor.VirtualMachineInfo{Name: "name", Addr: "1.1.1.1", Endpoints: []hypervisor.Endpoint{
+				{Host: "1.1.1.1", Port: 5986, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeWinRM},
+			}},
+		},
 		"error": {
 			name: "name",
 			expect: clientCreate(&proto.CreateRequest{Name: "name"},
@@ -47,6 +59,27 @@ func TestCreate(t *testing.T) {
 			wantVm:          &hypervisor.VirtualMachineInfo{Name: "name"},
 			wantStompedVmId: stringRef("abc"),
 		},
+		"with resource overrides": {
+			name: "name",
+			opts: []CreateOption{WithCPUs(4), WithMemory(8 << 30), WithDiskSize(100 << 30)},
+			expect: clientCreate(&proto.CreateRequest{Name: "name", Cpus: 4, MemoryBytes: 8 << 30, DiskSizeBytes: 100 << 30},
+				&proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name"}}, nil),
+			wantVm: &hypervisor.VirtualMachineInfo{Name: "name"},
+		},
+		"with ports": {
+			name: "name",
+			opts: []CreateOption{WithPorts(hypervisor.PortForward{Port: 3389, Purpose: hypervisor.PurposeRDP})},
+			expect: clientCreate(&proto.CreateRequest{Name: "name", Ports: []*proto.PortForward{{Port: 3389, Purpose: "rdp"}}},
+				&proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name"}}, nil),
+			wantVm: &hypervisor.VirtualMachineInfo{Name: "name"},
+		},
+		"with a snapshot": {
+			name: "name",
+			opts: []CreateOption{WithSnapshot("warm")},
+			expect: clientCreate(&proto.CreateRequest{Name: "name", Snapshot: "warm"},
+				&proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name"}}, nil),
+			wantVm: &hypervisor.VirtualMachineInfo{Name: "name"},
+		},
 		"nil response": {
 			name: "name",
 			expect: clientCreate(&proto.CreateRequest{Name: "name"},
@@ -64,7 +97,7 @@ func TestCreate(t *testing.T) {
 			c := &client{
 				client: m,
 			}
-			vm, stompedVmId, err := c.Create(context.TODO(), tc.name, tc.slot)
+			vm, stompedVmId, err := c.Create(context.TODO(), tc.name, tc.slot, tc.opts...)
 			assertHypervisorVmEqual(t, tc.wantVm, vm)
 			assert.Equal(t, tc.wantStompedVmId, stompedVmId)
 			if tc.wantErr {
@@ -76,6 +109,25 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestDelete(t *testing.T) {
+	m := mocks.NewNestingClient(t)
+	c := &client{
+		client: m,
+	}
+
+	m.EXPECT().Delete(context.TODO(), &proto.DeleteRequest{Id: "id"}).Return(&proto.DeleteResponse{StopMethod: "forced"}, nil).Once()
+	assert.NoError(t, c.Delete(context.TODO(), "id"))
+
+	// the grace period is rounded up to whole seconds
+	m.EXPECT().Delete(context.TODO(), &proto.DeleteRequest{Id: "id", GracePeriodSeconds: 2}).Return(&proto.DeleteResponse{StopMethod: "graceful"}, nil).Once()
+	method, err := c.DeleteWithOptions(context.TODO(), "id", DeleteOptions{GracePeriod: 1500 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, hypervisor.StopGraceful, method)
+
+	m.EXPECT().Delete(context.TODO(), &proto.DeleteRequest{Id: "id"}).Return(nil, fmt.Errorf("no can do")).Once()
+	assert.Error(t, c.Delete(context.TODO(), "id"))
+}
+
 func assertHypervisorVmEqual(t *testing.T, want, got hypervisor.VirtualMachine) {
 	if want == nil && got == nil {
 		return
@@ -94,6 +146,7 @@ func assertHypervisorVmEqual(t *testing.T, want, got hypervisor.VirtualMachine)
 	} {
 		assert.Equal(t, f[0](), f[1]())
 	}
+	assert.Equal(t, hypervisor.Endpoints(want), hypervisor.Endpoints(got))
 }
 
 type clientExpectation func(m *mocks.NestingClient)
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// subscriberBufferSize is the number of events buffered per watcher. A watcher
+// that falls further behind than this is disconnected rather than having
+// events silently dropped.
+const subscriberBufferSize = 64
+
+// broker fans out events to watchers. The zero value is ready to use.
+type broker struct {
+	mu     sync.Mutex
+	subs   map[chan *proto.Event]struct{}
+	closed bool
+}
+
+func (b *broker) subscribe() (<-chan *proto.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *proto.Event, subscriberBufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if b.subs == nil {
+		b.subs = make(map[chan *proto.Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *broker) publish(ev hypervisor.Event) {
+	msg := &proto.Event{
+		Type:      eventTypeToProto(ev.Type),
+		Id:        ev.Id,
+		Name:      ev.Name,
+		Timestamp: timestamppb.New(ev.Time),
+		Reason:    ev.Reason,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- msg:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// close disconnects all watchers, so that a graceful stop of the server isn't
+// blocked by streams that never end.
+func (b *broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *broker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+var eventTypes = map[hypervisor.EventType]proto.Event_Type{
+	hypervisor.EventCreated: proto.Event_CREATED,
+	hypervisor.EventRunning: proto.Event_RUNNING,
+	hypervisor.EventStopped: proto.Event_STOPPED,
+	hypervisor.EventErrored: proto.Event_ERRORED,
+	hypervisor.EventDeleted: proto.Event_DELETED,
+}
+
+func eventTypeToProto(t hypervisor.EventType) proto.Event_Type {
+	return eventTypes[t]
+}
+
+func eventTypeFromProto(t proto.Event_Type) hypervisor.EventType {
+	for k, v := range eventTypes {
+		if v == t {
+			return k
+		}
+	}
+
+	return ""
+}
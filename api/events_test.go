@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestBroker(t *testing.T) {
+	var b broker
+
+	fast, unsubscribeFast := b.subscribe()
+	defer unsubscribeFast()
+
+	slow, unsubscribeSlow := b.subscribe()
+	defer unsubscribeSlow()
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		b.publish(hypervisor.Event{Type: hypervisor.EventCreated, Id: "id"})
+		ev := <-fast
+		assert.Equal(t, proto.Event_CREATED, ev.GetType())
+		assert.Equal(t, "id", ev.GetId())
+	}
+
+	// the slow subscriber's buffer is now full, so the next event
+	// disconnects it
+	b.publish(hypervisor.Event{Type: hypervisor.EventDeleted, Id: "id"})
+	assert.Equal(t, proto.Event_DELETED, (<-fast).GetType())
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		<-slow
+	}
+	_, ok := <-slow
+	assert.False(t, ok)
+	assert.False(t, b.isClosed())
+
+	b.close()
+	_, ok = <-fast
+	assert.False(t, ok)
+
+	// subscribing after close returns a closed channel
+	ch, unsubscribe := b.subscribe()
+	defer unsubscribe()
+	_, ok = <-ch
+	require.False(t, ok)
+}
+
+func TestServerEvents(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "1.1.1.1"}, nil)(m)
+	hvDelete("id-1", nil)(m)
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+
+	for _, typ := range []proto.Event_Type{proto.Event_CREATED, proto.Event_RUNNING} {
+		ev := <-events
+		assert.Equal(t, typ, ev.GetType())
+		assert.Equal(t, "id-1", ev.GetId())
+		assert.Equal(t, "name-1", ev.GetName())
+	}
+
+	_, err = s.Delete(context.TODO(), &proto.DeleteRequest{Id: "id-1"})
+	require.NoError(t, err)
+
+	// the deleted event names the vm's image, as the created one does
+	ev := <-events
+	assert.Equal(t, proto.Event_DELETED, ev.GetType())
+	assert.Equal(t, "id-1", ev.GetId())
+	assert.Equal(t, "name-1", ev.GetName())
+}
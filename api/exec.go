@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// execChunkSize is the most stdin sent per message.
+const execChunkSize = 32 * 1024
+
+func (s *server) Exec(stream proto.Nesting_ExecServer) error {
+	if !s.initialized() {
+		return ErrNotInitialized
+	}
+
+	executor, ok := s.hv.(hypervisor.Executor)
+	if !ok {
+		return status.Error(codes.Unimplemented, "hypervisor doesn't support exec")
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	start := req.GetStart()
+	if start == nil || len(start.GetCommand()) == 0 {
+		return status.Error(codes.InvalidArgument, "exec must start with a command")
+	}
+
+	// stdin is written to the pipe as it arrives, and closed when the client
+	// closes its side of the stream. Closing the reader once the command has
+	// exited unblocks any pending write.
+	stdin, stdinWriter := io.Pipe()
+	defer stdin.Close()
+
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				stdinWriter.Close()
+				return
+			}
+			if err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+
+			if _, err := stdinWriter.Write(req.GetStdin()); err != nil {
+				return
+			}
+		}
+	}()
+
+	sender := &execSender{stream: stream}
+
+	exitCode, err := executor.Exec(stream.Context(), start.GetId(), hypervisor.ExecCommand{
+		Args:   start.GetCommand(),
+		Stdin:  stdin,
+		Stdout: execOutput{sender: sender},
+		Stderr: execOutput{sender: sender, stderr: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	return sender.send(&proto.ExecResponse{Response: &proto.ExecResponse_ExitCode{ExitCode: int32(exitCode)}})
+}
+
+// execSender serializes sends, as a command's stdout and stderr can be written
+// concurrently.
+type execSender struct {
+	mu     sync.Mutex
+	stream proto.Nesting_ExecServer
+}
+
+func (s *execSender) send(resp *proto.ExecResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stream.Send(resp)
+}
+
+// execOutput sends what's written to it as either stdout or stderr.
+type execOutput struct {
+	sender *execSender
+	stderr bool
+}
+
+func (o execOutput) Write(p []byte) (int, error) {
+	resp := &proto.ExecResponse{Response: &proto.ExecResponse_Stdout{Stdout: p}}
+	if o.stderr {
+		resp = &proto.ExecResponse{Response: &proto.ExecResponse_Stderr{Stderr: p}}
+	}
+
+	if err := o.sender.send(resp); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestServeExec(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, nil) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vm, _, err := client.Create(ctx, "image", nil)
+	require.NoError(t, err)
+
+	var stdout, stderr strings.Builder
+	exitCode, err := client.Exec(ctx, vm.GetId(), []string{"echo", "hello"}, nil, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "hello\n", stdout.String())
+
+	// stdin larger than a single message
+	input := strings.Repeat("0123456789abcdef", execChunkSize/8)
+	stdout.Reset()
+	exitCode, err = client.Exec(ctx, vm.GetId(), []string{"cat"}, strings.NewReader(input), &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, input, stdout.String())
+
+	exitCode, err = client.Exec(ctx, vm.GetId(), []string{"unknown"}, nil, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 127, exitCode)
+	assert.Equal(t, "unknown: command not found\n", stderr.String())
+
+	_, err = client.Exec(ctx, "unknown", []string{"echo"}, nil, nil, nil)
+	assert.Error(t, err)
+
+	_, err = client.Exec(ctx, vm.GetId(), nil, nil, nil, nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestExecUnimplemented(t *testing.T) {
+	s := newServer(mocks.NewHypervisor(t))
+	s.inited = true
+
+	err := s.Exec(nil)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
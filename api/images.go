@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func (s *server) ListImages(ctx context.Context, _ *proto.ListImagesRequest) (*proto.ListImagesResponse, error) {
+	images, err := s.imageManager()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := images.ListImages(ctx)
+	if err != nil {
+		return nil, imageError(err)
+	}
+
+	var resp proto.ListImagesResponse
+	for _, image := range list {
+		resp.Images = append(resp.Images, &proto.Image{
+			Name:      image.Name,
+			SizeBytes: image.SizeBytes,
+		})
+	}
+
+	return &resp, nil
+}
+
+func (s *server) ImportImage(ctx context.Context, req *proto.ImportImageRequest) (*proto.ImportImageResponse, error) {
+	images, err := s.imageManager()
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetName() == "" || req.GetSource() == "" {
+		return nil, status.Error(codes.InvalidArgument, "import requires a name and source")
+	}
+
+	if err := images.ImportImage(ctx, req.GetName(), req.GetSource()); err != nil {
+		return nil, imageError(err)
+	}
+
+	slog.Info("image imported", "name", req.GetName(), "source", req.GetSource())
+
+	return &proto.ImportImageResponse{}, nil
+}
+
+// DeleteImage deletes an image that no VM is using. Pooled VMs of the image
+// are deleted first, as they were never handed out.
+func (s *server) DeleteImage(ctx context.Context, req *proto.DeleteImageRequest) (*proto.DeleteImageResponse, error) {
+	images, err := s.imageManager()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for _, vm := range s.vms {
+		if vm.Name == req.GetName() {
+			s.mu.Unlock()
+			return nil, status.Errorf(codes.FailedPrecondition, "image %q is in use by vm %s", req.GetName(), vm.Id)
+		}
+	}
+	evicted := s.evictPooledImage(req.GetName())
+	s.mu.Unlock()
+
+	for _, pooled := range evicted {
+		s.deletePooled(pooled)
+	}
+
+	if err := images.DeleteImage(ctx, req.GetName()); err != nil {
+		return nil, imageError(err)
+	}
+
+	slog.Info("image deleted", "name", req.GetName())
+
+	return &proto.DeleteImageResponse{}, nil
+}
+
+func (s *server) imageManager() (hypervisor.ImageManager, error) {
+	if !s.initialized() {
+		return nil, ErrNotInitialized
+	}
+
+	images, ok := s.hv.(hypervisor.ImageManager)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "hypervisor doesn't support managing images")
+	}
+
+	return images, nil
+}
+
+// imageError maps the hypervisor's image errors to status codes.
+func imageError(err error) error {
+	switch {
+	case errors.Is(err, hypervisor.ErrImageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, hypervisor.ErrImageExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, hypervisor.ErrInvalidImageName):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return err
+}
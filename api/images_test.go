@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestImages(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"images": ["image"]}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	images, err := client.ListImages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image"}}, images)
+
+	require.NoError(t, client.ImportImage(ctx, "other", "/path/to/other"))
+	assert.Equal(t, codes.AlreadyExists, status.Code(client.ImportImage(ctx, "other", "/path/to/other")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(client.ImportImage(ctx, "missing-source", "")))
+
+	images, err = client.ListImages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image"}, {Name: "other"}}, images)
+
+	// images in use can't be deleted
+	vm, _, err := client.Create(ctx, "other", nil)
+	require.NoError(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(client.DeleteImage(ctx, "other")))
+
+	err = client.Delete(ctx, vm.GetId())
+	require.NoError(t, err)
+	require.NoError(t, client.DeleteImage(ctx, "other"))
+	assert.Equal(t, codes.NotFound, status.Code(client.DeleteImage(ctx, "other")))
+
+	_, _, err = client.Create(ctx, "other", nil)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestDeleteImageEvictsPooled(t *testing.T) {
+	s, hv := newPoolServer(t, map[string]int{"image": 2}, Limits{})
+	waitPool(t, s, PoolStats{Name: "image", Target: 2, Ready: 2})
+	require.NoError(t, hv.ImportImage(context.TODO(), "image", ""))
+
+	_, err := s.DeleteImage(context.TODO(), &proto.DeleteImageRequest{Name: "image"})
+	require.NoError(t, err)
+
+	assert.Empty(t, hvVMs(t, hv))
+	assert.Equal(t, Resources{}, s.used)
+}
+
+func TestImagesUnimplemented(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.ListImages(context.TODO(), &proto.ListImagesRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
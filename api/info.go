@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+
+	"gitlab.com/gitlab-org/fleeting/nesting"
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// Info describes the server and what its hypervisor supports.
+type Info struct {
+	// Hypervisor is the name of the driver, such as tart.
+	Hypervisor   string
+	Capabilities hypervisor.Capabilities
+
+	// Version is the version of the server.
+	Version nesting.VersionInfo
+
+	// Limits are the server's limits, such as -max-vms, whereas
+	// Capabilities.MaxVMs is the hypervisor's.
+	Limits Resources
+}
+
+func (s *server) GetInfo(ctx context.Context, _ *proto.GetInfoRequest) (*proto.GetInfoResponse, error) {
+	if !s.initialized() {
+		return nil, ErrNotInitialized
+	}
+
+	caps, err := s.hv.Capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make([]string, 0, len(caps.Features))
+	for _, feature := range caps.Features {
+		features = append(features, string(feature))
+	}
+
+	v := nesting.Version
+
+	return &proto.GetInfoResponse{
+		Hypervisor:        s.hvName,
+		HypervisorVersion: caps.Version,
+		Version: &proto.VersionInfo{
+			Name:         v.Name,
+			Version:      v.Version,
+			Revision:     v.Revision,
+			Reference:    v.Reference,
+			GoVersion:    v.GOVersion,
+			BuiltAt:      v.BuiltAt,
+			Os:           v.OS,
+			Architecture: v.Architecture,
+		},
+		Features:      features,
+		AddressFormat: string(caps.AddressFormat),
+		MaxVms:        caps.MaxVMs,
+		Limits:        s.limits.max().toProto(),
+	}, nil
+}
+
+func infoFromProto(resp *proto.GetInfoResponse) Info {
+	info := Info{
+		Hypervisor: resp.GetHypervisor(),
+		Capabilities: hypervisor.Capabilities{
+			Version:       resp.GetHypervisorVersion(),
+			AddressFormat: hypervisor.AddressFormat(resp.GetAddressFormat()),
+			MaxVMs:        resp.GetMaxVms(),
+		},
+		Version: nesting.VersionInfo{
+			Name:         resp.GetVersion().GetName(),
+			Version:      resp.GetVersion().GetVersion(),
+			Revision:     resp.GetVersion().GetRevision(),
+			Reference:    resp.GetVersion().GetReference(),
+			GOVersion:    resp.GetVersion().GetGoVersion(),
+			BuiltAt:      resp.GetVersion().GetBuiltAt(),
+			OS:           resp.GetVersion().GetOs(),
+			Architecture: resp.GetVersion().GetArchitecture(),
+		},
+		Limits: resourcesFromProto(resp.GetLimits()),
+	}
+
+	for _, feature := range resp.GetFeatures() {
+		info.Capabilities.Features = append(info.Capabilities.Features, hypervisor.Feature(feature))
+	}
+
+	return info
+}
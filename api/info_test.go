@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestGetInfo(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t, WithLimits(Limits{MaxVMs: 2, MaxCPUs: 8}))
+
+	require.Eventually(t, func() bool {
+		_, err := client.GetInfo(ctx)
+		return status.Code(err) == codes.FailedPrecondition
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Init(ctx, []byte(`{"max_vms": 3}`)))
+
+	info, err := client.GetInfo(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, "fake", info.Hypervisor)
+	assert.Equal(t, nesting.Version, info.Version)
+	assert.Equal(t, hypervisor.AddressIP, info.Capabilities.AddressFormat)
+	assert.Equal(t, uint32(3), info.Capabilities.MaxVMs)
+	assert.True(t, info.Capabilities.Has(hypervisor.FeatureSnapshots))
+	assert.False(t, info.Capabilities.Has(hypervisor.FeaturePersistentVMs))
+	assert.Equal(t, Resources{VMs: 2, CPUs: 8}, info.Limits)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
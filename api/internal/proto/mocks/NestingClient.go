@@ -25,6 +25,68 @@ func (_m *NestingClient) EXPECT() *NestingClient_Expecter {
 	return &NestingClient_Expecter{mock: &_m.Mock}
 }
 
+// Capacity provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) Capacity(ctx context.Context, in *proto.CapacityRequest, opts ...grpc.CallOption) (*proto.CapacityResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.CapacityResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.CapacityRequest, ...grpc.CallOption) *proto.CapacityResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.CapacityResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.CapacityRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_Capacity_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capacity'
+type NestingClient_Capacity_Call struct {
+	*mock.Call
+}
+
+// Capacity is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.CapacityRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) Capacity(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_Capacity_Call {
+	return &NestingClient_Capacity_Call{Call: _e.mock.On("Capacity",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_Capacity_Call) Run(run func(ctx context.Context, in *proto.CapacityRequest, opts ...grpc.CallOption)) *NestingClient_Capacity_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.CapacityRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_Capacity_Call) Return(_a0 *proto.CapacityResponse, _a1 error) *NestingClient_Capacity_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Create provides a mock function with given fields: ctx, in, opts
 func (_m *NestingClient) Create(ctx context.Context, in *proto.CreateRequest, opts ...grpc.CallOption) (*proto.CreateResponse, error) {
 	_va := make([]interface{}, len(opts))
@@ -149,6 +211,315 @@ func (_c *NestingClient_Delete_Call) Return(_a0 *proto.DeleteResponse, _a1 error
 	return _c
 }
 
+// DeleteImage provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) DeleteImage(ctx context.Context, in *proto.DeleteImageRequest, opts ...grpc.CallOption) (*proto.DeleteImageResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.DeleteImageResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.DeleteImageRequest, ...grpc.CallOption) *proto.DeleteImageResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.DeleteImageResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.DeleteImageRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_DeleteImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteImage'
+type NestingClient_DeleteImage_Call struct {
+	*mock.Call
+}
+
+// DeleteImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.DeleteImageRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) DeleteImage(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_DeleteImage_Call {
+	return &NestingClient_DeleteImage_Call{Call: _e.mock.On("DeleteImage",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_DeleteImage_Call) Run(run func(ctx context.Context, in *proto.DeleteImageRequest, opts ...grpc.CallOption)) *NestingClient_DeleteImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.DeleteImageRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_DeleteImage_Call) Return(_a0 *proto.DeleteImageResponse, _a1 error) *NestingClient_DeleteImage_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// DeleteSnapshot provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) DeleteSnapshot(ctx context.Context, in *proto.DeleteSnapshotRequest, opts ...grpc.CallOption) (*proto.DeleteSnapshotResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.DeleteSnapshotResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.DeleteSnapshotRequest, ...grpc.CallOption) *proto.DeleteSnapshotResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.DeleteSnapshotResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.DeleteSnapshotRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_DeleteSnapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteSnapshot'
+type NestingClient_DeleteSnapshot_Call struct {
+	*mock.Call
+}
+
+// DeleteSnapshot is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.DeleteSnapshotRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) DeleteSnapshot(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_DeleteSnapshot_Call {
+	return &NestingClient_DeleteSnapshot_Call{Call: _e.mock.On("DeleteSnapshot",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_DeleteSnapshot_Call) Run(run func(ctx context.Context, in *proto.DeleteSnapshotRequest, opts ...grpc.CallOption)) *NestingClient_DeleteSnapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.DeleteSnapshotRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_DeleteSnapshot_Call) Return(_a0 *proto.DeleteSnapshotResponse, _a1 error) *NestingClient_DeleteSnapshot_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Exec provides a mock function with given fields: ctx, opts
+func (_m *NestingClient) Exec(ctx context.Context, opts ...grpc.CallOption) (proto.Nesting_ExecClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 proto.Nesting_ExecClient
+	if rf, ok := ret.Get(0).(func(context.Context, ...grpc.CallOption) proto.Nesting_ExecClient); ok {
+		r0 = rf(ctx, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(proto.Nesting_ExecClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_Exec_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Exec'
+type NestingClient_Exec_Call struct {
+	*mock.Call
+}
+
+// Exec is a helper method to define mock.On call
+//   - ctx context.Context
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) Exec(ctx interface{}, opts ...interface{}) *NestingClient_Exec_Call {
+	return &NestingClient_Exec_Call{Call: _e.mock.On("Exec",
+		append([]interface{}{ctx}, opts...)...)}
+}
+
+func (_c *NestingClient_Exec_Call) Run(run func(ctx context.Context, opts ...grpc.CallOption)) *NestingClient_Exec_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-1)
+		for i, a := range args[1:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_Exec_Call) Return(_a0 proto.Nesting_ExecClient, _a1 error) *NestingClient_Exec_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// GetInfo provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) GetInfo(ctx context.Context, in *proto.GetInfoRequest, opts ...grpc.CallOption) (*proto.GetInfoResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.GetInfoResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetInfoRequest, ...grpc.CallOption) *proto.GetInfoResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.GetInfoResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetInfoRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_GetInfo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetInfo'
+type NestingClient_GetInfo_Call struct {
+	*mock.Call
+}
+
+// GetInfo is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.GetInfoRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) GetInfo(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_GetInfo_Call {
+	return &NestingClient_GetInfo_Call{Call: _e.mock.On("GetInfo",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_GetInfo_Call) Run(run func(ctx context.Context, in *proto.GetInfoRequest, opts ...grpc.CallOption)) *NestingClient_GetInfo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.GetInfoRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_GetInfo_Call) Return(_a0 *proto.GetInfoResponse, _a1 error) *NestingClient_GetInfo_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// ImportImage provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) ImportImage(ctx context.Context, in *proto.ImportImageRequest, opts ...grpc.CallOption) (*proto.ImportImageResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ImportImageResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ImportImageRequest, ...grpc.CallOption) *proto.ImportImageResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ImportImageResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ImportImageRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_ImportImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImportImage'
+type NestingClient_ImportImage_Call struct {
+	*mock.Call
+}
+
+// ImportImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.ImportImageRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) ImportImage(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_ImportImage_Call {
+	return &NestingClient_ImportImage_Call{Call: _e.mock.On("ImportImage",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_ImportImage_Call) Run(run func(ctx context.Context, in *proto.ImportImageRequest, opts ...grpc.CallOption)) *NestingClient_ImportImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.ImportImageRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_ImportImage_Call) Return(_a0 *proto.ImportImageResponse, _a1 error) *NestingClient_ImportImage_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Init provides a mock function with given fields: ctx, in, opts
 func (_m *NestingClient) Init(ctx context.Context, in *proto.InitRequest, opts ...grpc.CallOption) (*proto.InitResponse, error) {
 	_va := make([]interface{}, len(opts))
@@ -273,6 +644,130 @@ func (_c *NestingClient_List_Call) Return(_a0 *proto.ListResponse, _a1 error) *N
 	return _c
 }
 
+// ListImages provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) ListImages(ctx context.Context, in *proto.ListImagesRequest, opts ...grpc.CallOption) (*proto.ListImagesResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ListImagesResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ListImagesRequest, ...grpc.CallOption) *proto.ListImagesResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ListImagesResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ListImagesRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_ListImages_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListImages'
+type NestingClient_ListImages_Call struct {
+	*mock.Call
+}
+
+// ListImages is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.ListImagesRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) ListImages(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_ListImages_Call {
+	return &NestingClient_ListImages_Call{Call: _e.mock.On("ListImages",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_ListImages_Call) Run(run func(ctx context.Context, in *proto.ListImagesRequest, opts ...grpc.CallOption)) *NestingClient_ListImages_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.ListImagesRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_ListImages_Call) Return(_a0 *proto.ListImagesResponse, _a1 error) *NestingClient_ListImages_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Pool provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) Pool(ctx context.Context, in *proto.PoolRequest, opts ...grpc.CallOption) (*proto.PoolResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.PoolResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.PoolRequest, ...grpc.CallOption) *proto.PoolResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.PoolResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.PoolRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_Pool_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Pool'
+type NestingClient_Pool_Call struct {
+	*mock.Call
+}
+
+// Pool is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.PoolRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) Pool(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_Pool_Call {
+	return &NestingClient_Pool_Call{Call: _e.mock.On("Pool",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_Pool_Call) Run(run func(ctx context.Context, in *proto.PoolRequest, opts ...grpc.CallOption)) *NestingClient_Pool_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.PoolRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_Pool_Call) Return(_a0 *proto.PoolResponse, _a1 error) *NestingClient_Pool_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Shutdown provides a mock function with given fields: ctx, in, opts
 func (_m *NestingClient) Shutdown(ctx context.Context, in *proto.ShutdownRequest, opts ...grpc.CallOption) (*proto.ShutdownResponse, error) {
 	_va := make([]interface{}, len(opts))
@@ -335,6 +830,191 @@ func (_c *NestingClient_Shutdown_Call) Return(_a0 *proto.ShutdownResponse, _a1 e
 	return _c
 }
 
+// Snapshot provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) Snapshot(ctx context.Context, in *proto.SnapshotRequest, opts ...grpc.CallOption) (*proto.SnapshotResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.SnapshotResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.SnapshotRequest, ...grpc.CallOption) *proto.SnapshotResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.SnapshotResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.SnapshotRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_Snapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Snapshot'
+type NestingClient_Snapshot_Call struct {
+	*mock.Call
+}
+
+// Snapshot is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.SnapshotRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) Snapshot(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_Snapshot_Call {
+	return &NestingClient_Snapshot_Call{Call: _e.mock.On("Snapshot",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_Snapshot_Call) Run(run func(ctx context.Context, in *proto.SnapshotRequest, opts ...grpc.CallOption)) *NestingClient_Snapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.SnapshotRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_Snapshot_Call) Return(_a0 *proto.SnapshotResponse, _a1 error) *NestingClient_Snapshot_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// UploadImage provides a mock function with given fields: ctx, opts
+func (_m *NestingClient) UploadImage(ctx context.Context, opts ...grpc.CallOption) (proto.Nesting_UploadImageClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 proto.Nesting_UploadImageClient
+	if rf, ok := ret.Get(0).(func(context.Context, ...grpc.CallOption) proto.Nesting_UploadImageClient); ok {
+		r0 = rf(ctx, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(proto.Nesting_UploadImageClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_UploadImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UploadImage'
+type NestingClient_UploadImage_Call struct {
+	*mock.Call
+}
+
+// UploadImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) UploadImage(ctx interface{}, opts ...interface{}) *NestingClient_UploadImage_Call {
+	return &NestingClient_UploadImage_Call{Call: _e.mock.On("UploadImage",
+		append([]interface{}{ctx}, opts...)...)}
+}
+
+func (_c *NestingClient_UploadImage_Call) Run(run func(ctx context.Context, opts ...grpc.CallOption)) *NestingClient_UploadImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-1)
+		for i, a := range args[1:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_UploadImage_Call) Return(_a0 proto.Nesting_UploadImageClient, _a1 error) *NestingClient_UploadImage_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Watch provides a mock function with given fields: ctx, in, opts
+func (_m *NestingClient) Watch(ctx context.Context, in *proto.WatchRequest, opts ...grpc.CallOption) (proto.Nesting_WatchClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 proto.Nesting_WatchClient
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.WatchRequest, ...grpc.CallOption) proto.Nesting_WatchClient); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(proto.Nesting_WatchClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.WatchRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NestingClient_Watch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Watch'
+type NestingClient_Watch_Call struct {
+	*mock.Call
+}
+
+// Watch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - in *proto.WatchRequest
+//   - opts ...grpc.CallOption
+func (_e *NestingClient_Expecter) Watch(ctx interface{}, in interface{}, opts ...interface{}) *NestingClient_Watch_Call {
+	return &NestingClient_Watch_Call{Call: _e.mock.On("Watch",
+		append([]interface{}{ctx, in}, opts...)...)}
+}
+
+func (_c *NestingClient_Watch_Call) Run(run func(ctx context.Context, in *proto.WatchRequest, opts ...grpc.CallOption)) *NestingClient_Watch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]grpc.CallOption, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(grpc.CallOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(*proto.WatchRequest), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *NestingClient_Watch_Call) Return(_a0 proto.Nesting_WatchClient, _a1 error) *NestingClient_Watch_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type mockConstructorTestingTNewNestingClient interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// logRPC logs a completed RPC. Successful calls are logged at debug level, so
+// that the default level isn't flooded by List and Watch calls from clients.
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	attrs := []slog.Attr{
+		slog.String("method", path.Base(method)),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+
+	if err == nil {
+		slog.LogAttrs(ctx, slog.LevelDebug, "rpc handled", attrs...)
+		return
+	}
+
+	attrs = append(attrs, slog.Any("error", err))
+	slog.LogAttrs(ctx, slog.LevelError, "rpc failed", attrs...)
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRPC(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logRPC(ss.Context(), info.FullMethod, start, err)
+
+	return err
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"images": ["image"]}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vm, _, err := client.Create(ctx, "image", nil)
+	require.NoError(t, err)
+
+	_, _, err = client.Create(ctx, "unknown", nil)
+	require.Error(t, err)
+
+	cancel()
+	require.NoError(t, <-errCh)
+
+	type record struct {
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Code   string `json:"code"`
+		Id     string `json:"id"`
+	}
+
+	var records []record
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r record
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+
+	assert.Contains(t, records, record{Level: "INFO", Msg: "vm created", Id: vm.GetId()})
+	assert.Contains(t, records, record{Level: "DEBUG", Msg: "rpc handled", Method: "Create", Code: "OK"})
+	assert.Contains(t, records, record{Level: "ERROR", Msg: "rpc failed", Method: "Create", Code: "NotFound"})
+	assert.Contains(t, records, record{Level: "INFO", Msg: "shutting down"})
+}
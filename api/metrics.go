@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
+)
+
+// WithMetricsListener serves Prometheus metrics over HTTP on the address.
+func WithMetricsListener(addr string) ServeOption {
+	return func(o *serveOptions) {
+		o.metricsAddr = addr
+	}
+}
+
+// hypervisorName returns the name of the hypervisor's package, such as
+// "parallels", for labelling metrics.
+func hypervisorName(hv hypervisor.Hypervisor) string {
+	t := reflect.TypeOf(hv)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return path.Base(t.PkgPath())
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	method = path.Base(method)
+	code := status.Code(err).String()
+
+	metrics.RPCRequests.WithLabelValues(method, code).Inc()
+	metrics.RPCDuration.WithLabelValues(method, code).Observe(metrics.Since(start))
+}
+
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+
+	return err
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/fake"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestHypervisorName(t *testing.T) {
+	hv, err := fake.New(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "fake", hypervisorName(hv))
+	assert.Equal(t, "mocks", hypervisorName(mocks.NewHypervisor(t)))
+	assert.Equal(t, "", hypervisorName(nil))
+}
+
+func TestServeMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	client, ctx, cancel, errCh := serve(t, WithMetricsListener(addr))
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"images": ["image"]}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	slot := int32(0)
+	_, _, err = client.Create(ctx, "image", &slot)
+	require.NoError(t, err)
+	vm, _, err := client.Create(ctx, "image", &slot)
+	require.NoError(t, err)
+	err = client.Delete(ctx, vm.GetId())
+	require.NoError(t, err)
+
+	_, _, err = client.Create(ctx, "unknown", nil)
+	require.Error(t, err)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, metric := range []string{
+		`nesting_rpc_requests_total{code="OK",method="Init"}`,
+		`nesting_rpc_duration_seconds_count{code="OK",method="Create"}`,
+		`nesting_vm_create_duration_seconds_count{hypervisor="fake",image="image",result="success"}`,
+		`nesting_vm_create_duration_seconds_count{hypervisor="fake",image="unknown",result="error"}`,
+		`nesting_vm_delete_duration_seconds_count{hypervisor="fake",image="image",result="success"}`,
+		`nesting_vms_running 0`,
+		`nesting_slot_stomps_total`,
+	} {
+		assert.Contains(t, string(body), metric)
+	}
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
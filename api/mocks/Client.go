@@ -4,8 +4,10 @@ package mocks
 
 import (
 	context "context"
+	io "io"
 
 	mock "github.com/stretchr/testify/mock"
+	api "gitlab.com/gitlab-org/fleeting/nesting/api"
 	hypervisor "gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 )
 
@@ -22,6 +24,50 @@ func (_m *Client) EXPECT() *Client_Expecter {
 	return &Client_Expecter{mock: &_m.Mock}
 }
 
+// Capacity provides a mock function with given fields: ctx
+func (_m *Client) Capacity(ctx context.Context) (api.Capacity, error) {
+	ret := _m.Called(ctx)
+
+	var r0 api.Capacity
+	if rf, ok := ret.Get(0).(func(context.Context) api.Capacity); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(api.Capacity)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_Capacity_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capacity'
+type Client_Capacity_Call struct {
+	*mock.Call
+}
+
+// Capacity is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Client_Expecter) Capacity(ctx interface{}) *Client_Capacity_Call {
+	return &Client_Capacity_Call{Call: _e.mock.On("Capacity", ctx)}
+}
+
+func (_c *Client_Capacity_Call) Run(run func(ctx context.Context)) *Client_Capacity_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Client_Capacity_Call) Return(_a0 api.Capacity, _a1 error) *Client_Capacity_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Close provides a mock function with given fields:
 func (_m *Client) Close() error {
 	ret := _m.Called()
@@ -58,13 +104,20 @@ func (_c *Client_Close_Call) Return(_a0 error) *Client_Close_Call {
 	return _c
 }
 
-// Create provides a mock function with given fields: ctx, name, slot
-func (_m *Client) Create(ctx context.Context, name string, slot *int32) (hypervisor.VirtualMachine, *string, error) {
-	ret := _m.Called(ctx, name, slot)
+// Create provides a mock function with given fields: ctx, name, slot, options
+func (_m *Client) Create(ctx context.Context, name string, slot *int32, options ...api.CreateOption) (hypervisor.VirtualMachine, *string, error) {
+	_va := make([]interface{}, len(options))
+	for _i := range options {
+		_va[_i] = options[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, name, slot)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	var r0 hypervisor.VirtualMachine
-	if rf, ok := ret.Get(0).(func(context.Context, string, *int32) hypervisor.VirtualMachine); ok {
-		r0 = rf(ctx, name, slot)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *int32, ...api.CreateOption) hypervisor.VirtualMachine); ok {
+		r0 = rf(ctx, name, slot, options...)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(hypervisor.VirtualMachine)
@@ -72,8 +125,8 @@ func (_m *Client) Create(ctx context.Context, name string, slot *int32) (hypervi
 	}
 
 	var r1 *string
-	if rf, ok := ret.Get(1).(func(context.Context, string, *int32) *string); ok {
-		r1 = rf(ctx, name, slot)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *int32, ...api.CreateOption) *string); ok {
+		r1 = rf(ctx, name, slot, options...)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(*string)
@@ -81,8 +134,8 @@ func (_m *Client) Create(ctx context.Context, name string, slot *int32) (hypervi
 	}
 
 	var r2 error
-	if rf, ok := ret.Get(2).(func(context.Context, string, *int32) error); ok {
-		r2 = rf(ctx, name, slot)
+	if rf, ok := ret.Get(2).(func(context.Context, string, *int32, ...api.CreateOption) error); ok {
+		r2 = rf(ctx, name, slot, options...)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -99,13 +152,21 @@ type Client_Create_Call struct {
 //   - ctx context.Context
 //   - name string
 //   - slot *int32
-func (_e *Client_Expecter) Create(ctx interface{}, name interface{}, slot interface{}) *Client_Create_Call {
-	return &Client_Create_Call{Call: _e.mock.On("Create", ctx, name, slot)}
+//   - options ...api.CreateOption
+func (_e *Client_Expecter) Create(ctx interface{}, name interface{}, slot interface{}, options ...interface{}) *Client_Create_Call {
+	return &Client_Create_Call{Call: _e.mock.On("Create",
+		append([]interface{}{ctx, name, slot}, options...)...)}
 }
 
-func (_c *Client_Create_Call) Run(run func(ctx context.Context, name string, slot *int32)) *Client_Create_Call {
+func (_c *Client_Create_Call) Run(run func(ctx context.Context, name string, slot *int32, options ...api.CreateOption)) *Client_Create_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(*int32))
+		variadicArgs := make([]api.CreateOption, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(api.CreateOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(*int32), variadicArgs...)
 	})
 	return _c
 }
@@ -153,6 +214,260 @@ func (_c *Client_Delete_Call) Return(_a0 error) *Client_Delete_Call {
 	return _c
 }
 
+// DeleteImage provides a mock function with given fields: ctx, name
+func (_m *Client) DeleteImage(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_DeleteImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteImage'
+type Client_DeleteImage_Call struct {
+	*mock.Call
+}
+
+// DeleteImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Client_Expecter) DeleteImage(ctx interface{}, name interface{}) *Client_DeleteImage_Call {
+	return &Client_DeleteImage_Call{Call: _e.mock.On("DeleteImage", ctx, name)}
+}
+
+func (_c *Client_DeleteImage_Call) Run(run func(ctx context.Context, name string)) *Client_DeleteImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Client_DeleteImage_Call) Return(_a0 error) *Client_DeleteImage_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// DeleteSnapshot provides a mock function with given fields: ctx, name
+func (_m *Client) DeleteSnapshot(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_DeleteSnapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteSnapshot'
+type Client_DeleteSnapshot_Call struct {
+	*mock.Call
+}
+
+// DeleteSnapshot is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Client_Expecter) DeleteSnapshot(ctx interface{}, name interface{}) *Client_DeleteSnapshot_Call {
+	return &Client_DeleteSnapshot_Call{Call: _e.mock.On("DeleteSnapshot", ctx, name)}
+}
+
+func (_c *Client_DeleteSnapshot_Call) Run(run func(ctx context.Context, name string)) *Client_DeleteSnapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Client_DeleteSnapshot_Call) Return(_a0 error) *Client_DeleteSnapshot_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// DeleteWithOptions provides a mock function with given fields: ctx, id, opts
+func (_m *Client) DeleteWithOptions(ctx context.Context, id string, opts api.DeleteOptions) (hypervisor.StopMethod, error) {
+	ret := _m.Called(ctx, id, opts)
+
+	var r0 hypervisor.StopMethod
+	if rf, ok := ret.Get(0).(func(context.Context, string, api.DeleteOptions) hypervisor.StopMethod); ok {
+		r0 = rf(ctx, id, opts)
+	} else {
+		r0 = ret.Get(0).(hypervisor.StopMethod)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, api.DeleteOptions) error); ok {
+		r1 = rf(ctx, id, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_DeleteWithOptions_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteWithOptions'
+type Client_DeleteWithOptions_Call struct {
+	*mock.Call
+}
+
+// DeleteWithOptions is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - opts api.DeleteOptions
+func (_e *Client_Expecter) DeleteWithOptions(ctx interface{}, id interface{}, opts interface{}) *Client_DeleteWithOptions_Call {
+	return &Client_DeleteWithOptions_Call{Call: _e.mock.On("DeleteWithOptions", ctx, id, opts)}
+}
+
+func (_c *Client_DeleteWithOptions_Call) Run(run func(ctx context.Context, id string, opts api.DeleteOptions)) *Client_DeleteWithOptions_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(api.DeleteOptions))
+	})
+	return _c
+}
+
+func (_c *Client_DeleteWithOptions_Call) Return(_a0 hypervisor.StopMethod, _a1 error) *Client_DeleteWithOptions_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Exec provides a mock function with given fields: ctx, id, command, stdin, stdout, stderr
+func (_m *Client) Exec(ctx context.Context, id string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	ret := _m.Called(ctx, id, command, stdin, stdout, stderr)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string, io.Reader, io.Writer, io.Writer) int); ok {
+		r0 = rf(ctx, id, command, stdin, stdout, stderr)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string, io.Reader, io.Writer, io.Writer) error); ok {
+		r1 = rf(ctx, id, command, stdin, stdout, stderr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_Exec_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Exec'
+type Client_Exec_Call struct {
+	*mock.Call
+}
+
+// Exec is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - command []string
+//   - stdin io.Reader
+//   - stdout io.Writer
+//   - stderr io.Writer
+func (_e *Client_Expecter) Exec(ctx interface{}, id interface{}, command interface{}, stdin interface{}, stdout interface{}, stderr interface{}) *Client_Exec_Call {
+	return &Client_Exec_Call{Call: _e.mock.On("Exec", ctx, id, command, stdin, stdout, stderr)}
+}
+
+func (_c *Client_Exec_Call) Run(run func(ctx context.Context, id string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer)) *Client_Exec_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].([]string), args[3].(io.Reader), args[4].(io.Writer), args[5].(io.Writer))
+	})
+	return _c
+}
+
+func (_c *Client_Exec_Call) Return(exitCode int, err error) *Client_Exec_Call {
+	_c.Call.Return(exitCode, err)
+	return _c
+}
+
+// GetInfo provides a mock function with given fields: ctx
+func (_m *Client) GetInfo(ctx context.Context) (api.Info, error) {
+	ret := _m.Called(ctx)
+
+	var r0 api.Info
+	if rf, ok := ret.Get(0).(func(context.Context) api.Info); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(api.Info)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_GetInfo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetInfo'
+type Client_GetInfo_Call struct {
+	*mock.Call
+}
+
+// GetInfo is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Client_Expecter) GetInfo(ctx interface{}) *Client_GetInfo_Call {
+	return &Client_GetInfo_Call{Call: _e.mock.On("GetInfo", ctx)}
+}
+
+func (_c *Client_GetInfo_Call) Run(run func(ctx context.Context)) *Client_GetInfo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Client_GetInfo_Call) Return(_a0 api.Info, _a1 error) *Client_GetInfo_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// ImportImage provides a mock function with given fields: ctx, name, source
+func (_m *Client) ImportImage(ctx context.Context, name string, source string) error {
+	ret := _m.Called(ctx, name, source)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, name, source)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_ImportImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImportImage'
+type Client_ImportImage_Call struct {
+	*mock.Call
+}
+
+// ImportImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+//   - source string
+func (_e *Client_Expecter) ImportImage(ctx interface{}, name interface{}, source interface{}) *Client_ImportImage_Call {
+	return &Client_ImportImage_Call{Call: _e.mock.On("ImportImage", ctx, name, source)}
+}
+
+func (_c *Client_ImportImage_Call) Run(run func(ctx context.Context, name string, source string)) *Client_ImportImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Client_ImportImage_Call) Return(_a0 error) *Client_ImportImage_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
 // Init provides a mock function with given fields: ctx, config
 func (_m *Client) Init(ctx context.Context, config []byte) error {
 	ret := _m.Called(ctx, config)
@@ -237,6 +552,98 @@ func (_c *Client_List_Call) Return(_a0 []hypervisor.VirtualMachine, _a1 error) *
 	return _c
 }
 
+// ListImages provides a mock function with given fields: ctx
+func (_m *Client) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []hypervisor.Image
+	if rf, ok := ret.Get(0).(func(context.Context) []hypervisor.Image); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]hypervisor.Image)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_ListImages_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListImages'
+type Client_ListImages_Call struct {
+	*mock.Call
+}
+
+// ListImages is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Client_Expecter) ListImages(ctx interface{}) *Client_ListImages_Call {
+	return &Client_ListImages_Call{Call: _e.mock.On("ListImages", ctx)}
+}
+
+func (_c *Client_ListImages_Call) Run(run func(ctx context.Context)) *Client_ListImages_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Client_ListImages_Call) Return(_a0 []hypervisor.Image, _a1 error) *Client_ListImages_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Pool provides a mock function with given fields: ctx
+func (_m *Client) Pool(ctx context.Context) ([]api.PoolStats, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []api.PoolStats
+	if rf, ok := ret.Get(0).(func(context.Context) []api.PoolStats); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]api.PoolStats)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Client_Pool_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Pool'
+type Client_Pool_Call struct {
+	*mock.Call
+}
+
+// Pool is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Client_Expecter) Pool(ctx interface{}) *Client_Pool_Call {
+	return &Client_Pool_Call{Call: _e.mock.On("Pool", ctx)}
+}
+
+func (_c *Client_Pool_Call) Run(run func(ctx context.Context)) *Client_Pool_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Client_Pool_Call) Return(_a0 []api.PoolStats, _a1 error) *Client_Pool_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Shutdown provides a mock function with given fields: ctx
 func (_m *Client) Shutdown(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -274,6 +681,123 @@ func (_c *Client_Shutdown_Call) Return(_a0 error) *Client_Shutdown_Call {
 	return _c
 }
 
+// Snapshot provides a mock function with given fields: ctx, id, name
+func (_m *Client) Snapshot(ctx context.Context, id string, name string) error {
+	ret := _m.Called(ctx, id, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_Snapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Snapshot'
+type Client_Snapshot_Call struct {
+	*mock.Call
+}
+
+// Snapshot is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - name string
+func (_e *Client_Expecter) Snapshot(ctx interface{}, id interface{}, name interface{}) *Client_Snapshot_Call {
+	return &Client_Snapshot_Call{Call: _e.mock.On("Snapshot", ctx, id, name)}
+}
+
+func (_c *Client_Snapshot_Call) Run(run func(ctx context.Context, id string, name string)) *Client_Snapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Client_Snapshot_Call) Return(_a0 error) *Client_Snapshot_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// UploadImage provides a mock function with given fields: ctx, name, archive, progress
+func (_m *Client) UploadImage(ctx context.Context, name string, archive io.ReadSeeker, progress func(sent uint64, total uint64)) error {
+	ret := _m.Called(ctx, name, archive, progress)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, io.ReadSeeker, func(sent uint64, total uint64)) error); ok {
+		r0 = rf(ctx, name, archive, progress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_UploadImage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UploadImage'
+type Client_UploadImage_Call struct {
+	*mock.Call
+}
+
+// UploadImage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+//   - archive io.ReadSeeker
+//   - progress func(sent uint64, total uint64)
+func (_e *Client_Expecter) UploadImage(ctx interface{}, name interface{}, archive interface{}, progress interface{}) *Client_UploadImage_Call {
+	return &Client_UploadImage_Call{Call: _e.mock.On("UploadImage", ctx, name, archive, progress)}
+}
+
+func (_c *Client_UploadImage_Call) Run(run func(ctx context.Context, name string, archive io.ReadSeeker, progress func(sent uint64, total uint64))) *Client_UploadImage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(io.ReadSeeker), args[3].(func(sent uint64, total uint64)))
+	})
+	return _c
+}
+
+func (_c *Client_UploadImage_Call) Return(_a0 error) *Client_UploadImage_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// Watch provides a mock function with given fields: ctx, fn
+func (_m *Client) Watch(ctx context.Context, fn func(hypervisor.Event) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(hypervisor.Event) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Client_Watch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Watch'
+type Client_Watch_Call struct {
+	*mock.Call
+}
+
+// Watch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - fn func(hypervisor.Event) error
+func (_e *Client_Expecter) Watch(ctx interface{}, fn interface{}) *Client_Watch_Call {
+	return &Client_Watch_Call{Call: _e.mock.On("Watch", ctx, fn)}
+}
+
+func (_c *Client_Watch_Call) Run(run func(ctx context.Context, fn func(hypervisor.Event) error)) *Client_Watch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(func(hypervisor.Event) error))
+	})
+	return _c
+}
+
+func (_c *Client_Watch_Call) Return(_a0 error) *Client_Watch_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
 type mockConstructorTestingTNewClient interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
+)
+
+// poolRetryDelay is how long to wait before refilling a pool after booting a
+// VM for it failed.
+const poolRetryDelay = 30 * time.Second
+
+// pool keeps pre-booted VMs per image, which Create hands out rather than
+// booting a VM. Pooled VMs are accounted against the limits like any other,
+// but are evicted to make room for VMs that wouldn't otherwise be admitted.
+//
+// The pool is guarded by the server's mutex.
+type pool struct {
+	targets map[string]int
+	ready   map[string][]pooledVM
+	filling map[string]int
+
+	// ctx is cancelled when the pool is drained, and nil before it's first
+	// started
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type pooledVM struct {
+	vm        hypervisor.VirtualMachine
+	resources Resources
+}
+
+// PoolStats are the number of VMs pooled for an image.
+type PoolStats struct {
+	Name    string
+	Target  int
+	Ready   int
+	Filling int
+}
+
+// WithPool keeps a number of pre-booted VMs per image name, so that creating
+// a VM of that image without overrides returns immediately.
+func WithPool(targets map[string]int) ServeOption {
+	return func(o *serveOptions) {
+		o.pool = targets
+	}
+}
+
+func newPool(targets map[string]int) *pool {
+	return &pool{
+		targets: targets,
+		ready:   make(map[string][]pooledVM),
+		filling: make(map[string]int),
+	}
+}
+
+// startPool starts filling the pool, if one is configured. The caller must
+// hold s.mu.
+func (s *server) startPool() {
+	if s.pool == nil {
+		return
+	}
+
+	s.pool.ctx, s.pool.cancel = context.WithCancel(context.Background())
+	s.fillPool()
+}
+
+// fillPool boots VMs for any pool below its target, as far as capacity
+// allows. The caller must hold s.mu.
+func (s *server) fillPool() {
+	p := s.pool
+	if p == nil || p.ctx == nil || p.ctx.Err() != nil {
+		return
+	}
+
+	for name, target := range p.targets {
+		for len(p.ready[name])+p.filling[name] < target {
+			resources := s.limits.resources(hypervisor.CreateOptions{})
+
+			// the pool is refilled once capacity is released, without keeping
+			// other images' pools from being filled
+			if err := s.admit(resources); err != nil {
+				break
+			}
+
+			p.filling[name]++
+			p.wg.Add(1)
+			go s.fillOne(p.ctx, name, resources)
+		}
+	}
+}
+
+// fillOne boots a VM for the pool.
+func (s *server) fillOne(ctx context.Context, name string, resources Resources) {
+	defer s.pool.wg.Done()
+
+	vm, err := s.boot(ctx, name, hypervisor.CreateOptions{})
+
+	s.mu.Lock()
+	s.pool.filling[name]--
+
+	// the pool was drained while booting
+	if ctx.Err() != nil {
+		s.release(resources)
+		s.mu.Unlock()
+
+		if err == nil {
+			s.deletePooled(pooledVM{vm: vm})
+		}
+		return
+	}
+
+	if err != nil {
+		s.release(resources)
+		s.mu.Unlock()
+
+		slog.Warn("booting pooled vm failed", "name", name, "error", err)
+		time.AfterFunc(poolRetryDelay, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.fillPool()
+		})
+		return
+	}
+
+	s.pool.ready[name] = append(s.pool.ready[name], pooledVM{vm: vm, resources: resources})
+	metrics.PoolReady.WithLabelValues(name).Set(float64(len(s.pool.ready[name])))
+	s.mu.Unlock()
+
+	slog.Info("pooled vm ready", "id", vm.GetId(), "name", name, "addr", vm.GetAddr())
+}
+
+// takePooled removes a pooled VM of the image, if one is ready, and refills
+// the pool. VMs with overrides aren't pooled. The caller must hold s.mu.
+func (s *server) takePooled(name string, opts hypervisor.CreateOptions) (pooledVM, bool) {
+	if s.pool == nil || !reflect.DeepEqual(opts, hypervisor.CreateOptions{}) {
+		return pooledVM{}, false
+	}
+
+	ready := s.pool.ready[name]
+	if len(ready) == 0 {
+		return pooledVM{}, false
+	}
+
+	pooled := ready[0]
+	s.pool.ready[name] = ready[1:]
+	metrics.PoolReady.WithLabelValues(name).Set(float64(len(s.pool.ready[name])))
+
+	s.fillPool()
+
+	return pooled, true
+}
+
+// evictPooled removes a pooled VM, of the image with the most ready, and
+// releases its resources. The caller must hold s.mu, and delete the VM.
+func (s *server) evictPooled() (pooledVM, bool) {
+	if s.pool == nil {
+		return pooledVM{}, false
+	}
+
+	var name string
+	for image, ready := range s.pool.ready {
+		if len(ready) > len(s.pool.ready[name]) {
+			name = image
+		}
+	}
+
+	ready := s.pool.ready[name]
+	if len(ready) == 0 {
+		return pooledVM{}, false
+	}
+
+	evicted := ready[len(ready)-1]
+	s.pool.ready[name] = ready[:len(ready)-1]
+	metrics.PoolReady.WithLabelValues(name).Set(float64(len(s.pool.ready[name])))
+	s.release(evicted.resources)
+
+	return evicted, true
+}
+
+// evictPooledImage removes every pooled VM of the image, and releases their
+// resources. The caller must hold s.mu, and delete the VMs.
+func (s *server) evictPooledImage(name string) []pooledVM {
+	if s.pool == nil {
+		return nil
+	}
+
+	evicted := s.pool.ready[name]
+	for _, pooled := range evicted {
+		s.release(pooled.resources)
+	}
+	delete(s.pool.ready, name)
+	metrics.PoolReady.WithLabelValues(name).Set(0)
+
+	return evicted
+}
+
+// forgetPooled removes a pooled VM the hypervisor no longer has, such as one
+// deleted by id, and releases its resources. The caller must hold s.mu.
+func (s *server) forgetPooled(id string) (pooledVM, bool) {
+	if s.pool == nil {
+		return pooledVM{}, false
+	}
+
+	for name, ready := range s.pool.ready {
+		for i, pooled := range ready {
+			if pooled.vm.GetId() != id {
+				continue
+			}
+
+			s.pool.ready[name] = slices.Delete(ready, i, i+1)
+			metrics.PoolReady.WithLabelValues(name).Set(float64(len(s.pool.ready[name])))
+			s.release(pooled.resources)
+
+			return pooled, true
+		}
+	}
+
+	return pooledVM{}, false
+}
+
+// evictionAdmits reports whether evicting every pooled VM would make enough
+// room to admit the resources. The caller must hold s.mu.
+func (s *server) evictionAdmits(r Resources) bool {
+	if s.pool == nil {
+		return false
+	}
+
+	var pooled Resources
+	for _, ready := range s.pool.ready {
+		for _, vm := range ready {
+			pooled = pooled.add(vm.resources)
+		}
+	}
+	if pooled.VMs == 0 {
+		return false
+	}
+
+	used := s.used
+	defer func() { s.used = used }()
+
+	s.used = s.used.sub(pooled)
+	return s.admit(r) == nil
+}
+
+// pooled reports whether the VM is pooled. The caller must hold s.mu.
+func (s *server) pooled(id string) bool {
+	if s.pool == nil {
+		return false
+	}
+
+	for _, ready := range s.pool.ready {
+		for _, pooled := range ready {
+			if pooled.vm.GetId() == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// drainPool stops filling the pool and deletes every pooled VM, waiting for
+// VMs being booted for it.
+func (s *server) drainPool() {
+	s.mu.Lock()
+	if s.pool == nil || s.pool.ctx == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	s.pool.cancel()
+
+	var drained []pooledVM
+	for name, ready := range s.pool.ready {
+		drained = append(drained, ready...)
+		for _, pooled := range ready {
+			s.release(pooled.resources)
+		}
+		delete(s.pool.ready, name)
+		metrics.PoolReady.WithLabelValues(name).Set(0)
+	}
+	s.mu.Unlock()
+
+	s.pool.wg.Wait()
+
+	for _, pooled := range drained {
+		s.deletePooled(pooled)
+	}
+}
+
+// deletePooled deletes a VM that's no longer pooled. Failures are only logged,
+// as the VM was never handed out to anyone.
+func (s *server) deletePooled(pooled pooledVM) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := s.hv.Delete(ctx, pooled.vm.GetId()); err != nil {
+		slog.Error("deleting pooled vm failed", "id", pooled.vm.GetId(), "name", pooled.vm.GetName(), "error", err)
+	}
+}
+
+func (s *server) Pool(ctx context.Context, _ *proto.PoolRequest) (*proto.PoolResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp proto.PoolResponse
+	for _, stats := range s.poolStats() {
+		resp.Pools = append(resp.Pools, &proto.PoolStats{
+			Name:    stats.Name,
+			Target:  uint32(stats.Target),
+			Ready:   uint32(stats.Ready),
+			Filling: uint32(stats.Filling),
+		})
+	}
+
+	return &resp, nil
+}
+
+// poolStats returns the stats of each pool, sorted by name. The caller must
+// hold s.mu.
+func (s *server) poolStats() []PoolStats {
+	if s.pool == nil {
+		return nil
+	}
+
+	stats := make([]PoolStats, 0, len(s.pool.targets))
+	for name, target := range s.pool.targets {
+		stats = append(stats, PoolStats{
+			Name:    name,
+			Target:  target,
+			Ready:   len(s.pool.ready[name]),
+			Filling: s.pool.filling[name],
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/fake"
+)
+
+func newPoolServer(t *testing.T, targets map[string]int, limits Limits) (*server, *fake.Fake) {
+	hv, err := fake.New(nil)
+	require.NoError(t, err)
+
+	s := newServer(hv)
+	s.pool = newPool(targets)
+	s.limits = limits
+	t.Cleanup(s.drainPool)
+
+	_, err = s.Init(context.TODO(), &proto.InitRequest{})
+	require.NoError(t, err)
+
+	return s, hv
+}
+
+func waitPool(t *testing.T, s *server, want ...PoolStats) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return assert.ObjectsAreEqual(want, s.poolStats())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func hvVMs(t *testing.T, hv hypervisor.Hypervisor) []string {
+	vms, err := hv.List(context.TODO())
+	require.NoError(t, err)
+
+	var ids []string
+	for _, vm := range vms {
+		ids = append(ids, vm.GetId())
+	}
+	return ids
+}
+
+func TestPoolHandsOutAndRefills(t *testing.T) {
+	s, hv := newPoolServer(t, map[string]int{"image": 2, "other": 1}, Limits{})
+
+	waitPool(t, s,
+		PoolStats{Name: "image", Target: 2, Ready: 2},
+		PoolStats{Name: "other", Target: 1, Ready: 1},
+	)
+
+	s.mu.Lock()
+	pooled := s.pool.ready["image"][0].vm.GetId()
+	s.mu.Unlock()
+
+	res, err := s.Create(context.TODO(), &proto.CreateRequest{Name: "image"})
+	require.NoError(t, err)
+	assert.Equal(t, pooled, res.GetVm().GetId())
+
+	waitPool(t, s,
+		PoolStats{Name: "image", Target: 2, Ready: 2},
+		PoolStats{Name: "other", Target: 1, Ready: 1},
+	)
+	assert.Len(t, hvVMs(t, hv), 4)
+
+	// pooled vms aren't listed until they're handed out
+	list, err := s.List(context.TODO(), &proto.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetVms(), 1)
+	assert.Equal(t, pooled, list.GetVms()[0].GetId())
+
+	// vms with overrides aren't pooled
+	res, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Cpus: 2})
+	require.NoError(t, err)
+	s.mu.Lock()
+	assert.False(t, s.pooled(res.GetVm().GetId()))
+	s.mu.Unlock()
+	assert.Len(t, hvVMs(t, hv), 5)
+}
+
+func TestPoolRespectsCapacity(t *testing.T) {
+	s, hv := newPoolServer(t, map[string]int{"image": 3}, Limits{MaxVMs: 2})
+
+	// the pool is only filled as far as capacity allows
+	waitPool(t, s, PoolStats{Name: "image", Target: 3, Ready: 2})
+
+	// a vm that doesn't fit evicts a pooled vm
+	_, err := s.Create(context.TODO(), &proto.CreateRequest{Name: "other"})
+	require.NoError(t, err)
+	waitPool(t, s, PoolStats{Name: "image", Target: 3, Ready: 1})
+	assert.Len(t, hvVMs(t, hv), 2)
+
+	res, err := s.Create(context.TODO(), &proto.CreateRequest{Name: "image"})
+	require.NoError(t, err)
+	waitPool(t, s, PoolStats{Name: "image", Target: 3})
+
+	// with nothing left to evict, the limit applies
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "other"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// deleting a vm makes room for the pool to refill
+	_, err = s.Delete(context.TODO(), &proto.DeleteRequest{Id: res.GetVm().GetId()})
+	require.NoError(t, err)
+	waitPool(t, s, PoolStats{Name: "image", Target: 3, Ready: 1})
+	assert.Len(t, hvVMs(t, hv), 2)
+}
+
+func TestPoolDeletedByID(t *testing.T) {
+	s, hv := newPoolServer(t, map[string]int{"image": 2}, Limits{MaxVMs: 2})
+	waitPool(t, s, PoolStats{Name: "image", Target: 2, Ready: 2})
+
+	s.mu.Lock()
+	pooled := s.pool.ready["image"][0].vm.GetId()
+	s.mu.Unlock()
+
+	// a pooled vm deleted by id is no longer handed out, and its capacity
+	// refills the pool
+	_, err := s.Delete(context.TODO(), &proto.DeleteRequest{Id: pooled})
+	require.NoError(t, err)
+	waitPool(t, s, PoolStats{Name: "image", Target: 2, Ready: 2})
+
+	s.mu.Lock()
+	assert.False(t, s.pooled(pooled))
+	assert.Equal(t, Resources{VMs: 2}, s.used)
+	s.mu.Unlock()
+
+	assert.Len(t, hvVMs(t, hv), 2)
+	assert.NotContains(t, hvVMs(t, hv), pooled)
+}
+
+func TestPoolDrainedOnShutdown(t *testing.T) {
+	s, hv := newPoolServer(t, map[string]int{"image": 2}, Limits{})
+	waitPool(t, s, PoolStats{Name: "image", Target: 2, Ready: 2})
+
+	// vms still booting for the pool are deleted too
+	require.NoError(t, hv.Init(context.TODO(), []byte(`{"boot_latency": "500ms"}`)))
+	res, err := s.Create(context.TODO(), &proto.CreateRequest{Name: "image"})
+	require.NoError(t, err)
+	waitPool(t, s, PoolStats{Name: "image", Target: 2, Ready: 1, Filling: 1})
+
+	_, err = s.Shutdown(context.TODO(), &proto.ShutdownRequest{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{res.GetVm().GetId()}, hvVMs(t, hv))
+	assert.Equal(t, Resources{VMs: 1}, s.used)
+}
+
+func TestPoolStats(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t, WithPool(map[string]int{"image": 1}))
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, nil) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		stats, err := client.Pool(ctx)
+		require.NoError(t, err)
+		return assert.ObjectsAreEqual([]PoolStats{{Name: "image", Target: 1, Ready: 1}}, stats)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vms, err := client.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
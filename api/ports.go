@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// checkPorts fails if the hypervisor can't forward the ports the options
+// request, before any slot is cleared or capacity admitted.
+func (s *server) checkPorts(ctx context.Context, opts hypervisor.CreateOptions) error {
+	if len(opts.Ports) == 0 {
+		return nil
+	}
+
+	for _, port := range opts.Ports {
+		if port.Port == 0 {
+			return status.Error(codes.InvalidArgument, "invalid port 0")
+		}
+		switch port.Protocol {
+		case "", hypervisor.ProtocolTCP, hypervisor.ProtocolUDP:
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid protocol %q for port %d", port.Protocol, port.Port)
+		}
+	}
+
+	caps, err := s.hv.Capabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching capabilities: %w", err)
+	}
+	if !caps.Has(hypervisor.FeaturePortForwards) {
+		return status.Error(codes.Unimplemented, "hypervisor doesn't support port forwards")
+	}
+
+	return nil
+}
+
+func portsToProto(ports []hypervisor.PortForward) []*proto.PortForward {
+	var pports []*proto.PortForward
+	for _, port := range ports {
+		pports = append(pports, &proto.PortForward{
+			Port:     uint32(port.Port),
+			Protocol: port.Protocol,
+			Purpose:  port.Purpose,
+		})
+	}
+
+	return pports
+}
+
+func portsFromProto(pports []*proto.PortForward) ([]hypervisor.PortForward, error) {
+	var ports []hypervisor.PortForward
+	for _, port := range pports {
+		if port.GetPort() > math.MaxUint16 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid port %d", port.GetPort())
+		}
+
+		ports = append(ports, hypervisor.PortForward{
+			Port:     uint16(port.GetPort()),
+			Protocol: port.GetProtocol(),
+			Purpose:  port.GetPurpose(),
+		})
+	}
+
+	return ports, nil
+}
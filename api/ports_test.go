@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestCreatePorts(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vm, _, err := client.Create(ctx, "image", nil, WithPorts(
+		hypervisor.PortForward{Port: 5986, Purpose: hypervisor.PurposeWinRM},
+		hypervisor.PortForward{Port: 8080, Protocol: hypervisor.ProtocolUDP},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Endpoint{
+		{Host: vm.GetAddr(), Port: 22, GuestPort: 22, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeSSH},
+		{Host: vm.GetAddr(), Port: 5986, GuestPort: 5986, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeWinRM},
+		{Host: vm.GetAddr(), Port: 8080, GuestPort: 8080, Protocol: hypervisor.ProtocolUDP},
+	}, hypervisor.Endpoints(vm))
+
+	vms, err := client.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	assert.Equal(t, hypervisor.Endpoints(vm), hypervisor.Endpoints(vms[0]))
+
+	for _, port := range []hypervisor.PortForward{{Port: 0}, {Port: 80, Protocol: "sctp"}} {
+		_, _, err = client.Create(ctx, "image", nil, WithPorts(port))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), port)
+	}
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestCreatePortsUnimplemented(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	m.EXPECT().Capabilities(context.TODO()).Return(hypervisor.Capabilities{}, nil).Once()
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Ports: []*proto.PortForward{{Port: 3389}}})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Ports: []*proto.PortForward{{Port: 1 << 16}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
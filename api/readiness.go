@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+const (
+	// readinessInterval is the delay between failed readiness checks.
+	readinessInterval = time.Second
+
+	// readinessAttemptTimeout bounds a single readiness check, so that a
+	// guest accepting connections but never responding is retried.
+	readinessAttemptTimeout = 5 * time.Second
+)
+
+// ProbeKind is how a Probe checks a VM.
+type ProbeKind string
+
+const (
+	// ProbeTCP checks that a TCP connection can be established.
+	ProbeTCP ProbeKind = "tcp"
+
+	// ProbeSSH checks that an SSH server sends its banner.
+	ProbeSSH ProbeKind = "ssh"
+
+	// ProbeHTTP checks that an HTTP GET responds with a 2xx status.
+	ProbeHTTP ProbeKind = "http"
+)
+
+// Probe checks whether a VM is ready to be used, against its address.
+type Probe struct {
+	Kind ProbeKind
+
+	// Port is the guest port checked, reached through the VM's endpoint
+	// forwarding it if there's one. If zero, the default for the kind is
+	// used, except that tcp and ssh probes check the VM's address as is when
+	// it has a port, as it's forwarded to the guest's SSH port.
+	Port int
+
+	// Path is the path requested by ProbeHTTP.
+	Path string
+}
+
+// ParseProbe parses a probe from a URL whose host is empty, as it's the VM's
+// address, such as "ssh", "tcp://:22" or "http://:8080/healthz".
+func ParseProbe(s string) (Probe, error) {
+	if !strings.Contains(s, "://") {
+		s += "://"
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return Probe{}, fmt.Errorf("invalid probe %q: %w", s, err)
+	}
+
+	p := Probe{Kind: ProbeKind(u.Scheme), Path: u.Path}
+	if u.Hostname() != "" {
+		return Probe{}, fmt.Errorf("invalid probe %q: host must be empty", s)
+	}
+	if u.Port() != "" {
+		if p.Port, err = strconv.Atoi(u.Port()); err != nil {
+			return Probe{}, fmt.Errorf("invalid probe %q: %w", s, err)
+		}
+	}
+
+	switch p.Kind {
+	case ProbeTCP, ProbeSSH:
+		if p.Path != "" {
+			return Probe{}, fmt.Errorf("invalid probe %q: only http probes have a path", s)
+		}
+	case ProbeHTTP:
+	default:
+		return Probe{}, fmt.Errorf("invalid probe %q: unknown kind %q", s, p.Kind)
+	}
+
+	return p, nil
+}
+
+// WithReadiness makes Create wait for the probe to succeed against a new VM
+// before returning. If it doesn't within the timeout, the VM is deleted and
+// Create fails.
+func WithReadiness(probe Probe, timeout time.Duration) ServeOption {
+	return func(o *serveOptions) {
+		o.readiness = &probe
+		o.readinessTimeout = timeout
+	}
+}
+
+// target returns the address to check on the VM. Hypervisors whose addresses
+// are host ports can only reach the guest ports they forward.
+func (p Probe) target(vm hypervisor.VirtualMachine, format hypervisor.AddressFormat) (string, error) {
+	addr := vm.GetAddr()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+
+	guestPort := p.Port
+	switch {
+	case guestPort != 0:
+	case p.Kind == ProbeHTTP:
+		guestPort = 80
+	case port != "":
+		return addr, nil
+	case p.Kind == ProbeSSH:
+		guestPort = 22
+	default:
+		return "", fmt.Errorf("%s probe requires a port", p.Kind)
+	}
+
+	for _, e := range hypervisor.Endpoints(vm) {
+		if int(e.GuestPort) == guestPort && e.Protocol == hypervisor.ProtocolTCP {
+			return e.String(), nil
+		}
+	}
+
+	if format == hypervisor.AddressHostPort {
+		return "", fmt.Errorf("guest port %d isn't forwarded", guestPort)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(guestPort)), nil
+}
+
+// check runs the probe once against the target.
+func (p Probe) check(ctx context.Context, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessAttemptTimeout)
+	defer cancel()
+
+	if p.Kind == ProbeHTTP {
+		return checkHTTP(ctx, "http://"+target+p.Path)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if p.Kind != ProbeSSH {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	// servers may send other lines before the version identification
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "SSH-") {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading ssh banner: %w", err)
+	}
+
+	return fmt.Errorf("no ssh banner")
+}
+
+func checkHTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// wait runs the probe until it succeeds, or the timeout elapses.
+func (p Probe) wait(ctx context.Context, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := p.check(ctx, target)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(readinessInterval):
+		}
+	}
+}
+
+// waitReady waits for a newly created VM to become ready, if a readiness probe
+// is configured. A VM that doesn't is deleted.
+func (s *server) waitReady(ctx context.Context, vm hypervisor.VirtualMachine) error {
+	if s.readiness == nil {
+		return nil
+	}
+
+	err := s.readinessCheck(ctx, vm)
+	if err == nil {
+		return nil
+	}
+
+	// the request's context may be what was cancelled
+	if err := s.hv.Delete(context.WithoutCancel(ctx), vm.GetId()); err != nil {
+		slog.Error("deleting vm that never became ready failed", "id", vm.GetId(), "name", vm.GetName(), "error", err)
+	}
+
+	return status.Errorf(codes.Unavailable, "vm (%v) never became ready: %v", vm.GetId(), err)
+}
+
+// readinessCheck resolves the readiness probe's target on the VM and waits
+// for it to succeed.
+func (s *server) readinessCheck(ctx context.Context, vm hypervisor.VirtualMachine) error {
+	caps, err := s.hv.Capabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching capabilities: %w", err)
+	}
+
+	target, err := s.readiness.target(vm, caps.AddressFormat)
+	if err != nil {
+		return err
+	}
+
+	return s.readiness.wait(ctx, target, s.readinessTimeout)
+}
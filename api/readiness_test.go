@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestParseProbe(t *testing.T) {
+	testCases := map[string]struct {
+		probe Probe
+		err   bool
+	}{
+		"ssh":                  {probe: Probe{Kind: ProbeSSH}},
+		"ssh://:2222":          {probe: Probe{Kind: ProbeSSH, Port: 2222}},
+		"tcp://:22":            {probe: Probe{Kind: ProbeTCP, Port: 22}},
+		"http://:8080/healthz": {probe: Probe{Kind: ProbeHTTP, Port: 8080, Path: "/healthz"}},
+		"http":                 {probe: Probe{Kind: ProbeHTTP}},
+		"tcp://host:22":        {err: true},
+		"tcp://:22/path":       {err: true},
+		"tcp://:port":          {err: true},
+		"udp://:53":            {err: true},
+	}
+
+	for s, tc := range testCases {
+		t.Run(s, func(t *testing.T) {
+			probe, err := ParseProbe(s)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.probe, probe)
+		})
+	}
+}
+
+func TestProbeTarget(t *testing.T) {
+	ip := func(addr string) hypervisor.VirtualMachineInfo {
+		return hypervisor.VirtualMachineInfo{Addr: addr, Endpoints: hypervisor.SSHEndpoints(addr)}
+	}
+
+	// a host port vm, forwarding the guest's ports 22 and 8080
+	forwarded := hypervisor.VirtualMachineInfo{Addr: "127.0.0.1:2222", Endpoints: append(
+		hypervisor.SSHEndpoints("127.0.0.1:2222"),
+		hypervisor.Endpoint{Host: "127.0.0.1", Port: 50000, GuestPort: 8080, Protocol: hypervisor.ProtocolTCP},
+	)}
+
+	testCases := []struct {
+		probe  Probe
+		vm     hypervisor.VirtualMachineInfo
+		format hypervisor.AddressFormat
+		target string
+		err    bool
+	}{
+		{probe: Probe{Kind: ProbeSSH}, vm: ip("10.0.0.2"), format: hypervisor.AddressIP, target: "10.0.0.2:22"},
+		{probe: Probe{Kind: ProbeHTTP}, vm: ip("10.0.0.2"), format: hypervisor.AddressIP, target: "10.0.0.2:80"},
+		{probe: Probe{Kind: ProbeTCP, Port: 5000}, vm: ip("10.0.0.2"), format: hypervisor.AddressIP, target: "10.0.0.2:5000"},
+		{probe: Probe{Kind: ProbeTCP}, vm: ip("10.0.0.2"), format: hypervisor.AddressIP, err: true},
+		{probe: Probe{Kind: ProbeSSH}, vm: forwarded, format: hypervisor.AddressHostPort, target: "127.0.0.1:2222"},
+		{probe: Probe{Kind: ProbeTCP}, vm: forwarded, format: hypervisor.AddressHostPort, target: "127.0.0.1:2222"},
+		{probe: Probe{Kind: ProbeSSH, Port: 22}, vm: forwarded, format: hypervisor.AddressHostPort, target: "127.0.0.1:2222"},
+		{probe: Probe{Kind: ProbeTCP, Port: 22}, vm: forwarded, format: hypervisor.AddressHostPort, target: "127.0.0.1:2222"},
+		{probe: Probe{Kind: ProbeHTTP, Port: 8080}, vm: forwarded, format: hypervisor.AddressHostPort, target: "127.0.0.1:50000"},
+		{probe: Probe{Kind: ProbeHTTP}, vm: forwarded, format: hypervisor.AddressHostPort, err: true},
+		{probe: Probe{Kind: ProbeTCP, Port: 5000}, vm: forwarded, format: hypervisor.AddressHostPort, err: true},
+	}
+
+	for _, tc := range testCases {
+		target, err := tc.probe.target(tc.vm, tc.format)
+		if tc.err {
+			assert.Error(t, err)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, tc.target, target)
+	}
+}
+
+func TestProbeCheck(t *testing.T) {
+	listen := func(t *testing.T, serve func(net.Conn)) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				serve(conn)
+				conn.Close()
+			}
+		}()
+
+		return l.Addr().String()
+	}
+
+	closed := func(t *testing.T) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+
+		return l.Addr().String()
+	}
+
+	t.Run("tcp", func(t *testing.T) {
+		probe := Probe{Kind: ProbeTCP}
+		assert.NoError(t, probe.check(context.Background(), listen(t, func(net.Conn) {})))
+		assert.Error(t, probe.check(context.Background(), closed(t)))
+	})
+
+	t.Run("ssh", func(t *testing.T) {
+		probe := Probe{Kind: ProbeSSH}
+
+		addr := listen(t, func(conn net.Conn) {
+			conn.Write([]byte("welcome\r\nSSH-2.0-OpenSSH_9.0\r\n"))
+		})
+		assert.NoError(t, probe.check(context.Background(), addr))
+
+		addr = listen(t, func(conn net.Conn) {
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
+		})
+		assert.Error(t, probe.check(context.Background(), addr))
+	})
+
+	t.Run("http", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/healthz" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+
+		addr := srv.Listener.Addr().String()
+		assert.NoError(t, Probe{Kind: ProbeHTTP, Path: "/healthz"}.check(context.Background(), addr))
+		assert.Error(t, Probe{Kind: ProbeHTTP, Path: "/"}.check(context.Background(), addr))
+	})
+}
+
+func TestCreateWaitsForReadiness(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+	s.readiness = &Probe{Kind: ProbeTCP, Port: port}
+	s.readinessTimeout = 5 * time.Second
+
+	hvInit([]byte{}, nil)(m)
+	_, err = s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	hvCapabilities(hypervisor.AddressIP)(m)
+
+	// the port only starts listening after a few checks
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "127.0.0.1"}, nil)(m)
+	go func() {
+		time.Sleep(1500 * time.Millisecond)
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { l.Close() })
+	}()
+
+	start := time.Now()
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestCreateNeverReady(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+	s.readiness = &Probe{Kind: ProbeTCP}
+	s.readinessTimeout = 100 * time.Millisecond
+	s.limits = Limits{MaxVMs: 1}
+
+	hvInit([]byte{}, nil)(m)
+	_, err = s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	hvCapabilities(hypervisor.AddressIP)(m)
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: addr}, nil)(m)
+	m.EXPECT().Delete(mock.Anything, "id-1").Return(nil).Once()
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// the vm isn't tracked and its capacity is released
+	assert.Empty(t, s.vms)
+	assert.Equal(t, Resources{}, s.used)
+}
+
+// TestCreateReadinessHostPort checks that a host port vm's guest ports are
+// probed through the ports forwarding them, and that guest ports that aren't
+// forwarded are never ready.
+func TestCreateReadinessHostPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+	s.readiness = &Probe{Kind: ProbeTCP, Port: 8080}
+	s.readinessTimeout = 100 * time.Millisecond
+
+	hvInit([]byte{}, nil)(m)
+	_, err = s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	// the vm's address is a port nothing listens on, forwarded to the guest's
+	// ssh port, so only the 8080 forward is ready
+	vm := hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "127.0.0.1:1", Endpoints: append(
+		hypervisor.SSHEndpoints("127.0.0.1:1"),
+		hypervisor.Endpoint{Host: "127.0.0.1", Port: uint16(l.Addr().(*net.TCPAddr).Port), GuestPort: 8080, Protocol: hypervisor.ProtocolTCP},
+	)}
+
+	hvCapabilities(hypervisor.AddressHostPort)(m)
+	hvCreate("name-1", vm, nil)(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+
+	s.readiness = &Probe{Kind: ProbeTCP, Port: 9000}
+
+	hvCapabilities(hypervisor.AddressHostPort)(m)
+	hvCreate("name-1", vm, nil)(m)
+	m.EXPECT().Delete(mock.Anything, "id-1").Return(nil).Once()
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorContains(t, err, "guest port 9000 isn't forwarded")
+}
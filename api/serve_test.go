@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/fake"
+)
+
+// serve starts a server with the fake hypervisor and returns a connected
+// client. The server is stopped by calling cancel, after which its result is
+// available on the returned channel.
+func serve(t *testing.T, opts ...ServeOption) (Client, context.Context, context.CancelFunc, <-chan error) {
+	// unix socket paths have a short max length, so we avoid t.TempDir()
+	dir, err := os.MkdirTemp("", "nesting")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	t.Setenv("NESTING_SOCKET", filepath.Join(dir, "nesting.sock"))
+
+	hv, err := fake.New(nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Serve(ctx, hv, opts...)
+	}()
+
+	conn, err := DefaultConn()
+	require.NoError(t, err)
+
+	client := New(conn)
+	t.Cleanup(func() { client.Close() })
+
+	return client, ctx, cancel, errCh
+}
+
+func TestServe(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"max_vms": 1}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	slot := int32(0)
+	vm1, stompedVmId, err := client.Create(ctx, "image", &slot)
+	require.NoError(t, err)
+	assert.Nil(t, stompedVmId)
+	assert.Equal(t, "image", vm1.GetName())
+
+	// the fake only has capacity for one vm, so this only works because the
+	// slot is stomped
+	vm2, stompedVmId, err := client.Create(ctx, "image", &slot)
+	require.NoError(t, err)
+	require.NotNil(t, stompedVmId)
+	assert.Equal(t, vm1.GetId(), *stompedVmId)
+
+	_, _, err = client.Create(ctx, "image", nil)
+	assert.Error(t, err)
+
+	vms, err := client.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	assert.Equal(t, vm2.GetId(), vms[0].GetId())
+
+	err = client.Delete(ctx, vm2.GetId())
+	require.NoError(t, err)
+	require.NoError(t, client.Shutdown(ctx))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestWatch(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"images": ["image"]}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	events := make(chan hypervisor.Event, 16)
+	watchErr := make(chan error, 1)
+	go func() {
+		// not using the server's context, so that we know the watch ends
+		// because the server stops
+		watchErr <- client.Watch(context.Background(), func(ev hypervisor.Event) error {
+			events <- ev
+			return nil
+		})
+	}()
+
+	// the watch stream is established asynchronously, so keep creating vms
+	// until the first event arrives
+	var vm hypervisor.VirtualMachine
+	var first hypervisor.Event
+	require.Eventually(t, func() bool {
+		var err error
+		vm, _, err = client.Create(ctx, "image", nil)
+		require.NoError(t, err)
+
+		select {
+		case first = <-events:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, hypervisor.EventCreated, first.Type)
+	assert.Equal(t, "image", first.Name)
+	assert.False(t, first.Time.IsZero())
+
+	next := func() hypervisor.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return hypervisor.Event{}
+		}
+	}
+
+	// drain any events from creates that happened before the first was seen
+	ev := next()
+	for ev.Id != vm.GetId() || ev.Type != hypervisor.EventRunning {
+		ev = next()
+	}
+
+	err := client.Delete(ctx, vm.GetId())
+	require.NoError(t, err)
+	ev = next()
+	assert.Equal(t, hypervisor.EventDeleted, ev.Type)
+	assert.Equal(t, vm.GetId(), ev.Id)
+
+	_, _, err = client.Create(ctx, "unknown", nil)
+	require.Error(t, err)
+	ev = next()
+	assert.Equal(t, hypervisor.EventErrored, ev.Type)
+	assert.Equal(t, "unknown", ev.Name)
+	assert.NotEmpty(t, ev.Reason)
+
+	// stopping the server ends the watch cleanly
+	cancel()
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-watchErr)
+}
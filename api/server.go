@@ -2,20 +2,28 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
 )
 
 var (
@@ -23,15 +31,94 @@ var (
 	ErrNotInitialized     = status.Error(codes.FailedPrecondition, "not initialized")
 )
 
+// ViolationImageVerification is the type of the PreconditionFailure violation
+// detailing a Create refused because the image failed verification.
+const ViolationImageVerification = "IMAGE_VERIFICATION"
+
 type server struct {
 	hv     hypervisor.Hypervisor
+	hvName string
 	mu     sync.Mutex
 	inited bool
 	slots  map[int32]string
+	vms    map[string]hypervisor.VirtualMachineInfo
+	events broker
+	store  *store
+
+	limits Limits
+	used   Resources
+	usage  map[string]Resources
+
+	readiness        *Probe
+	readinessTimeout time.Duration
+
+	pool *pool
+
+	// uploads are the images being uploaded
+	uploads map[string]bool
 
 	proto.UnimplementedNestingServer
 }
 
+func newServer(hv hypervisor.Hypervisor) *server {
+	return &server{
+		hv:      hv,
+		hvName:  hypervisorName(hv),
+		slots:   make(map[int32]string),
+		vms:     make(map[string]hypervisor.VirtualMachineInfo),
+		usage:   make(map[string]Resources),
+		uploads: make(map[string]bool),
+	}
+}
+
+type ServeOption func(*serveOptions)
+
+type serveOptions struct {
+	statePath string
+	policy    ReconcilePolicy
+
+	tcpAddr   string
+	tlsConfig *tls.Config
+
+	tokens Tokens
+	limits Limits
+
+	metricsAddr string
+
+	readiness        *Probe
+	readinessTimeout time.Duration
+
+	pool map[string]int
+}
+
+// WithState persists slot assignments and the VM inventory to a state file,
+// so that they survive a restart. On startup, the state is reconciled against
+// the hypervisor according to the policy.
+func WithState(path string, policy ReconcilePolicy) ServeOption {
+	return func(o *serveOptions) {
+		o.statePath = path
+		o.policy = policy
+	}
+}
+
+// WithTCPListener additionally listens on a TCP address for remote clients.
+// The TLS config must require and verify client certificates, such as the one
+// returned by ServerTLSConfig.
+func WithTCPListener(addr string, tlsConfig *tls.Config) ServeOption {
+	return func(o *serveOptions) {
+		o.tcpAddr = addr
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithTokens requires clients to present one of the bearer tokens, and
+// restricts the RPCs they can call to those permitted by the token's role.
+func WithTokens(tokens Tokens) ServeOption {
+	return func(o *serveOptions) {
+		o.tokens = tokens
+	}
+}
+
 func (s *server) Init(ctx context.Context, req *proto.InitRequest) (*proto.InitResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -43,12 +130,21 @@ func (s *server) Init(ctx context.Context, req *proto.InitRequest) (*proto.InitR
 	err := s.hv.Init(ctx, req.Config)
 	if err == nil {
 		s.inited = true
+		slog.Info("hypervisor initialized", "hypervisor", s.hvName)
+		s.startPool()
 	}
 
 	return &proto.InitResponse{}, err
 }
 
 func (s *server) Shutdown(ctx context.Context, _ *proto.ShutdownRequest) (*proto.ShutdownResponse, error) {
+	if !s.initialized() {
+		return nil, ErrAlreadyInitialized
+	}
+
+	// pooled vms are deleted while the hypervisor is still initialized
+	s.drainPool()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -59,6 +155,7 @@ func (s *server) Shutdown(ctx context.Context, _ *proto.ShutdownRequest) (*proto
 	err := s.hv.Shutdown(ctx)
 	if err == nil {
 		s.inited = false
+		slog.Info("hypervisor shutdown", "hypervisor", s.hvName)
 	}
 
 	return &proto.ShutdownResponse{}, err
@@ -69,6 +166,25 @@ func (s *server) Create(ctx context.Context, req *proto.CreateRequest) (*proto.C
 		return nil, ErrNotInitialized
 	}
 
+	ports, err := portsFromProto(req.GetPorts())
+	if err != nil {
+		return nil, err
+	}
+
+	opts := hypervisor.CreateOptions{
+		CPUs:          req.GetCpus(),
+		MemoryBytes:   req.GetMemoryBytes(),
+		DiskSizeBytes: req.GetDiskSizeBytes(),
+		Snapshot:      req.GetSnapshot(),
+		Ports:         ports,
+	}
+	if err := s.checkSnapshot(ctx, opts); err != nil {
+		return nil, err
+	}
+	if err := s.checkPorts(ctx, opts); err != nil {
+		return nil, err
+	}
+
 	slotsInUse := req.Slot != nil
 	var stompedVmId *string
 	if slotsInUse {
@@ -79,48 +195,198 @@ func (s *server) Create(ctx context.Context, req *proto.CreateRequest) (*proto.C
 		stompedVmId = id
 	}
 
-	vm, err := s.hv.Create(ctx, req.Name)
-	if err != nil {
-		return nil, err
+	start := time.Now()
+
+	s.mu.Lock()
+	pooled, fromPool := s.takePooled(req.Name, opts)
+	s.mu.Unlock()
+
+	vm, resources := pooled.vm, pooled.resources
+	if !fromPool {
+		var err error
+		if vm, resources, err = s.create(ctx, req.Name, opts); err != nil {
+			return nil, err
+		}
 	}
 
+	// Create only returns once the vm is running
+	now := time.Now()
+	s.events.publish(hypervisor.Event{Type: hypervisor.EventCreated, Id: vm.GetId(), Name: vm.GetName(), Time: now})
+	s.events.publish(hypervisor.Event{Type: hypervisor.EventRunning, Id: vm.GetId(), Name: vm.GetName(), Time: now})
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if slotsInUse {
 		s.slots[*req.Slot] = vm.GetId()
 	}
+	s.vms[vm.GetId()] = hypervisor.VirtualMachineInfo{
+		Id:        vm.GetId(),
+		Name:      vm.GetName(),
+		Addr:      vm.GetAddr(),
+		Endpoints: hypervisor.Endpoints(vm),
+	}
+	s.usage[vm.GetId()] = resources
+	s.persist()
+	metrics.VMsRunning.Set(float64(len(s.vms)))
+
+	attrs := []any{"id", vm.GetId(), "name", vm.GetName(), "addr", vm.GetAddr(), "duration", time.Since(start), "pooled", fromPool}
+	if slotsInUse {
+		attrs = append(attrs, "slot", *req.Slot)
+	}
+	if stompedVmId != nil {
+		attrs = append(attrs, "stomped_vm_id", *stompedVmId)
+	}
+	slog.Info("vm created", attrs...)
 
 	return &proto.CreateResponse{
-		Vm: &proto.VirtualMachine{
-			Id:   vm.GetId(),
-			Name: vm.GetName(),
-			Addr: vm.GetAddr(),
-		},
+		Vm:          vmToProto(vm),
 		StompedVmId: stompedVmId,
 	}, nil
 }
 
+// create admits and boots a VM. Pooled VMs are evicted if that makes enough
+// room for it to be admitted.
+func (s *server) create(ctx context.Context, name string, opts hypervisor.CreateOptions) (hypervisor.VirtualMachine, Resources, error) {
+	resources := s.limits.resources(opts)
+
+	var evicted []pooledVM
+
+	s.mu.Lock()
+	err := s.admit(resources)
+	if err != nil && s.evictionAdmits(resources) {
+		for err != nil {
+			pooled, ok := s.evictPooled()
+			if !ok {
+				break
+			}
+			evicted = append(evicted, pooled)
+			err = s.admit(resources)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, pooled := range evicted {
+		s.deletePooled(pooled)
+	}
+
+	if err != nil {
+		slog.Warn("vm not admitted", "name", name, "error", err)
+		return nil, Resources{}, err
+	}
+
+	vm, err := s.boot(ctx, name, opts)
+	if err != nil {
+		s.mu.Lock()
+		s.release(resources)
+		s.fillPool()
+		s.mu.Unlock()
+
+		s.events.publish(hypervisor.Event{Type: hypervisor.EventErrored, Name: name, Time: time.Now(), Reason: err.Error()})
+		if errors.Is(err, hypervisor.ErrInvalidOption) || errors.Is(err, hypervisor.ErrInvalidImageName) {
+			return nil, Resources{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, hypervisor.ErrImageNotFound) || errors.Is(err, hypervisor.ErrSnapshotNotFound) {
+			return nil, Resources{}, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, hypervisor.ErrSnapshotInUse) {
+			return nil, Resources{}, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, hypervisor.ErrImageVerification) {
+			return nil, Resources{}, imageVerificationError(name, err)
+		}
+		return nil, Resources{}, err
+	}
+
+	return vm, resources, nil
+}
+
+// imageVerificationError returns a FailedPrecondition error detailing why the
+// image failed verification, so that clients can tell it apart from other
+// failed preconditions.
+func imageVerificationError(name string, err error) error {
+	st := status.New(codes.FailedPrecondition, err.Error())
+	if detailed, derr := st.WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        ViolationImageVerification,
+			Subject:     name,
+			Description: err.Error(),
+		}},
+	}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// boot creates a VM and waits for it to become ready.
+func (s *server) boot(ctx context.Context, name string, opts hypervisor.CreateOptions) (hypervisor.VirtualMachine, error) {
+	start := time.Now()
+	vm, err := s.hv.Create(ctx, name, opts)
+	if err == nil {
+		err = s.waitReady(ctx, vm)
+	}
+	metrics.VMCreateDuration.WithLabelValues(s.hvName, name, metrics.Result(err)).Observe(metrics.Since(start))
+
+	return vm, err
+}
+
 func (s *server) Delete(ctx context.Context, req *proto.DeleteRequest) (*proto.DeleteResponse, error) {
 	if !s.initialized() {
 		return nil, ErrNotInitialized
 	}
 
-	err := s.hv.Delete(ctx, req.Id)
+	s.mu.Lock()
+	image := s.vms[req.Id].Name
+	s.mu.Unlock()
+
+	start := time.Now()
+	method, err := s.delete(ctx, req.Id, time.Duration(req.GracePeriodSeconds)*time.Second)
+	metrics.VMDeleteDuration.WithLabelValues(s.hvName, image, metrics.Result(err)).Observe(metrics.Since(start))
 	if err != nil {
 		return nil, err
 	}
 
+	s.forget(req.Id)
+
+	slog.Info("vm deleted", "id", req.Id, "name", image, "stop_method", method, "duration", time.Since(start))
+
+	return &proto.DeleteResponse{StopMethod: string(method)}, nil
+}
+
+// delete deletes a VM, giving its guest the grace period to shut down if the
+// hypervisor can ask it to. Otherwise, the VM is forcibly stopped.
+func (s *server) delete(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	if deleter, ok := s.hv.(hypervisor.GracefulDeleter); ok && grace > 0 {
+		return deleter.DeleteGracefully(ctx, id, grace)
+	}
+
+	return hypervisor.StopForced, s.hv.Delete(ctx, id)
+}
+
+// forget removes a VM the hypervisor no longer has, freeing its slot and
+// resources.
+func (s *server) forget(vmID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var name string
+	if vm, ok := s.vms[vmID]; ok {
+		name = vm.Name
+	} else if pooled, ok := s.forgetPooled(vmID); ok {
+		name = pooled.vm.GetName()
+	}
+	s.events.publish(hypervisor.Event{Type: hypervisor.EventDeleted, Id: vmID, Name: name, Time: time.Now()})
+
 	for slot, id := range s.slots {
-		if id == req.Id {
+		if id == vmID {
 			delete(s.slots, slot)
 		}
 	}
-
-	return &proto.DeleteResponse{}, nil
+	delete(s.vms, vmID)
+	s.untrack(vmID)
+	s.persist()
+	metrics.VMsRunning.Set(float64(len(s.vms)))
+	s.fillPool()
 }
 
 func (s *server) List(ctx context.Context, req *proto.ListRequest) (*proto.ListResponse, error) {
@@ -130,18 +396,46 @@ func (s *server) List(ctx context.Context, req *proto.ListRequest) (*proto.ListR
 
 	vms, err := s.hv.List(ctx)
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	var list proto.ListResponse
 	for _, vm := range vms {
-		list.Vms = append(list.Vms, &proto.VirtualMachine{
-			Id:   vm.GetId(),
-			Name: vm.GetName(),
-			Addr: vm.GetAddr(),
-		})
+		if s.pooled(vm.GetId()) {
+			continue
+		}
+
+		list.Vms = append(list.Vms, vmToProto(vm))
 	}
 
 	return &list, err
 }
 
+func (s *server) Watch(_ *proto.WatchRequest, stream proto.Nesting_WatchServer) error {
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+
+		case ev, ok := <-events:
+			if !ok {
+				if s.events.isClosed() {
+					return nil
+				}
+				slog.Warn("watcher fell behind, disconnecting it")
+				return status.Error(codes.ResourceExhausted, "watcher fell behind")
+			}
+
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (s *server) initialized() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -161,11 +455,60 @@ func (s *server) clearSlot(ctx context.Context, slot int32) (*string, error) {
 	if _, err := s.Delete(ctx, &proto.DeleteRequest{Id: id}); err != nil {
 		return nil, fmt.Errorf("clearing slot: %w", err)
 	}
+	metrics.SlotStomps.Inc()
+	slog.Info("slot cleared", "slot", slot, "id", id)
 
 	return &id, nil
 }
 
-func Serve(ctx context.Context, hv hypervisor.Hypervisor) error {
+func Serve(ctx context.Context, hv hypervisor.Hypervisor, opts ...ServeOption) error {
+	var options serveOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.tcpAddr != "" {
+		if options.tlsConfig == nil || options.tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+			return fmt.Errorf("tcp listener requires tls with client certificate verification")
+		}
+	}
+
+	// metrics and logging come first, so that rejected calls are counted and
+	// logged too
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(metricsUnaryInterceptor, loggingUnaryInterceptor),
+		grpc.ChainStreamInterceptor(metricsStreamInterceptor, loggingStreamInterceptor),
+	}
+	if options.tokens != nil {
+		if err := options.tokens.validate(); err != nil {
+			return err
+		}
+
+		serverOpts = append(serverOpts,
+			grpc.ChainUnaryInterceptor(options.tokens.unaryInterceptor),
+			grpc.ChainStreamInterceptor(options.tokens.streamInterceptor),
+		)
+	}
+
+	s := newServer(hv)
+	s.limits = options.limits
+	s.readiness = options.readiness
+	s.readinessTimeout = options.readinessTimeout
+	if len(options.pool) > 0 {
+		s.pool = newPool(options.pool)
+	}
+
+	if options.statePath != "" {
+		if !options.policy.valid() {
+			return fmt.Errorf("invalid reconcile policy %q", options.policy)
+		}
+
+		s.store = &store{path: options.statePath}
+		if err := s.reconcile(ctx, options.policy); err != nil {
+			return fmt.Errorf("reconciling state: %w", err)
+		}
+	}
+
 	socket := socketPath()
 	os.MkdirAll(filepath.Dir(socket), 0777)
 
@@ -176,26 +519,112 @@ func Serve(ctx context.Context, hv hypervisor.Hypervisor) error {
 	defer os.RemoveAll(socket)
 	defer listener.Close()
 
-	srv := grpc.NewServer()
-	proto.RegisterNestingServer(srv, &server{
-		hv:    hv,
-		slots: make(map[int32]string),
-	})
+	servers := []*grpc.Server{grpc.NewServer(serverOpts...)}
+	listeners := []net.Listener{listener}
+
+	// the tcp listener is served by its own grpc server, as transport
+	// credentials apply to every listener of a server and the unix socket
+	// doesn't use tls.
+	if options.tcpAddr != "" {
+		tcpListener, err := net.Listen("tcp", options.tcpAddr)
+		if err != nil {
+			return fmt.Errorf("creating tcp listener: %w", err)
+		}
+		defer tcpListener.Close()
+
+		servers = append(servers, grpc.NewServer(append(serverOpts, grpc.Creds(credentials.NewTLS(options.tlsConfig)))...))
+		listeners = append(listeners, tcpListener)
+	}
+
+	var metricsServer *http.Server
+	var metricsListener net.Listener
+	if options.metricsAddr != "" {
+		metricsListener, err = net.Listen("tcp", options.metricsAddr)
+		if err != nil {
+			return fmt.Errorf("creating metrics listener: %w", err)
+		}
+		defer metricsListener.Close()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	}
+
+	if n, ok := hv.(hypervisor.Notifier); ok {
+		n.Notify(s.events.publish)
+	}
+
+	for _, srv := range servers {
+		proto.RegisterNestingServer(srv, s)
+	}
 
 	// the service being shutdown also calls Shutdown on the hypervisor impl
 	defer func() {
+		s.drainPool()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
-		hv.Shutdown(ctx)
+		if err := hv.Shutdown(ctx); err != nil {
+			slog.Error("shutting down hypervisor failed", "hypervisor", s.hvName, "error", err)
+		}
 	}()
 
-	defer srv.Stop()
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			s.events.close()
+			for _, srv := range servers {
+				srv.GracefulStop()
+			}
+			if metricsServer != nil {
+				metricsServer.Close()
+			}
+		})
+	}
+
+	for _, srv := range servers {
+		defer srv.Stop()
+	}
 	go func() {
 		<-ctx.Done()
-		srv.GracefulStop()
+		slog.Info("shutting down")
+		stop()
 	}()
 
-	return srv.Serve(listener)
+	for _, listener := range listeners {
+		slog.Info("listening", "network", listener.Addr().Network(), "addr", listener.Addr().String())
+	}
+	if metricsListener != nil {
+		slog.Info("serving metrics", "addr", metricsListener.Addr().String())
+	}
+
+	// if any server stops, they all stop
+	var wg errgroup.Group
+	for i := range servers {
+		srv, listener := servers[i], listeners[i]
+		wg.Go(func() error {
+			defer stop()
+
+			// a server stopped before it started serving isn't an error
+			if err := srv.Serve(listener); !errors.Is(err, grpc.ErrServerStopped) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	if metricsServer != nil {
+		wg.Go(func() error {
+			defer stop()
+
+			if err := metricsServer.Serve(metricsListener); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	return wg.Wait()
 }
 
 func socketPath() string {
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	protobuf "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 
@@ -53,7 +57,7 @@ func TestServer(t *testing.T) {
 			expect: []expectation{
 				hvDelete("id-1", nil),
 			},
-			response: &proto.DeleteResponse{},
+			response: &proto.DeleteResponse{StopMethod: string(hypervisor.StopForced)},
 		}, {
 			request: &proto.ListRequest{},
 			expect: []expectation{
@@ -150,7 +154,7 @@ func TestServer(t *testing.T) {
 			expect: []expectation{
 				hvDelete("id-1", nil),
 			},
-			response: &proto.DeleteResponse{},
+			response: &proto.DeleteResponse{StopMethod: string(hypervisor.StopForced)},
 		}, {
 			request: &proto.CreateRequest{Name: "name-2", Slot: int32Ref(0)}, // second vm in slot 0
 			expect: []expectation{
@@ -222,15 +226,54 @@ func TestServer(t *testing.T) {
 				StompedVmId: stringRef("id-1"),
 			},
 		}},
+
+		"resource overrides are passed to the hypervisor": {{
+			request: &proto.InitRequest{Config: []byte{}},
+			expect: []expectation{
+				hvInit([]byte{}, nil),
+			},
+			response: &proto.InitResponse{},
+		}, {
+			request: &proto.CreateRequest{Name: "name-1", Cpus: 4, MemoryBytes: 8 << 30, DiskSizeBytes: 100 << 30},
+			expect: []expectation{
+				hvCreateWithOptions("name-1", hypervisor.CreateOptions{CPUs: 4, MemoryBytes: 8 << 30, DiskSizeBytes: 100 << 30}, hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "1.1.1.1"}, nil),
+			},
+			response: &proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name-1", Id: "id-1", Addr: "1.1.1.1"}},
+		}},
+
+		"endpoints are returned alongside the addr": {{
+			request: &proto.InitRequest{Config: []byte{}},
+			expect: []expectation{
+				hvInit([]byte{}, nil),
+			},
+			response: &proto.InitResponse{},
+		}, {
+			request: &proto.CreateRequest{Name: "name-1"},
+			expect: []expectation{
+				hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "1.1.1.1", Endpoints: []hypervisor.Endpoint{
+					{Host: "1.1.1.1", Port: 22, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeSSH},
+					{Host: "1.1.1.1", Port: 3389, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeRDP},
+				}}, nil),
+			},
+			response: &proto.CreateResponse{Vm: &proto.VirtualMachine{Name: "name-1", Id: "id-1", Addr: "1.1.1.1", Endpoints: []*proto.Endpoint{
+				{Host: "1.1.1.1", Port: 22, Protocol: "tcp", Purpose: "ssh"},
+				{Host: "1.1.1.1", Port: 3389, Protocol: "tcp", Purpose: "rdp"},
+			}}},
+		}, {
+			request: &proto.ListRequest{},
+			expect: []expectation{
+				hvList([]hypervisor.VirtualMachineInfo{{Name: "name-1", Id: "id-1", Addr: "127.0.0.1:2222", Endpoints: hypervisor.SSHEndpoints("127.0.0.1:2222")}}, nil),
+			},
+			response: &proto.ListResponse{Vms: []*proto.VirtualMachine{{Name: "name-1", Id: "id-1", Addr: "127.0.0.1:2222", Endpoints: []*proto.Endpoint{
+				{Host: "127.0.0.1", Port: 2222, GuestPort: 22, Protocol: "tcp", Purpose: "ssh"},
+			}}}},
+		}},
 	}
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
 			m := mocks.NewHypervisor(t)
-			s := server{
-				hv:    m,
-				slots: map[int32]string{},
-			}
+			s := newServer(m)
 			for _, step := range testCase {
 				for _, expect := range step.expect {
 					expect(m)
@@ -276,8 +319,12 @@ func hvInit(config []byte, err error) expectation {
 }
 
 func hvCreate(name string, vm hypervisor.VirtualMachine, err error) expectation {
+	return hvCreateWithOptions(name, hypervisor.CreateOptions{}, vm, err)
+}
+
+func hvCreateWithOptions(name string, opts hypervisor.CreateOptions, vm hypervisor.VirtualMachine, err error) expectation {
 	return func(m *mocks.Hypervisor) {
-		m.EXPECT().Create(context.TODO(), name).Return(vm, err).Once()
+		m.EXPECT().Create(context.TODO(), name, opts).Return(vm, err).Once()
 	}
 }
 
@@ -303,15 +350,101 @@ func hvShutdown(err error) expectation {
 	}
 }
 
-// server.Serve is untested
+func hvCapabilities(format hypervisor.AddressFormat) expectation {
+	return func(m *mocks.Hypervisor) {
+		m.EXPECT().Capabilities(context.TODO()).Return(hypervisor.Capabilities{AddressFormat: format}, nil).Once()
+	}
+}
+
+func TestCreateInvalidOption(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
 
-func TestConcurrentCreateCall(t *testing.T) {
+	hvInit([]byte{}, nil)(m)
+	hvCreateWithOptions("name-1", hypervisor.CreateOptions{MemoryBytes: 1}, nil, fmt.Errorf("%w: memory must be a multiple of 1048576 bytes", hypervisor.ErrInvalidOption))(m)
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1", MemoryBytes: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	hvCreate("../name-1", nil, fmt.Errorf("%w: %q", hypervisor.ErrInvalidImageName, "../name-1"))(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "../name-1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateImageVerification(t *testing.T) {
 	m := mocks.NewHypervisor(t)
-	s := server{
-		hv:    m,
-		slots: make(map[int32]string),
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	hvCreate("name-1", nil, fmt.Errorf("%w: name-1/disk.img: digest mismatch", hypervisor.ErrImageVerification))(m)
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	failure, ok := st.Details()[0].(*errdetails.PreconditionFailure)
+	require.True(t, ok)
+	require.Len(t, failure.GetViolations(), 1)
+	assert.Equal(t, ViolationImageVerification, failure.GetViolations()[0].GetType())
+	assert.Equal(t, "name-1", failure.GetViolations()[0].GetSubject())
+	assert.Equal(t, "image failed verification: name-1/disk.img: digest mismatch", failure.GetViolations()[0].GetDescription())
+}
+
+func TestDeleteGracePeriod(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"shutdown_latency": "10ms"}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for opts, want := range map[DeleteOptions]hypervisor.StopMethod{
+		{}:                             hypervisor.StopForced,
+		{GracePeriod: time.Second}:     hypervisor.StopGraceful,
+		{GracePeriod: time.Nanosecond}: hypervisor.StopGraceful, // rounded up to a second
+	} {
+		vm, _, err := client.Create(ctx, "image", nil)
+		require.NoError(t, err)
+
+		method, err := client.DeleteWithOptions(ctx, vm.GetId(), opts)
+		require.NoError(t, err)
+		assert.Equal(t, want, method, opts)
 	}
 
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestDeleteGracePeriodUnsupported(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1"}, nil)(m)
+	hvDelete("id-1", nil)(m)
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+
+	// the vm is forcibly stopped, as the hypervisor can't ask the guest to
+	// shut down
+	res, err := s.Delete(context.TODO(), &proto.DeleteRequest{Id: "id-1", GracePeriodSeconds: 30})
+	require.NoError(t, err)
+	assert.Equal(t, string(hypervisor.StopForced), res.GetStopMethod())
+}
+
+func TestConcurrentCreateCall(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
 	m.EXPECT().Init(context.TODO(), []byte{}).Return(nil).Once()
 
 	resp, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
@@ -332,7 +465,7 @@ func TestConcurrentCreateCall(t *testing.T) {
 			req := &proto.CreateRequest{Name: fmt.Sprintf("name-%d", id), Slot: slot}
 			vm := hypervisor.VirtualMachineInfo{Name: fmt.Sprintf("name-%d", id), Id: fmt.Sprintf("id-%d", id), Addr: fmt.Sprintf("1.1.1.%d", id)}
 
-			m.EXPECT().Create(context.TODO(), req.Name).Return(vm, err).Once()
+			m.EXPECT().Create(context.TODO(), req.Name, hypervisor.CreateOptions{}).Return(vm, err).Once()
 
 			<-r
 			s.Create(context.TODO(), req)
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// Snapshot saves a VM's state as a snapshot VMs can be restored from. The
+// hypervisor stops the VM, so it's forgotten like a deleted one.
+func (s *server) Snapshot(ctx context.Context, req *proto.SnapshotRequest) (*proto.SnapshotResponse, error) {
+	if !s.initialized() {
+		return nil, ErrNotInitialized
+	}
+
+	snapshotter, err := s.snapshotter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validFileName(req.GetName()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot name %q", req.GetName())
+	}
+
+	s.mu.Lock()
+	vm, ok := s.vms[req.GetId()]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no vm (%v) found", req.GetId())
+	}
+
+	start := time.Now()
+	if err := snapshotter.Snapshot(ctx, req.GetId(), req.GetName()); err != nil {
+		if errors.Is(err, hypervisor.ErrSnapshotExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, err
+	}
+
+	s.forget(req.GetId())
+
+	slog.Info("vm snapshot saved", "id", req.GetId(), "name", vm.Name, "snapshot", req.GetName(), "duration", time.Since(start))
+
+	return &proto.SnapshotResponse{}, nil
+}
+
+// DeleteSnapshot deletes a snapshot. VMs already restored from it are
+// unaffected, unless the hypervisor can't delete it while one is running.
+func (s *server) DeleteSnapshot(ctx context.Context, req *proto.DeleteSnapshotRequest) (*proto.DeleteSnapshotResponse, error) {
+	if !s.initialized() {
+		return nil, ErrNotInitialized
+	}
+
+	snapshotter, err := s.snapshotter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validFileName(req.GetName()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot name %q", req.GetName())
+	}
+
+	if err := snapshotter.DeleteSnapshot(ctx, req.GetName()); err != nil {
+		switch {
+		case errors.Is(err, hypervisor.ErrSnapshotNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, hypervisor.ErrSnapshotInUse):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, err
+	}
+
+	slog.Info("vm snapshot deleted", "snapshot", req.GetName())
+
+	return &proto.DeleteSnapshotResponse{}, nil
+}
+
+// checkSnapshot fails if a VM can't be restored from the snapshot the options
+// name, before any slot is cleared or capacity admitted.
+func (s *server) checkSnapshot(ctx context.Context, opts hypervisor.CreateOptions) error {
+	if opts.Snapshot == "" {
+		return nil
+	}
+
+	if _, err := s.snapshotter(ctx); err != nil {
+		return err
+	}
+
+	if !validFileName(opts.Snapshot) {
+		return status.Errorf(codes.InvalidArgument, "invalid snapshot name %q", opts.Snapshot)
+	}
+
+	if opts.CPUs > 0 || opts.MemoryBytes > 0 || opts.DiskSizeBytes > 0 {
+		return status.Error(codes.InvalidArgument, "a vm restored from a snapshot can't override its resources")
+	}
+
+	return nil
+}
+
+// snapshotter returns the hypervisor's Snapshotter, if it implements it and
+// reports supporting snapshots, as some only do on some versions of their
+// platform.
+func (s *server) snapshotter(ctx context.Context) (hypervisor.Snapshotter, error) {
+	snapshotter, ok := s.hv.(hypervisor.Snapshotter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "hypervisor doesn't support snapshots")
+	}
+
+	caps, err := s.hv.Capabilities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching capabilities: %w", err)
+	}
+	if !caps.Has(hypervisor.FeatureSnapshots) {
+		return nil, status.Error(codes.Unimplemented, "hypervisor doesn't support snapshots")
+	}
+
+	return snapshotter, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestSnapshot(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	slot := int32(1)
+	vm, _, err := client.Create(ctx, "image", &slot)
+	require.NoError(t, err)
+
+	_, _, err = client.Create(ctx, "image", nil, WithSnapshot("warm"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(client.Snapshot(ctx, vm.GetId(), "../warm")))
+	assert.Equal(t, codes.NotFound, status.Code(client.Snapshot(ctx, "unknown", "warm")))
+
+	// the vm no longer exists once its snapshot is saved
+	require.NoError(t, client.Snapshot(ctx, vm.GetId(), "warm"))
+
+	vms, err := client.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	restored, stomped, err := client.Create(ctx, "image", &slot, WithSnapshot("warm"))
+	require.NoError(t, err)
+	assert.Equal(t, "image", restored.GetName())
+	assert.Nil(t, stomped)
+
+	assert.Equal(t, codes.AlreadyExists, status.Code(client.Snapshot(ctx, restored.GetId(), "warm")))
+
+	_, _, err = client.Create(ctx, "image", nil, WithSnapshot("warm"), WithCPUs(2))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// vms already restored from a deleted snapshot are unaffected
+	assert.Equal(t, codes.InvalidArgument, status.Code(client.DeleteSnapshot(ctx, "../warm")))
+	require.NoError(t, client.DeleteSnapshot(ctx, "warm"))
+	assert.Equal(t, codes.NotFound, status.Code(client.DeleteSnapshot(ctx, "warm")))
+
+	_, _, err = client.Create(ctx, "image", nil, WithSnapshot("warm"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	vms, err = client.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, vms, 1)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestSnapshotUnimplemented(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.Snapshot(context.TODO(), &proto.SnapshotRequest{Id: "id", Name: "warm"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Snapshot: "warm"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = s.DeleteSnapshot(context.TODO(), &proto.DeleteSnapshotRequest{Name: "warm"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// snapshotHypervisor implements Snapshotter, whether or not its capabilities
+// report supporting snapshots.
+type snapshotHypervisor struct {
+	*mocks.Hypervisor
+}
+
+func (snapshotHypervisor) Snapshot(context.Context, string, string) error {
+	return nil
+}
+
+func (snapshotHypervisor) DeleteSnapshot(_ context.Context, snapshot string) error {
+	return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotInUse, snapshot)
+}
+
+func TestSnapshotUnsupportedVersion(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(snapshotHypervisor{m})
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	// such as the Virtualization framework before macOS 14
+	hvCapabilities(hypervisor.AddressHostPort)(m)
+	_, err = s.Snapshot(context.TODO(), &proto.SnapshotRequest{Id: "id", Name: "warm"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	hvCapabilities(hypervisor.AddressHostPort)(m)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Snapshot: "warm"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestSnapshotInUse(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(snapshotHypervisor{m})
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	// such as Parallels, whose restored vms reuse the snapshot's mac address
+	m.EXPECT().Capabilities(context.TODO()).Return(hypervisor.Capabilities{Features: []hypervisor.Feature{hypervisor.FeatureSnapshots}}, nil)
+	hvCreateWithOptions("image", hypervisor.CreateOptions{Snapshot: "warm"}, nil, fmt.Errorf("%w: warm", hypervisor.ErrSnapshotInUse))(m)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "image", Snapshot: "warm"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = s.DeleteSnapshot(context.TODO(), &proto.DeleteSnapshotRequest{Name: "warm"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
+)
+
+// ReconcilePolicy determines what happens on startup to VMs that survived a
+// restart of the daemon.
+type ReconcilePolicy string
+
+const (
+	// ReconcileAdopt keeps VMs that still exist, along with their slot
+	// assignments. VMs that the hypervisor knows about but that aren't in the
+	// state file are adopted without a slot.
+	ReconcileAdopt ReconcilePolicy = "adopt"
+
+	// ReconcileRemove deletes every VM the hypervisor knows about.
+	ReconcileRemove ReconcilePolicy = "remove"
+)
+
+func (p ReconcilePolicy) valid() bool {
+	return p == ReconcileAdopt || p == ReconcileRemove
+}
+
+// StatePath returns the default state file path, which is next to the socket.
+func StatePath() string {
+	return filepath.Join(filepath.Dir(socketPath()), "nesting.state.json")
+}
+
+type state struct {
+	VMs []stateVM `json:"vms"`
+}
+
+type stateVM struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+	Slot *int32 `json:"slot,omitempty"`
+
+	Endpoints []hypervisor.Endpoint `json:"endpoints,omitempty"`
+
+	// resources the vm is accounted as using
+	CPUs        uint32 `json:"cpus,omitempty"`
+	MemoryBytes uint64 `json:"memory_bytes,omitempty"`
+}
+
+// store persists the server's slot assignments and VM inventory.
+type store struct {
+	path string
+}
+
+func (st *store) load() (state, error) {
+	var s state
+
+	buf, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading state: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return s, fmt.Errorf("unmarshaling state: %w", err)
+	}
+
+	return s, nil
+}
+
+// save atomically replaces the state file.
+func (st *store) save(s state) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o777); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(st.path), filepath.Base(st.path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating state: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), st.path); err != nil {
+		return fmt.Errorf("replacing state: %w", err)
+	}
+
+	return nil
+}
+
+// snapshot returns the server's current state. The caller must hold s.mu.
+func (s *server) snapshot() state {
+	slots := make(map[string]int32, len(s.slots))
+	for slot, id := range s.slots {
+		slots[id] = slot
+	}
+
+	st := state{VMs: make([]stateVM, 0, len(s.vms))}
+	for _, vm := range s.vms {
+		svm := stateVM{
+			Id:        vm.Id,
+			Name:      vm.Name,
+			Addr:      vm.Addr,
+			Endpoints: vm.Endpoints,
+		}
+		if slot, ok := slots[vm.Id]; ok {
+			svm.Slot = &slot
+		}
+		if usage, ok := s.usage[vm.Id]; ok {
+			svm.CPUs = usage.CPUs
+			svm.MemoryBytes = usage.MemoryBytes
+		}
+
+		st.VMs = append(st.VMs, svm)
+	}
+
+	sort.Slice(st.VMs, func(i, j int) bool {
+		return st.VMs[i].Id < st.VMs[j].Id
+	})
+
+	return st
+}
+
+// persist saves the server's current state, if a store is configured. The
+// caller must hold s.mu.
+//
+// Persisting is best-effort: the VM operation that preceded it has already
+// happened, and failing the request would only cause the client to lose track
+// of it too.
+func (s *server) persist() {
+	if s.store == nil {
+		return
+	}
+
+	if err := s.store.save(s.snapshot()); err != nil {
+		slog.Warn("persisting state failed", "path", s.store.path, "error", err)
+	}
+}
+
+// reconcile restores the server's state from the store and reconciles it
+// against the VMs the hypervisor reports.
+//
+// Records for VMs that no longer exist are dropped. VMs that do exist are
+// either adopted or deleted depending on the policy. If deleting a VM fails,
+// its record is kept so that it isn't forgotten about and its slot can be
+// stomped later, the same as a failed Delete call.
+func (s *server) reconcile(ctx context.Context, policy ReconcilePolicy) error {
+	if s.store == nil {
+		return nil
+	}
+
+	st, err := s.store.load()
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.hv.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing vms: %w", err)
+	}
+
+	records := make(map[string]stateVM, len(st.VMs))
+	for _, vm := range st.VMs {
+		records[vm.Id] = vm
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, vm := range existing {
+		record, ok := records[vm.GetId()]
+		if !ok {
+			record = stateVM{Id: vm.GetId(), Name: vm.GetName()}
+		}
+
+		// vms unknown to the state are accounted as using the defaults
+		if record.CPUs == 0 && record.MemoryBytes == 0 {
+			usage := s.limits.resources(hypervisor.CreateOptions{})
+			record.CPUs = usage.CPUs
+			record.MemoryBytes = usage.MemoryBytes
+		}
+
+		// the hypervisor's view of the address is more current, but not all
+		// hypervisors report the name
+		if vm.GetAddr() != "" {
+			record.Addr = vm.GetAddr()
+			record.Endpoints = hypervisor.Endpoints(vm)
+		}
+		if record.Name == "" {
+			record.Name = vm.GetName()
+		}
+
+		if policy == ReconcileRemove {
+			err := s.hv.Delete(ctx, vm.GetId())
+			if err == nil {
+				slog.Info("removed vm", "id", record.Id, "name", record.Name)
+				continue
+			}
+			slog.Warn("removing vm failed, keeping it", "id", record.Id, "name", record.Name, "error", err)
+		} else {
+			attrs := []any{"id", record.Id, "name", record.Name, "addr", record.Addr}
+			if record.Slot != nil {
+				attrs = append(attrs, "slot", *record.Slot)
+			}
+			slog.Info("adopted vm", attrs...)
+		}
+
+		s.vms[record.Id] = hypervisor.VirtualMachineInfo{
+			Id:        record.Id,
+			Name:      record.Name,
+			Addr:      record.Addr,
+			Endpoints: record.Endpoints,
+		}
+		if record.Slot != nil {
+			s.slots[*record.Slot] = record.Id
+		}
+		s.track(record.Id, Resources{VMs: 1, CPUs: record.CPUs, MemoryBytes: record.MemoryBytes})
+	}
+
+	s.persist()
+	metrics.VMsRunning.Set(float64(len(s.vms)))
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+func TestReconcile(t *testing.T) {
+	previous := state{VMs: []stateVM{
+		{Id: "id-1", Name: "name-1", Addr: "1.1.1.1", Slot: int32Ref(0)},
+		{Id: "id-2", Name: "name-2", Addr: "2.2.2.2", Slot: int32Ref(1)}, // no longer exists
+	}}
+
+	existing := []hypervisor.VirtualMachineInfo{
+		{Id: "id-1", Addr: "1.1.1.9"},                 // survivor, hypervisor doesn't report the name
+		{Id: "id-3", Name: "name-3", Addr: "3.3.3.3"}, // unknown to the state
+	}
+
+	testCases := map[string]struct {
+		policy    ReconcilePolicy
+		expect    []expectation
+		wantState state
+		wantSlots map[int32]string
+	}{
+		"adopt": {
+			policy: ReconcileAdopt,
+			expect: []expectation{
+				hvList(existing, nil),
+			},
+			wantState: state{VMs: []stateVM{
+				{Id: "id-1", Name: "name-1", Addr: "1.1.1.9", Slot: int32Ref(0)},
+				{Id: "id-3", Name: "name-3", Addr: "3.3.3.3"},
+			}},
+			wantSlots: map[int32]string{0: "id-1"},
+		},
+		"remove": {
+			policy: ReconcileRemove,
+			expect: []expectation{
+				hvList(existing, nil),
+				hvDelete("id-1", nil),
+				hvDelete("id-3", fmt.Errorf("no can do")), // kept, so we don't forget about it
+			},
+			wantState: state{VMs: []stateVM{
+				{Id: "id-3", Name: "name-3", Addr: "3.3.3.3"},
+			}},
+			wantSlots: map[int32]string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			st := &store{path: filepath.Join(t.TempDir(), "state.json")}
+			require.NoError(t, st.save(previous))
+
+			m := mocks.NewHypervisor(t)
+			for _, expect := range tc.expect {
+				expect(m)
+			}
+
+			s := newServer(m)
+			s.store = st
+			require.NoError(t, s.reconcile(context.TODO(), tc.policy))
+
+			got, err := st.load()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantState, got)
+			assert.Equal(t, tc.wantSlots, s.slots)
+		})
+	}
+}
+
+func TestStatePersisted(t *testing.T) {
+	st := &store{path: filepath.Join(t.TempDir(), "state.json")}
+
+	m := mocks.NewHypervisor(t)
+	hvInit([]byte{}, nil)(m)
+	hvCreate("name-1", hypervisor.VirtualMachineInfo{Name: "name-1", Id: "id-1", Addr: "1.1.1.1"}, nil)(m)
+	hvCreate("name-2", hypervisor.VirtualMachineInfo{Name: "name-2", Id: "id-2", Addr: "2.2.2.2", Endpoints: hypervisor.SSHEndpoints("2.2.2.2")}, nil)(m)
+	hvDelete("id-1", nil)(m)
+
+	s := newServer(m)
+	s.store = st
+
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-1"})
+	require.NoError(t, err)
+	_, err = s.Create(context.TODO(), &proto.CreateRequest{Name: "name-2", Slot: int32Ref(5)})
+	require.NoError(t, err)
+
+	got, err := st.load()
+	require.NoError(t, err)
+	assert.Equal(t, state{VMs: []stateVM{
+		{Id: "id-1", Name: "name-1", Addr: "1.1.1.1"},
+		{Id: "id-2", Name: "name-2", Addr: "2.2.2.2", Slot: int32Ref(5), Endpoints: hypervisor.SSHEndpoints("2.2.2.2")},
+	}}, got)
+
+	_, err = s.Delete(context.TODO(), &proto.DeleteRequest{Id: "id-1"})
+	require.NoError(t, err)
+
+	got, err = st.load()
+	require.NoError(t, err)
+	assert.Equal(t, state{VMs: []stateVM{
+		{Id: "id-2", Name: "name-2", Addr: "2.2.2.2", Slot: int32Ref(5), Endpoints: hypervisor.SSHEndpoints("2.2.2.2")},
+	}}, got)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeCert creates a certificate signed by parent (or self-signed if parent
+// is nil) and writes it, along with its key, to dir.
+func writeCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	return &testCert{cert: cert, key: key}
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	ca := writeCert(t, dir, "ca", &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	writeCert(t, dir, "client", &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	writeCert(t, dir, "rogue", &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil)
+
+	serverCfg, err := ServerTLSConfig(path("server.pem"), path("server.key"), path("ca.pem"))
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	_, _, cancel, errCh := serve(t, WithTCPListener(addr, serverCfg))
+
+	dial := func(cert, key string) Client {
+		cfg, err := ClientTLSConfig(path(cert), path(key), path("ca.pem"), "")
+		require.NoError(t, err)
+
+		conn, err := NewClientConn(addr, nil, WithTLS(cfg))
+		require.NoError(t, err)
+
+		client := New(conn)
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ctxCancel()
+
+	client := dial("client.pem", "client.key")
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vms, err := client.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	// a certificate not signed by the ca is rejected
+	_, err = dial("rogue.pem", "rogue.key").List(ctx)
+	assert.Error(t, err)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestServeTCPRequiresClientCertificates(t *testing.T) {
+	err := Serve(context.Background(), nil, WithTCPListener("127.0.0.1:0", nil))
+	assert.ErrorContains(t, err, "client certificate verification")
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// uploadChunkSize is the most archive data sent per message.
+const uploadChunkSize = 1 << 20
+
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// uploadMeta identifies the archive a partial upload is of, so that only an
+// upload of the same archive resumes it.
+type uploadMeta struct {
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// UploadImage receives an image archive into the hypervisor's upload
+// directory, as <name>.partial, alongside its uploadMeta. Once the whole
+// archive is received and its digest verified, the hypervisor imports it.
+func (s *server) UploadImage(stream proto.Nesting_UploadImageServer) error {
+	if !s.initialized() {
+		return ErrNotInitialized
+	}
+
+	uploader, ok := s.hv.(hypervisor.ImageUploader)
+	if !ok {
+		return status.Error(codes.Unimplemented, "hypervisor doesn't support uploading images")
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	start := req.GetStart()
+	if err := validateUpload(start); err != nil {
+		return err
+	}
+	name := start.GetName()
+
+	if err := s.imageAvailable(stream.Context(), name); err != nil {
+		return err
+	}
+
+	// an image is only uploaded by one client at a time
+	s.mu.Lock()
+	if s.uploads[name] {
+		s.mu.Unlock()
+		return status.Errorf(codes.Aborted, "image %q is already being uploaded", name)
+	}
+	s.uploads[name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.uploads, name)
+		s.mu.Unlock()
+	}()
+
+	dir := uploader.UploadDirectory()
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return fmt.Errorf("creating upload directory: %w", err)
+	}
+
+	partial := filepath.Join(dir, name+".partial")
+	meta := uploadMeta{Size: start.GetSize(), SHA256: start.GetSha256()}
+
+	received, err := resumeUpload(partial, meta)
+	if err != nil {
+		return err
+	}
+
+	if start.GetOffset() != received {
+		return stream.SendAndClose(&proto.UploadImageResponse{Offset: received})
+	}
+
+	begin := time.Now()
+	received, err = receiveUpload(stream, partial, received, meta.Size)
+	if err != nil {
+		return err
+	}
+
+	if received < meta.Size {
+		return stream.SendAndClose(&proto.UploadImageResponse{Offset: received})
+	}
+
+	if err := verifyUpload(partial, meta.SHA256); err != nil {
+		removeUpload(partial)
+		return err
+	}
+
+	if err := uploader.ImportArchive(stream.Context(), name, partial); err != nil {
+		removeUpload(partial)
+		return imageError(err)
+	}
+	removeUpload(partial)
+
+	slog.Info("image uploaded", "name", name, "size", meta.Size, "resumed_at", start.GetOffset(), "duration", time.Since(begin))
+
+	return stream.SendAndClose(&proto.UploadImageResponse{Offset: received, Complete: true})
+}
+
+func validateUpload(start *proto.UploadImageStart) error {
+	switch {
+	case start == nil:
+		return status.Error(codes.InvalidArgument, "upload must start with the image's name, size and digest")
+	case !validFileName(start.GetName()):
+		return status.Errorf(codes.InvalidArgument, "invalid image name %q", start.GetName())
+	case start.GetSize() == 0:
+		return status.Error(codes.InvalidArgument, "upload requires the archive's size")
+	case !sha256Pattern.MatchString(start.GetSha256()):
+		return status.Error(codes.InvalidArgument, "upload requires the archive's hex encoded sha256")
+	case start.GetOffset() > start.GetSize():
+		return status.Error(codes.InvalidArgument, "upload offset is beyond the archive's size")
+	}
+
+	return nil
+}
+
+// validFileName rejects names that can't be used as a file name, such as in
+// the upload directory.
+func validFileName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// imageAvailable fails if the image already exists, so that an upload isn't
+// rejected only once it's complete.
+func (s *server) imageAvailable(ctx context.Context, name string) error {
+	images, ok := s.hv.(hypervisor.ImageManager)
+	if !ok {
+		return nil
+	}
+
+	list, err := images.ListImages(ctx)
+	if err != nil {
+		return imageError(err)
+	}
+
+	for _, image := range list {
+		if image.Name == name {
+			return status.Errorf(codes.AlreadyExists, "%v: %s", hypervisor.ErrImageExists, name)
+		}
+	}
+
+	return nil
+}
+
+// resumeUpload returns how much of a partial upload of the archive was
+// received. A partial upload of a different archive is discarded.
+func resumeUpload(partial string, meta uploadMeta) (uint64, error) {
+	metaPath := strings.TrimSuffix(partial, ".partial") + ".json"
+
+	var existing uploadMeta
+	buf, err := os.ReadFile(metaPath)
+	if err == nil {
+		err = json.Unmarshal(buf, &existing)
+	}
+
+	if err == nil && existing == meta {
+		fi, err := os.Stat(partial)
+		if err == nil && uint64(fi.Size()) <= meta.Size {
+			return uint64(fi.Size()), nil
+		}
+	}
+
+	buf, err = json.Marshal(meta)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(metaPath, buf, 0o666); err != nil {
+		return 0, fmt.Errorf("writing upload metadata: %w", err)
+	}
+	if err := os.WriteFile(partial, nil, 0o666); err != nil {
+		return 0, fmt.Errorf("creating upload: %w", err)
+	}
+
+	return 0, nil
+}
+
+// receiveUpload appends the stream's data to the partial upload, until the
+// client closes the stream. What's received is kept if the stream fails, so
+// that the upload can be resumed.
+func receiveUpload(stream proto.Nesting_UploadImageServer, partial string, received, size uint64) (uint64, error) {
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return received, fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return received, err
+		}
+
+		data := req.GetData()
+		if received+uint64(len(data)) > size {
+			return received, status.Error(codes.InvalidArgument, "upload is larger than the archive's size")
+		}
+
+		if _, err := f.Write(data); err != nil {
+			return received, fmt.Errorf("writing upload: %w", err)
+		}
+		received += uint64(len(data))
+	}
+
+	if err := f.Close(); err != nil {
+		return received, fmt.Errorf("writing upload: %w", err)
+	}
+
+	return received, nil
+}
+
+func verifyUpload(partial, want string) error {
+	f, err := os.Open(partial)
+	if err != nil {
+		return fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("reading upload: %w", err)
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return status.Errorf(codes.DataLoss, "upload's sha256 is %s, expected %s", got, want)
+	}
+
+	return nil
+}
+
+// removeUpload removes a partial upload and its metadata.
+func removeUpload(partial string) {
+	os.Remove(partial)
+	os.Remove(strings.TrimSuffix(partial, ".partial") + ".json")
+}
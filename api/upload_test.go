@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/fake"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/mocks"
+)
+
+// uploadStream is a server side upload stream, receiving the requests.
+type uploadStream struct {
+	grpc.ServerStream
+
+	reqs []*proto.UploadImageRequest
+	err  error
+	resp *proto.UploadImageResponse
+}
+
+func (s *uploadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *uploadStream) Recv() (*proto.UploadImageRequest, error) {
+	if len(s.reqs) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *uploadStream) SendAndClose(resp *proto.UploadImageResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func upload(start *proto.UploadImageStart, data ...[]byte) *uploadStream {
+	stream := &uploadStream{reqs: []*proto.UploadImageRequest{
+		{Request: &proto.UploadImageRequest_Start{Start: start}},
+	}}
+	for _, d := range data {
+		stream.reqs = append(stream.reqs, &proto.UploadImageRequest{Request: &proto.UploadImageRequest_Data{Data: d}})
+	}
+	return stream
+}
+
+func archiveStart(name string, archive []byte, offset uint64) *proto.UploadImageStart {
+	sum := sha256.Sum256(archive)
+	return &proto.UploadImageStart{
+		Name:   name,
+		Size:   uint64(len(archive)),
+		Sha256: hex.EncodeToString(sum[:]),
+		Offset: offset,
+	}
+}
+
+func newUploadServer(t *testing.T) (*server, *fake.Fake, string) {
+	hv, err := fake.New(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	s := newServer(hv)
+	_, err = s.Init(context.TODO(), &proto.InitRequest{Config: []byte(`{"upload_directory": "` + dir + `"}`)})
+	require.NoError(t, err)
+
+	return s, hv, dir
+}
+
+func TestUploadImageResumes(t *testing.T) {
+	s, hv, dir := newUploadServer(t)
+	archive := bytes.Repeat([]byte("archive"), 100)
+
+	// the stream fails part way through
+	stream := upload(archiveStart("image", archive, 0), archive[:300])
+	stream.err = status.Error(codes.Canceled, "context canceled")
+	require.Error(t, s.UploadImage(stream))
+
+	// starting over is refused, with the offset to resume from
+	stream = upload(archiveStart("image", archive, 0), archive)
+	require.NoError(t, s.UploadImage(stream))
+	assert.Equal(t, &proto.UploadImageResponse{Offset: 300}, stream.resp)
+
+	stream = upload(archiveStart("image", archive, 300), archive[300:500], archive[500:])
+	require.NoError(t, s.UploadImage(stream))
+	assert.Equal(t, &proto.UploadImageResponse{Offset: uint64(len(archive)), Complete: true}, stream.resp)
+
+	images, err := hv.ListImages(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image"}}, images)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestUploadImageDifferentArchive(t *testing.T) {
+	s, _, dir := newUploadServer(t)
+	archive := []byte("archive")
+
+	stream := upload(archiveStart("image", []byte("another archive"), 0), []byte("another"))
+	require.NoError(t, s.UploadImage(stream))
+	assert.Equal(t, &proto.UploadImageResponse{Offset: 7}, stream.resp)
+
+	// a partial upload of a different archive is discarded
+	stream = upload(archiveStart("image", archive, 0), archive)
+	require.NoError(t, s.UploadImage(stream))
+	assert.True(t, stream.resp.GetComplete())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestUploadImageErrors(t *testing.T) {
+	archive := []byte("archive")
+
+	testCases := map[string]struct {
+		stream *uploadStream
+		code   codes.Code
+	}{
+		"no start": {
+			stream: &uploadStream{reqs: []*proto.UploadImageRequest{{Request: &proto.UploadImageRequest_Data{Data: archive}}}},
+			code:   codes.InvalidArgument,
+		},
+		"invalid name": {
+			stream: upload(archiveStart("../image", archive, 0), archive),
+			code:   codes.InvalidArgument,
+		},
+		"invalid digest": {
+			stream: upload(&proto.UploadImageStart{Name: "image", Size: 7, Sha256: "abc"}, archive),
+			code:   codes.InvalidArgument,
+		},
+		"too large": {
+			stream: upload(archiveStart("image", archive, 0), archive, archive),
+			code:   codes.InvalidArgument,
+		},
+		"digest mismatch": {
+			stream: upload(archiveStart("image", archive, 0), []byte("ARCHIVE")),
+			code:   codes.DataLoss,
+		},
+		"image exists": {
+			stream: upload(archiveStart("existing", archive, 0), archive),
+			code:   codes.AlreadyExists,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, hv, dir := newUploadServer(t)
+			require.NoError(t, hv.ImportImage(context.TODO(), "existing", ""))
+
+			err := s.UploadImage(tc.stream)
+			assert.Equal(t, tc.code, status.Code(err), err)
+
+			// a corrupt upload isn't kept for resuming
+			if tc.code == codes.DataLoss {
+				entries, err := os.ReadDir(dir)
+				require.NoError(t, err)
+				assert.Empty(t, entries)
+			}
+		})
+	}
+}
+
+func TestUploadImageUnimplemented(t *testing.T) {
+	m := mocks.NewHypervisor(t)
+	s := newServer(m)
+
+	hvInit([]byte{}, nil)(m)
+	_, err := s.Init(context.TODO(), &proto.InitRequest{Config: []byte{}})
+	require.NoError(t, err)
+
+	err = s.UploadImage(upload(archiveStart("image", []byte("archive"), 0)))
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestClientUploadImage(t *testing.T) {
+	client, ctx, cancel, errCh := serve(t)
+
+	dir := t.TempDir()
+	require.Eventually(t, func() bool {
+		return client.Init(ctx, []byte(`{"upload_directory": "`+dir+`"}`)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	archive := bytes.Repeat([]byte{1, 2, 3, 4}, uploadChunkSize)
+
+	// a previous upload got part way through
+	start := archiveStart("image", archive, 0)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.partial"), archive[:uploadChunkSize+10], 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.json"), []byte(`{"size": `+
+		strconv.FormatUint(start.GetSize(), 10)+`, "sha256": "`+start.GetSha256()+`"}`), 0o666))
+
+	var sent []uint64
+	require.NoError(t, client.UploadImage(ctx, "image", bytes.NewReader(archive), func(n, total uint64) {
+		assert.Equal(t, uint64(len(archive)), total)
+		sent = append(sent, n)
+	}))
+	assert.Equal(t, uint64(len(archive)), sent[len(sent)-1])
+
+	images, err := client.ListImages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image"}}, images)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
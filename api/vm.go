@@ -0,0 +1,52 @@
+package api
+
+import (
+	"gitlab.com/gitlab-org/fleeting/nesting/api/internal/proto"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// vmToProto converts a VM, with the endpoints it reports, for a response.
+func vmToProto(vm hypervisor.VirtualMachine) *proto.VirtualMachine {
+	pvm := &proto.VirtualMachine{
+		Id:   vm.GetId(),
+		Name: vm.GetName(),
+		Addr: vm.GetAddr(),
+	}
+
+	for _, e := range hypervisor.Endpoints(vm) {
+		pvm.Endpoints = append(pvm.Endpoints, &proto.Endpoint{
+			Host:      e.Host,
+			Port:      uint32(e.Port),
+			GuestPort: uint32(e.GuestPort),
+			Protocol:  e.Protocol,
+			Purpose:   e.Purpose,
+		})
+	}
+
+	return pvm
+}
+
+// vmFromProto converts a VM from a response, returning nil if there's none.
+func vmFromProto(pvm *proto.VirtualMachine) hypervisor.VirtualMachine {
+	if pvm == nil {
+		return nil
+	}
+
+	vm := hypervisor.VirtualMachineInfo{
+		Id:   pvm.GetId(),
+		Name: pvm.GetName(),
+		Addr: pvm.GetAddr(),
+	}
+
+	for _, e := range pvm.GetEndpoints() {
+		vm.Endpoints = append(vm.Endpoints, hypervisor.Endpoint{
+			Host:      e.GetHost(),
+			Port:      uint16(e.GetPort()),
+			GuestPort: uint16(e.GetGuestPort()),
+			Protocol:  e.GetProtocol(),
+			Purpose:   e.GetPurpose(),
+		})
+	}
+
+	return vm
+}
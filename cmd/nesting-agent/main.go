@@ -0,0 +1,45 @@
+// nesting-agent runs inside a Virtualization framework guest, and runs
+// commands on behalf of the host's nesting Exec RPC over virtio-vsock.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/agent"
+)
+
+func main() {
+	port := flag.Uint("port", uint(agent.Port), "vsock port to listen on")
+	flag.Parse()
+
+	if err := serve(uint32(*port)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func serve(port uint32) error {
+	l, err := listen(port)
+	if err != nil {
+		return fmt.Errorf("listening on vsock port %d: %w", port, err)
+	}
+	defer l.Close()
+
+	slog.Info("listening", "port", port)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("accepting connection: %w", err)
+		}
+
+		go func() {
+			if err := agent.Handle(conn); err != nil {
+				slog.Warn("handling exec failed", "error", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// listener accepts vsock connections. The net package doesn't support vsock,
+// so connections are plain files.
+type listener struct {
+	fd int
+}
+
+func listen(port uint32) (*listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &listener{fd: fd}, nil
+}
+
+func (l *listener) Accept() (io.ReadWriteCloser, error) {
+	for {
+		fd, _, err := unix.Accept4(l.fd, unix.SOCK_CLOEXEC)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return os.NewFile(uintptr(fd), "vsock"), nil
+	}
+}
+
+func (l *listener) Close() error {
+	return unix.Close(l.fd)
+}
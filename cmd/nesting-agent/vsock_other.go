@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+type listener struct{}
+
+func listen(port uint32) (*listener, error) {
+	return nil, fmt.Errorf("vsock is unsupported on this platform")
+}
+
+func (l *listener) Accept() (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("vsock is unsupported on this platform")
+}
+
+func (l *listener) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package capacity
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type capacityCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *capacityCmd {
+	c := &capacityCmd{}
+	c.fs = flag.NewFlagSet("capacity", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *capacityCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, ""
+}
+
+func (cmd *capacityCmd) Execute(ctx context.Context) error {
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	capacity, err := client.Capacity(ctx)
+	if err != nil {
+		return err
+	}
+
+	limit := func(v uint64) string {
+		if v == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(v)
+	}
+
+	fmt.Println("vms", capacity.Used.VMs, limit(uint64(capacity.Limits.VMs)))
+	fmt.Println("cpus", capacity.Used.CPUs, limit(uint64(capacity.Limits.CPUs)))
+	fmt.Println("memory_bytes", capacity.Used.MemoryBytes, limit(capacity.Limits.MemoryBytes))
+
+	return nil
+}
@@ -5,17 +5,40 @@ import (
 	"flag"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 )
 
 type createCmd struct {
-	fs *flag.FlagSet
+	fs   *flag.FlagSet
+	conn connect.Flags
+
+	cpus     uint
+	memory   uint64
+	diskSize uint64
+	snapshot string
+	ports    []hypervisor.PortForward
 }
 
 func New() *createCmd {
 	c := &createCmd{}
 	c.fs = flag.NewFlagSet("create", flag.ExitOnError)
+	c.conn.Register(c.fs)
+
+	c.fs.UintVar(&c.cpus, "cpus", 0, "cpu count, overriding the image's default")
+	c.fs.Uint64Var(&c.memory, "memory", 0, "memory size in MiB, overriding the image's default")
+	c.fs.Uint64Var(&c.diskSize, "disk-size", 0, "disk size in GiB, overriding the image's default")
+	c.fs.StringVar(&c.snapshot, "snapshot", "", "snapshot of the image to restore, instead of booting")
+	c.fs.Func("port", "guest port to be reachable on, as [<purpose>=]<port>[/<protocol>], such as rdp=3389 (repeatable)", func(s string) error {
+		port, err := parsePort(s)
+		if err == nil {
+			c.ports = append(c.ports, port)
+		}
+		return err
+	})
 	return c
 }
 
@@ -28,7 +51,7 @@ func (cmd *createCmd) Execute(ctx context.Context) error {
 		return flag.ErrHelp
 	}
 
-	conn, err := api.DefaultConn()
+	conn, err := cmd.conn.Conn()
 	if err != nil {
 		return err
 	}
@@ -46,15 +69,49 @@ func (cmd *createCmd) Execute(ctx context.Context) error {
 		slot = &s
 	}
 
-	vm, stompedVmId, err := client.Create(ctx, cmd.fs.Args()[0], slot)
+	vm, stompedVmId, err := client.Create(ctx, cmd.fs.Args()[0], slot,
+		api.WithCPUs(uint32(cmd.cpus)),
+		api.WithMemory(cmd.memory<<20),
+		api.WithDiskSize(cmd.diskSize<<30),
+		api.WithSnapshot(cmd.snapshot),
+		api.WithPorts(cmd.ports...),
+	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(vm.GetId(), vm.GetName(), vm.GetAddr())
+	fields := []any{vm.GetId(), vm.GetName(), vm.GetAddr()}
+	for _, e := range hypervisor.Endpoints(vm) {
+		if e.Purpose == "" {
+			fields = append(fields, e.String())
+			continue
+		}
+		fields = append(fields, e.Purpose+"="+e.String())
+	}
+	fmt.Println(fields...)
 	if stompedVmId != nil {
 		fmt.Printf("stomped vm id %q\n", *stompedVmId)
 	}
 
 	return nil
 }
+
+// parsePort parses a port forward, as [<purpose>=]<port>[/<protocol>].
+func parsePort(s string) (hypervisor.PortForward, error) {
+	var port hypervisor.PortForward
+
+	if purpose, rest, ok := strings.Cut(s, "="); ok {
+		port.Purpose, s = purpose, rest
+	}
+	if rest, protocol, ok := strings.Cut(s, "/"); ok {
+		s, port.Protocol = rest, protocol
+	}
+
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || n == 0 {
+		return port, fmt.Errorf("invalid port %q", s)
+	}
+	port.Port = uint16(n)
+
+	return port, nil
+}
@@ -3,17 +3,26 @@ package delete
 import (
 	"context"
 	"flag"
+	"fmt"
+	"time"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
 )
 
 type deleteCmd struct {
-	fs *flag.FlagSet
+	fs    *flag.FlagSet
+	conn  connect.Flags
+	grace time.Duration
 }
 
 func New() *deleteCmd {
 	c := &deleteCmd{}
 	c.fs = flag.NewFlagSet("delete", flag.ExitOnError)
+	c.conn.Register(c.fs)
+
+	c.fs.DurationVar(&c.grace, "grace-period", 0, "how long the guest is given to shut down before the vm is forcibly stopped")
+
 	return c
 }
 
@@ -26,7 +35,7 @@ func (cmd *deleteCmd) Execute(ctx context.Context) error {
 		return flag.ErrHelp
 	}
 
-	conn, err := api.DefaultConn()
+	conn, err := cmd.conn.Conn()
 	if err != nil {
 		return err
 	}
@@ -34,5 +43,12 @@ func (cmd *deleteCmd) Execute(ctx context.Context) error {
 	client := api.New(conn)
 	defer client.Close()
 
-	return client.Delete(ctx, cmd.fs.Args()[0])
+	method, err := client.DeleteWithOptions(ctx, cmd.fs.Args()[0], api.DeleteOptions{GracePeriod: cmd.grace})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("stopped", method)
+
+	return nil
 }
@@ -0,0 +1,62 @@
+package exec
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type execCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *execCmd {
+	c := &execCmd{}
+	c.fs = flag.NewFlagSet("exec", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *execCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, "<image id> -- <command> [<args>...]"
+}
+
+func (cmd *execCmd) Execute(ctx context.Context) error {
+	args := cmd.fs.Args()
+	if len(args) < 2 {
+		return flag.ErrHelp
+	}
+
+	id, command := args[0], args[1:]
+	if command[0] == "--" {
+		command = command[1:]
+	}
+	if len(command) == 0 {
+		return flag.ErrHelp
+	}
+
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+
+	exitCode, err := client.Exec(ctx, id, command, os.Stdin, os.Stdout, os.Stderr)
+	client.Close()
+	if err != nil {
+		return err
+	}
+
+	// exit with the command's exit code, so that nesting exec can be used in
+	// scripts like the command itself
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package images
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type imagesCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *imagesCmd {
+	c := &imagesCmd{}
+	c.fs = flag.NewFlagSet("images", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *imagesCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, "list | import <image name> <source path> | upload <image name> <archive path> | rm <image name>"
+}
+
+func (cmd *imagesCmd) Execute(ctx context.Context) error {
+	args := cmd.fs.Args()
+	if len(args) < 1 {
+		return flag.ErrHelp
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+	case args[0] == "import" && len(args) == 3:
+	case args[0] == "upload" && len(args) == 3:
+	case args[0] == "rm" && len(args) == 2:
+	default:
+		return flag.ErrHelp
+	}
+
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	switch args[0] {
+	case "import":
+		return client.ImportImage(ctx, args[1], args[2])
+
+	case "upload":
+		return upload(ctx, client, args[1], args[2])
+
+	case "rm":
+		return client.DeleteImage(ctx, args[1])
+	}
+
+	images, err := client.ListImages(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		fmt.Println(image.Name, image.SizeBytes)
+	}
+
+	return nil
+}
+
+// upload uploads a local archive, reporting progress on stderr.
+func upload(ctx context.Context, client api.Client, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = client.UploadImage(ctx, name, f, func(sent, total uint64) {
+		fmt.Fprintf(os.Stderr, "\ruploaded %d of %d MiB (%d%%)", sent>>20, total>>20, sent*100/total)
+	})
+	fmt.Fprintln(os.Stderr)
+
+	return err
+}
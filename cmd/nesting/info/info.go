@@ -0,0 +1,62 @@
+package info
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type infoCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *infoCmd {
+	c := &infoCmd{}
+	c.fs = flag.NewFlagSet("info", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *infoCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, ""
+}
+
+func (cmd *infoCmd) Execute(ctx context.Context) error {
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	info, err := client.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	limit := func(v uint64) string {
+		if v == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(v)
+	}
+
+	features := make([]string, 0, len(info.Capabilities.Features))
+	for _, feature := range info.Capabilities.Features {
+		features = append(features, string(feature))
+	}
+
+	fmt.Println("version", info.Version.Version)
+	fmt.Println("hypervisor", info.Hypervisor, info.Capabilities.Version)
+	fmt.Println("features", strings.Join(features, ","))
+	fmt.Println("address_format", info.Capabilities.AddressFormat)
+	fmt.Println("max_vms", limit(uint64(info.Capabilities.MaxVMs)))
+
+	return nil
+}
@@ -7,10 +7,12 @@ import (
 	"os"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
 )
 
 type initializeCmd struct {
-	fs *flag.FlagSet
+	fs   *flag.FlagSet
+	conn connect.Flags
 
 	configPath string
 }
@@ -18,6 +20,7 @@ type initializeCmd struct {
 func New() *initializeCmd {
 	c := &initializeCmd{}
 	c.fs = flag.NewFlagSet("init", flag.ExitOnError)
+	c.conn.Register(c.fs)
 
 	c.fs.StringVar(&c.configPath, "config", "", "config")
 
@@ -41,7 +44,7 @@ func (cmd *initializeCmd) Execute(ctx context.Context) error {
 		}
 	}
 
-	conn, err := api.DefaultConn()
+	conn, err := cmd.conn.Conn()
 	if err != nil {
 		return err
 	}
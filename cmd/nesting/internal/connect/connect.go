@@ -0,0 +1,53 @@
+package connect
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+)
+
+// Flags are the connection flags shared by every client command.
+type Flags struct {
+	endpoint   string
+	certFile   string
+	keyFile    string
+	caFile     string
+	serverName string
+	token      string
+}
+
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.endpoint, "endpoint", "", "remote endpoint (host:port), defaults to the local socket")
+	fs.StringVar(&f.certFile, "tls-cert", "", "client certificate for the remote endpoint")
+	fs.StringVar(&f.keyFile, "tls-key", "", "client key for the remote endpoint")
+	fs.StringVar(&f.caFile, "tls-ca", "", "ca certificate verifying the remote endpoint")
+	fs.StringVar(&f.token, "token", os.Getenv("NESTING_TOKEN"), "bearer token, defaults to $NESTING_TOKEN")
+	fs.StringVar(&f.serverName, "tls-server-name", "", "server name verified against the remote endpoint's certificate")
+}
+
+// Conn connects to the endpoint, or the local socket if no endpoint was given.
+func (f *Flags) Conn() (*grpc.ClientConn, error) {
+	var opts []api.ClientOption
+	if f.token != "" {
+		opts = append(opts, api.WithToken(f.token))
+	}
+
+	if f.endpoint == "" {
+		return api.NewClientConn("", nil, opts...)
+	}
+
+	if f.certFile == "" || f.keyFile == "" || f.caFile == "" {
+		return nil, fmt.Errorf("remote endpoint requires -tls-cert, -tls-key and -tls-ca")
+	}
+
+	cfg, err := api.ClientTLSConfig(f.certFile, f.keyFile, f.caFile, f.serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.NewClientConn(f.endpoint, nil, append(opts, api.WithTLS(cfg))...)
+}
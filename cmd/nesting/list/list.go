@@ -6,15 +6,19 @@ import (
 	"fmt"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 )
 
 type listCmd struct {
-	fs *flag.FlagSet
+	fs   *flag.FlagSet
+	conn connect.Flags
 }
 
 func New() *listCmd {
 	c := &listCmd{}
 	c.fs = flag.NewFlagSet("list", flag.ExitOnError)
+	c.conn.Register(c.fs)
 	return c
 }
 
@@ -23,7 +27,7 @@ func (cmd *listCmd) Command() (*flag.FlagSet, string) {
 }
 
 func (cmd *listCmd) Execute(ctx context.Context) error {
-	conn, err := api.DefaultConn()
+	conn, err := cmd.conn.Conn()
 	if err != nil {
 		return err
 	}
@@ -37,7 +41,15 @@ func (cmd *listCmd) Execute(ctx context.Context) error {
 	}
 
 	for _, vm := range vms {
-		fmt.Println(vm.GetId(), vm.GetName(), vm.GetAddr())
+		fields := []any{vm.GetId(), vm.GetName(), vm.GetAddr()}
+		for _, e := range hypervisor.Endpoints(vm) {
+			if e.Purpose == "" {
+				fields = append(fields, e.String())
+				continue
+			}
+			fields = append(fields, e.Purpose+"="+e.String())
+		}
+		fmt.Println(fields...)
 	}
 
 	return nil
@@ -8,13 +8,20 @@ import (
 	"os"
 	"os/signal"
 
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/capacity"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/create"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/delete"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/exec"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/images"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/info"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/initialize"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/list"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/pool"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/serve"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/shutdown"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/snapshot"
 	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/version"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/watch"
 )
 
 type Command interface {
@@ -43,7 +50,14 @@ func main() {
 		shutdown.New(),
 		create.New(),
 		delete.New(),
+		snapshot.New(),
 		list.New(),
+		watch.New(),
+		capacity.New(),
+		info.New(),
+		pool.New(),
+		exec.New(),
+		images.New(),
 		version.New(),
 	}
 
@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type poolCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *poolCmd {
+	c := &poolCmd{}
+	c.fs = flag.NewFlagSet("pool", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *poolCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, ""
+}
+
+func (cmd *poolCmd) Execute(ctx context.Context) error {
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	pools, err := client.Pool(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range pools {
+		fmt.Println(pool.Name, pool.Ready, pool.Filling, pool.Target)
+	}
+
+	return nil
+}
@@ -4,12 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/fake"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/parallels"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/qemu"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/tart"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/virtualizationframework"
 )
@@ -18,13 +24,39 @@ type serveCmd struct {
 	fs         *flag.FlagSet
 	hypervisor string
 	configPath string
+	statePath  string
+	reconcile  string
+
+	listen   string
+	certFile string
+	keyFile  string
+	caFile   string
+
+	tokensPath  string
+	metricsAddr string
+
+	logLevel  string
+	logFormat string
+
+	readiness        string
+	readinessTimeout time.Duration
+
+	pool map[string]int
+
+	maxVMs        uint
+	maxCPUs       uint
+	maxMemory     uint64
+	defaultCPUs   uint
+	defaultMemory uint64
 }
 
 func New() *serveCmd {
-	c := &serveCmd{}
+	c := &serveCmd{pool: make(map[string]int)}
 	c.fs = flag.NewFlagSet("serve", flag.ExitOnError)
 
 	switch runtime.GOOS {
+	case "linux":
+		c.hypervisor = "qemu"
 	case "darwin":
 		fallthrough
 	default:
@@ -33,10 +65,43 @@ func New() *serveCmd {
 
 	c.fs.StringVar(&c.hypervisor, "hypervisor", c.hypervisor, "hypervisor")
 	c.fs.StringVar(&c.configPath, "config", "", "config")
+	c.fs.StringVar(&c.statePath, "state", api.StatePath(), "state file persisting slots and vms across restarts (empty to disable)")
+	c.fs.StringVar(&c.reconcile, "reconcile", string(api.ReconcileAdopt), "what to do with vms that survive a restart (adopt, remove)")
+	c.fs.StringVar(&c.listen, "listen", "", "additionally listen on a tcp address (host:port) for remote clients, requires tls")
+	c.fs.StringVar(&c.certFile, "tls-cert", "", "server certificate for the tcp listener")
+	c.fs.StringVar(&c.keyFile, "tls-key", "", "server key for the tcp listener")
+	c.fs.StringVar(&c.caFile, "tls-ca", "", "ca certificate verifying client certificates on the tcp listener")
+	c.fs.StringVar(&c.tokensPath, "tokens", "", "tokens file, requiring clients to authenticate with a bearer token")
+	c.fs.StringVar(&c.metricsAddr, "metrics-listen", "", "serve prometheus metrics on a tcp address (host:port)")
+	c.fs.UintVar(&c.maxVMs, "max-vms", 0, "maximum number of concurrent vms (0 for unlimited)")
+	c.fs.UintVar(&c.maxCPUs, "max-cpus", 0, "maximum cpus across all vms (0 for unlimited)")
+	c.fs.Uint64Var(&c.maxMemory, "max-memory", 0, "maximum memory in MiB across all vms (0 for unlimited)")
+	c.fs.UintVar(&c.defaultCPUs, "default-cpus", 0, "cpus a vm created without overrides is accounted as using")
+	c.fs.Uint64Var(&c.defaultMemory, "default-memory", 0, "memory in MiB a vm created without overrides is accounted as using")
+	c.fs.StringVar(&c.readiness, "readiness", "", "probe a new vm must pass before create returns, such as ssh, tcp://:22 or http://:8080/healthz")
+	c.fs.DurationVar(&c.readinessTimeout, "readiness-timeout", 5*time.Minute, "how long a new vm has to pass the readiness probe before it's deleted")
+	c.fs.Func("pool", "keep a number of pre-booted vms of an image (name=count), can be repeated", c.parsePool)
+	c.fs.StringVar(&c.logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	c.fs.StringVar(&c.logFormat, "log-format", "text", "log format (text, json)")
 
 	return c
 }
 
+func (cmd *serveCmd) parsePool(value string) error {
+	name, count, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid pool %q, expected name=count", value)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid pool %q, expected name=count", value)
+	}
+
+	cmd.pool[name] = n
+	return nil
+}
+
 func (cmd *serveCmd) Command() (*flag.FlagSet, string) {
 	return cmd.fs, ""
 }
@@ -48,6 +113,12 @@ func (cmd *serveCmd) Execute(ctx context.Context) error {
 		hv     hypervisor.Hypervisor
 	)
 
+	logger, err := newLogger(cmd.logLevel, cmd.logFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
 	if cmd.configPath != "" {
 		config, err = os.ReadFile(cmd.configPath)
 		if err != nil {
@@ -68,14 +139,96 @@ func (cmd *serveCmd) Execute(ctx context.Context) error {
 			return err
 		}
 
+	case "qemu":
+		hv, err = qemu.New(config)
+		if err != nil {
+			return err
+		}
+
 	case "virtualizationframework":
 		hv, err = virtualizationframework.New(config)
 		if err != nil {
 			return err
 		}
+
+	case "fake":
+		hv, err = fake.New(config)
+		if err != nil {
+			return err
+		}
+
 	default:
 		return fmt.Errorf("unknown hypervisor %q", cmd.hypervisor)
 	}
 
-	return api.Serve(ctx, hv)
+	var opts []api.ServeOption
+	if cmd.statePath != "" {
+		opts = append(opts, api.WithState(cmd.statePath, api.ReconcilePolicy(cmd.reconcile)))
+	}
+
+	if cmd.listen != "" {
+		if cmd.certFile == "" || cmd.keyFile == "" || cmd.caFile == "" {
+			return fmt.Errorf("-listen requires -tls-cert, -tls-key and -tls-ca")
+		}
+
+		cfg, err := api.ServerTLSConfig(cmd.certFile, cmd.keyFile, cmd.caFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, api.WithTCPListener(cmd.listen, cfg))
+	}
+
+	opts = append(opts, api.WithLimits(api.Limits{
+		MaxVMs:             uint32(cmd.maxVMs),
+		MaxCPUs:            uint32(cmd.maxCPUs),
+		MaxMemoryBytes:     cmd.maxMemory << 20,
+		DefaultCPUs:        uint32(cmd.defaultCPUs),
+		DefaultMemoryBytes: cmd.defaultMemory << 20,
+	}))
+
+	if cmd.readiness != "" {
+		probe, err := api.ParseProbe(cmd.readiness)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, api.WithReadiness(probe, cmd.readinessTimeout))
+	}
+
+	if len(cmd.pool) > 0 {
+		opts = append(opts, api.WithPool(cmd.pool))
+	}
+
+	if cmd.metricsAddr != "" {
+		opts = append(opts, api.WithMetricsListener(cmd.metricsAddr))
+	}
+
+	if cmd.tokensPath != "" {
+		tokens, err := api.LoadTokens(cmd.tokensPath)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, api.WithTokens(tokens))
+	}
+
+	return api.Serve(ctx, hv, opts...)
+}
+
+// newLogger returns a logger writing to stderr in the format and at the level
+// given.
+func newLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+
+	return nil, fmt.Errorf("invalid log format %q", format)
 }
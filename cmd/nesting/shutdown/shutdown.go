@@ -5,10 +5,12 @@ import (
 	"flag"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
 )
 
 type shutdownCmd struct {
-	fs *flag.FlagSet
+	fs   *flag.FlagSet
+	conn connect.Flags
 
 	configPath string
 }
@@ -16,6 +18,7 @@ type shutdownCmd struct {
 func New() *shutdownCmd {
 	c := &shutdownCmd{}
 	c.fs = flag.NewFlagSet("shutdown", flag.ExitOnError)
+	c.conn.Register(c.fs)
 
 	return c
 }
@@ -25,7 +28,7 @@ func (cmd *shutdownCmd) Command() (*flag.FlagSet, string) {
 }
 
 func (cmd *shutdownCmd) Execute(ctx context.Context) error {
-	conn, err := api.DefaultConn()
+	conn, err := cmd.conn.Conn()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"context"
+	"flag"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+)
+
+type snapshotCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *snapshotCmd {
+	c := &snapshotCmd{}
+	c.fs = flag.NewFlagSet("snapshot", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *snapshotCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, "<image id> <snapshot name> | rm <snapshot name>"
+}
+
+func (cmd *snapshotCmd) Execute(ctx context.Context) error {
+	args := cmd.fs.Args()
+	if len(args) != 2 {
+		return flag.ErrHelp
+	}
+
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	if args[0] == "rm" {
+		return client.DeleteSnapshot(ctx, args[1])
+	}
+
+	return client.Snapshot(ctx, args[0], args[1])
+}
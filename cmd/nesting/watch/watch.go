@@ -0,0 +1,49 @@
+package watch
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/api"
+	"gitlab.com/gitlab-org/fleeting/nesting/cmd/nesting/internal/connect"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+type watchCmd struct {
+	fs   *flag.FlagSet
+	conn connect.Flags
+}
+
+func New() *watchCmd {
+	c := &watchCmd{}
+	c.fs = flag.NewFlagSet("watch", flag.ExitOnError)
+	c.conn.Register(c.fs)
+	return c
+}
+
+func (cmd *watchCmd) Command() (*flag.FlagSet, string) {
+	return cmd.fs, ""
+}
+
+func (cmd *watchCmd) Execute(ctx context.Context) error {
+	conn, err := cmd.conn.Conn()
+	if err != nil {
+		return err
+	}
+
+	client := api.New(conn)
+	defer client.Close()
+
+	err = client.Watch(ctx, func(ev hypervisor.Event) error {
+		fmt.Println(ev.Time.Format(time.RFC3339), ev.Type, ev.Id, ev.Name, ev.Reason)
+		return nil
+	})
+	// watching until interrupted isn't an error
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
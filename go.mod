@@ -6,12 +6,14 @@ toolchain go1.21.6
 
 require (
 	github.com/Code-Hex/gvisor-vmnet v0.0.0-20240122100406-1579d1a4ee55
-	github.com/Code-Hex/vz/v3 v3.0.6
+	github.com/Code-Hex/vz/v3 v3.1.0
 	github.com/klauspost/compress v1.16.5
+	github.com/prometheus/client_golang v1.17.0
 	github.com/stretchr/testify v1.8.2
 	golang.org/x/net v0.23.0
 	golang.org/x/sync v0.4.0
 	golang.org/x/sys v0.18.0
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1
 	google.golang.org/grpc v1.56.3
 	google.golang.org/protobuf v1.33.0
 )
@@ -19,13 +21,19 @@ require (
 require (
 	github.com/Code-Hex/go-generics-cache v1.2.1 // indirect
 	github.com/Code-Hex/go-infinity-channel v1.0.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/btree v1.1.2 // indirect
 	github.com/google/gopacket v1.1.19 // indirect
 	github.com/insomniacslk/dhcp v0.0.0-20221128164207-f26e6d78f622 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/miekg/dns v1.1.50 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16 // indirect
+	github.com/prometheus/common v0.44.0 // indirect
+	github.com/prometheus/procfs v0.11.1 // indirect
 	github.com/stretchr/objx v0.5.0 // indirect
 	github.com/u-root/uio v0.0.0-20210528114334-82958018845c // indirect
 	golang.org/x/exp v0.0.0-20230725093048-515e97ebf090 // indirect
@@ -33,7 +41,6 @@ require (
 	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/time v0.3.0 // indirect
 	golang.org/x/tools v0.14.0 // indirect
-	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gvisor.dev/gvisor v0.0.0-20240117011310-b5318a0dd5db // indirect
 )
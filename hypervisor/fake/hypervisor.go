@@ -0,0 +1,488 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+)
+
+const vmNamePrefix = "nesting-"
+
+var (
+	ErrNoCapacity    = errors.New("no capacity available")
+	ErrInjectedFault = errors.New("injected fault")
+)
+
+// Fake is an in-memory hypervisor for testing. VMs are never actually
+// started, they're assigned a unique loopback address and exist until they're
+// deleted or the process exits.
+type Fake struct {
+	mu    sync.Mutex
+	vms   map[string]hypervisor.VirtualMachineInfo
+	addrs uint32
+	cfg   Config
+
+	// booting is the number of VMs being created, which count against
+	// MaxVMs but aren't listed until they've booted
+	booting int
+
+	// snapshots are the images snapshots were taken of, by snapshot name
+	snapshots map[string]string
+
+	bootLatency     time.Duration
+	deleteLatency   time.Duration
+	shutdownLatency time.Duration
+}
+
+type Config struct {
+	// BootLatency and DeleteLatency are durations, such as "1.5s", that
+	// Create and Delete block for before returning.
+	BootLatency   string `json:"boot_latency"`
+	DeleteLatency string `json:"delete_latency"`
+
+	// ShutdownLatency is a duration a guest takes to shut down when it's
+	// deleted gracefully.
+	ShutdownLatency string `json:"shutdown_latency"`
+
+	// MaxVMs is the number of VMs that can exist at once, 0 is unlimited.
+	MaxVMs int `json:"max_vms"`
+
+	// Images, if not empty, are the only image names that can be created.
+	Images []string `json:"images"`
+
+	// UploadDirectory is where partial image uploads are kept, defaulting to
+	// a directory within the system's temporary directory.
+	UploadDirectory string `json:"upload_directory"`
+
+	// CreateFailureRate and DeleteFailureRate are the probability, between
+	// 0 and 1, that a call fails with ErrInjectedFault.
+	CreateFailureRate float64 `json:"create_failure_rate"`
+	DeleteFailureRate float64 `json:"delete_failure_rate"`
+}
+
+func New(config []byte) (*Fake, error) {
+	hv := &Fake{
+		vms:       make(map[string]hypervisor.VirtualMachineInfo),
+		snapshots: make(map[string]string),
+	}
+
+	if err := hv.configure(config); err != nil {
+		return nil, err
+	}
+
+	return hv, nil
+}
+
+func (hv *Fake) Init(ctx context.Context, config []byte) error {
+	return hv.configure(config)
+}
+
+func (hv *Fake) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Capabilities reports the fake's features. Its VMs are kept in memory, so
+// they never outlive the process, and resource overrides are ignored.
+func (hv *Fake) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	return hypervisor.Capabilities{
+		Features: []hypervisor.Feature{
+			hypervisor.FeatureListNames,
+			hypervisor.FeaturePortForwards,
+			hypervisor.FeatureExec,
+			hypervisor.FeatureImages,
+			hypervisor.FeatureImageUpload,
+			hypervisor.FeatureSnapshots,
+			hypervisor.FeatureGracefulDelete,
+		},
+		AddressFormat: hypervisor.AddressIP,
+		MaxVMs:        uint32(hv.cfg.MaxVMs),
+	}, nil
+}
+
+// Create ignores the resource overrides, as the fake has no resources to
+// configure. A VM restored from a snapshot is booted like any other, and
+// ports are returned as endpoints at the VM's address.
+func (hv *Fake) Create(ctx context.Context, name string, opts hypervisor.CreateOptions) (hypervisor.VirtualMachine, error) {
+	hv.mu.Lock()
+	cfg := hv.cfg
+	latency := hv.bootLatency
+	snapshotImage, snapshotOK := hv.snapshots[opts.Snapshot]
+	hv.mu.Unlock()
+
+	if len(cfg.Images) > 0 && !slices.Contains(cfg.Images, name) {
+		return nil, fmt.Errorf("%w: %s", hypervisor.ErrImageNotFound, name)
+	}
+
+	if opts.Snapshot != "" && (!snapshotOK || snapshotImage != name) {
+		return nil, fmt.Errorf("%w: %s of image %s", hypervisor.ErrSnapshotNotFound, opts.Snapshot, name)
+	}
+
+	id, err := hvutil.UniqueID()
+	if err != nil {
+		return nil, fmt.Errorf("generating unique id: %w", err)
+	}
+
+	vm := hypervisor.VirtualMachineInfo{
+		Id:   vmNamePrefix + id,
+		Name: name,
+	}
+
+	// reserve capacity before booting, so that concurrent creates can't
+	// exceed the limit
+	hv.mu.Lock()
+	if cfg.MaxVMs > 0 && len(hv.vms)+hv.booting >= cfg.MaxVMs {
+		hv.mu.Unlock()
+		return nil, ErrNoCapacity
+	}
+	hv.addrs++
+	vm.Addr = loopbackAddr(hv.addrs)
+	vm.Endpoints = hypervisor.SSHEndpoints(vm.Addr)
+	for _, port := range opts.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = hypervisor.ProtocolTCP
+		}
+		vm.Endpoints = append(vm.Endpoints, hypervisor.Endpoint{Host: vm.Addr, Port: port.Port, GuestPort: port.Port, Protocol: protocol, Purpose: port.Purpose})
+	}
+	hv.booting++
+	hv.mu.Unlock()
+
+	err = sleep(ctx, latency)
+	if err == nil && fail(cfg.CreateFailureRate) {
+		err = fmt.Errorf("starting vm: %w", ErrInjectedFault)
+	}
+
+	hv.mu.Lock()
+	hv.booting--
+	if err == nil {
+		hv.vms[vm.Id] = vm
+	}
+	hv.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hvutil.Logger("fake").Debug("vm started", "id", vm.Id, "name", name, "addr", vm.Addr)
+
+	return vm, nil
+}
+
+func (hv *Fake) Delete(ctx context.Context, id string) error {
+	hv.mu.Lock()
+	_, ok := hv.vms[id]
+	cfg := hv.cfg
+	latency := hv.deleteLatency
+	hv.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no vm (%v) found", id)
+	}
+
+	if err := sleep(ctx, latency); err != nil {
+		return err
+	}
+
+	if fail(cfg.DeleteFailureRate) {
+		return fmt.Errorf("stopping vm (%v): %w", id, ErrInjectedFault)
+	}
+
+	hv.mu.Lock()
+	delete(hv.vms, id)
+	hv.mu.Unlock()
+
+	hvutil.Logger("fake").Debug("vm deleted", "id", id)
+
+	return nil
+}
+
+// DeleteGracefully waits for the guest to shut down, which takes the shutdown
+// latency, or for the grace period if it's shorter, in which case the VM is
+// forcibly stopped.
+func (hv *Fake) DeleteGracefully(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	hv.mu.Lock()
+	_, ok := hv.vms[id]
+	latency := hv.shutdownLatency
+	hv.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("no vm (%v) found", id)
+	}
+
+	method := hypervisor.StopGraceful
+	if latency > grace {
+		latency = grace
+		method = hypervisor.StopForced
+	}
+
+	if err := sleep(ctx, latency); err != nil {
+		return "", err
+	}
+
+	if err := hv.Delete(ctx, id); err != nil {
+		return "", err
+	}
+
+	return method, nil
+}
+
+// Snapshot records the image the VM was created from under the snapshot's
+// name, and deletes the VM.
+func (hv *Fake) Snapshot(ctx context.Context, id, snapshot string) error {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	vm, ok := hv.vms[id]
+	if !ok {
+		return fmt.Errorf("no vm (%v) found", id)
+	}
+
+	if _, ok := hv.snapshots[snapshot]; ok {
+		return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotExists, snapshot)
+	}
+
+	hv.snapshots[snapshot] = vm.Name
+	delete(hv.vms, id)
+
+	hvutil.Logger("fake").Debug("vm snapshot saved", "id", id, "snapshot", snapshot)
+
+	return nil
+}
+
+// DeleteSnapshot forgets the snapshot.
+func (hv *Fake) DeleteSnapshot(ctx context.Context, snapshot string) error {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if _, ok := hv.snapshots[snapshot]; !ok {
+		return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotNotFound, snapshot)
+	}
+
+	delete(hv.snapshots, snapshot)
+
+	hvutil.Logger("fake").Debug("vm snapshot deleted", "snapshot", snapshot)
+
+	return nil
+}
+
+// Exec runs one of a few builtin commands, as the fake's VMs have no guest:
+// echo writes its arguments to stdout, cat copies stdin to stdout, and exit
+// exits with the code given. Any other command exits with 127.
+func (hv *Fake) Exec(ctx context.Context, id string, cmd hypervisor.ExecCommand) (int, error) {
+	hv.mu.Lock()
+	_, ok := hv.vms[id]
+	hv.mu.Unlock()
+
+	if !ok {
+		return 0, fmt.Errorf("no vm (%v) found", id)
+	}
+
+	if len(cmd.Args) == 0 {
+		return 0, fmt.Errorf("no command given")
+	}
+
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	switch cmd.Args[0] {
+	case "echo":
+		_, err := fmt.Fprintln(stdout, strings.Join(cmd.Args[1:], " "))
+		return 0, err
+
+	case "cat":
+		if cmd.Stdin == nil {
+			return 0, nil
+		}
+		_, err := io.Copy(stdout, cmd.Stdin)
+		return 0, err
+
+	case "exit":
+		if len(cmd.Args) < 2 {
+			return 0, nil
+		}
+		code, err := strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "exit: invalid code %q\n", cmd.Args[1])
+			return 2, nil
+		}
+		return code, nil
+	}
+
+	fmt.Fprintf(stderr, "%s: command not found\n", cmd.Args[0])
+	return 127, nil
+}
+
+// ListImages returns the configured images. Without any, every image name can
+// be created, and none are listed.
+func (hv *Fake) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	images := make([]hypervisor.Image, 0, len(hv.cfg.Images))
+	for _, name := range hv.cfg.Images {
+		images = append(images, hypervisor.Image{Name: name})
+	}
+
+	return images, nil
+}
+
+// ImportImage adds the image to the configured images, ignoring the source.
+// Importing an image restricts Create to the configured images, like
+// configuring images does.
+func (hv *Fake) ImportImage(ctx context.Context, name, source string) error {
+	if name == "" {
+		return fmt.Errorf("%w: %q", hypervisor.ErrInvalidImageName, name)
+	}
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if slices.Contains(hv.cfg.Images, name) {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageExists, name)
+	}
+
+	// Create reads the images without holding the lock
+	hv.cfg.Images = append(slices.Clip(hv.cfg.Images), name)
+
+	return nil
+}
+
+func (hv *Fake) UploadDirectory() string {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if hv.cfg.UploadDirectory != "" {
+		return hv.cfg.UploadDirectory
+	}
+	return filepath.Join(os.TempDir(), "nesting-fake-uploads")
+}
+
+// ImportArchive adds the image to the configured images, like ImportImage,
+// and removes the archive.
+func (hv *Fake) ImportArchive(ctx context.Context, name, path string) error {
+	if err := hv.ImportImage(ctx, name, path); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (hv *Fake) DeleteImage(ctx context.Context, name string) error {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if !slices.Contains(hv.cfg.Images, name) {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageNotFound, name)
+	}
+
+	hv.cfg.Images = slices.DeleteFunc(slices.Clone(hv.cfg.Images), func(image string) bool {
+		return image == name
+	})
+
+	return nil
+}
+
+func (hv *Fake) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	vms := make([]hypervisor.VirtualMachine, 0, len(hv.vms))
+	for _, vm := range hv.vms {
+		vms = append(vms, vm)
+	}
+
+	return vms, nil
+}
+
+func (hv *Fake) configure(config []byte) error {
+	if len(config) == 0 {
+		return nil
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	bootLatency, err := parseDuration(cfg.BootLatency)
+	if err != nil {
+		return fmt.Errorf("invalid config: boot_latency: %w", err)
+	}
+
+	deleteLatency, err := parseDuration(cfg.DeleteLatency)
+	if err != nil {
+		return fmt.Errorf("invalid config: delete_latency: %w", err)
+	}
+
+	shutdownLatency, err := parseDuration(cfg.ShutdownLatency)
+	if err != nil {
+		return fmt.Errorf("invalid config: shutdown_latency: %w", err)
+	}
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	hv.cfg = cfg
+	hv.bootLatency = bootLatency
+	hv.deleteLatency = deleteLatency
+	hv.shutdownLatency = shutdownLatency
+
+	return nil
+}
+
+// loopbackAddr returns a unique address within 127.0.0.0/8, skipping
+// 127.0.0.0 and 127.0.0.1.
+func loopbackAddr(n uint32) string {
+	n++
+
+	return fmt.Sprintf("127.%d.%d.%d", byte(n>>16), byte(n>>8), byte(n))
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func fail(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
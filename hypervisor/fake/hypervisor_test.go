@@ -0,0 +1,301 @@
+package fake
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestLifecycle(t *testing.T) {
+	hv, err := New(nil)
+	require.NoError(t, err)
+	require.NoError(t, hv.Init(context.Background(), nil))
+
+	vm1, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "image", vm1.GetName())
+	assert.Equal(t, "127.0.0.2", vm1.GetAddr())
+	assert.Equal(t, []hypervisor.Endpoint{
+		{Host: "127.0.0.2", Port: 22, GuestPort: 22, Protocol: hypervisor.ProtocolTCP, Purpose: hypervisor.PurposeSSH},
+	}, hypervisor.Endpoints(vm1))
+
+	vm2, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.3", vm2.GetAddr())
+	assert.NotEqual(t, vm1.GetId(), vm2.GetId())
+
+	vms, err := hv.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, vms, 2)
+
+	require.NoError(t, hv.Delete(context.Background(), vm1.GetId()))
+	assert.Error(t, hv.Delete(context.Background(), vm1.GetId()))
+
+	vms, err = hv.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	assert.Equal(t, vm2.GetId(), vms[0].GetId())
+
+	require.NoError(t, hv.Shutdown(context.Background()))
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("capacity", func(t *testing.T) {
+		hv, err := New([]byte(`{"max_vms": 1}`))
+		require.NoError(t, err)
+
+		vm, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, ErrNoCapacity)
+
+		require.NoError(t, hv.Delete(context.Background(), vm.GetId()))
+
+		_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("images", func(t *testing.T) {
+		hv, err := New([]byte(`{"images": ["known"]}`))
+		require.NoError(t, err)
+
+		_, err = hv.Create(context.Background(), "unknown", hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, hypervisor.ErrImageNotFound)
+
+		_, err = hv.Create(context.Background(), "known", hypervisor.CreateOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("failure injection", func(t *testing.T) {
+		hv, err := New(nil)
+		require.NoError(t, err)
+
+		vm, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, hv.Init(context.Background(), []byte(`{"create_failure_rate": 1, "delete_failure_rate": 1}`)))
+
+		_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, ErrInjectedFault)
+
+		assert.ErrorIs(t, hv.Delete(context.Background(), vm.GetId()), ErrInjectedFault)
+
+		// failed creates don't leave a vm behind, failed deletes do
+		vms, err := hv.List(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, vms, 1)
+	})
+
+	t.Run("boot latency", func(t *testing.T) {
+		hv, err := New([]byte(`{"boot_latency": "50ms"}`))
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = hv.Create(ctx, "image", hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("booting", func(t *testing.T) {
+		hv, err := New([]byte(`{"boot_latency": "200ms", "max_vms": 1}`))
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			_, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+			done <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			hv.mu.Lock()
+			defer hv.mu.Unlock()
+
+			return hv.booting == 1
+		}, time.Second, 5*time.Millisecond)
+
+		// a vm being booted counts against max_vms, but isn't listed yet
+		_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, ErrNoCapacity)
+
+		vms, err := hv.List(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, vms)
+
+		require.NoError(t, <-done)
+
+		vms, err = hv.List(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, vms, 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New([]byte(`{"boot_latency": "soon"}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestExec(t *testing.T) {
+	hv, err := New(nil)
+	require.NoError(t, err)
+
+	vm, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+
+	exec := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr strings.Builder
+		code, err := hv.Exec(context.Background(), vm.GetId(), hypervisor.ExecCommand{
+			Args:   args,
+			Stdin:  strings.NewReader(stdin),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		require.NoError(t, err)
+		return code, stdout.String(), stderr.String()
+	}
+
+	code, stdout, _ := exec("", "echo", "hello", "world")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "hello world\n", stdout)
+
+	code, stdout, _ = exec("input", "cat")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "input", stdout)
+
+	code, _, _ = exec("", "exit", "3")
+	assert.Equal(t, 3, code)
+
+	code, _, stderr := exec("", "uname")
+	assert.Equal(t, 127, code)
+	assert.Equal(t, "uname: command not found\n", stderr)
+
+	_, err = hv.Exec(context.Background(), "unknown", hypervisor.ExecCommand{Args: []string{"echo"}})
+	assert.Error(t, err)
+}
+
+func TestImages(t *testing.T) {
+	hv, err := New([]byte(`{"images": ["image"]}`))
+	require.NoError(t, err)
+
+	images, err := hv.ListImages(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image"}}, images)
+
+	assert.ErrorIs(t, hv.ImportImage(context.Background(), "image", "/source"), hypervisor.ErrImageExists)
+	require.NoError(t, hv.ImportImage(context.Background(), "other", "/source"))
+
+	_, err = hv.Create(context.Background(), "other", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, hv.DeleteImage(context.Background(), "image"))
+	assert.ErrorIs(t, hv.DeleteImage(context.Background(), "image"), hypervisor.ErrImageNotFound)
+
+	_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	assert.ErrorIs(t, err, hypervisor.ErrImageNotFound)
+
+	images, err = hv.ListImages(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "other"}}, images)
+}
+
+func TestSnapshot(t *testing.T) {
+	hv, err := New(nil)
+	require.NoError(t, err)
+
+	vm, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{Snapshot: "warm"})
+	assert.ErrorIs(t, err, hypervisor.ErrSnapshotNotFound)
+
+	require.NoError(t, hv.Snapshot(context.Background(), vm.GetId(), "warm"))
+	assert.Error(t, hv.Snapshot(context.Background(), vm.GetId(), "warm"))
+
+	vms, err := hv.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	restored, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{Snapshot: "warm"})
+	require.NoError(t, err)
+	assert.Equal(t, "image", restored.GetName())
+
+	assert.ErrorIs(t, hv.Snapshot(context.Background(), restored.GetId(), "warm"), hypervisor.ErrSnapshotExists)
+
+	// snapshots are only restored as the image they were taken of
+	_, err = hv.Create(context.Background(), "other", hypervisor.CreateOptions{Snapshot: "warm"})
+	assert.ErrorIs(t, err, hypervisor.ErrSnapshotNotFound)
+
+	// vms restored from a deleted snapshot are unaffected
+	require.NoError(t, hv.DeleteSnapshot(context.Background(), "warm"))
+	assert.ErrorIs(t, hv.DeleteSnapshot(context.Background(), "warm"), hypervisor.ErrSnapshotNotFound)
+
+	_, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{Snapshot: "warm"})
+	assert.ErrorIs(t, err, hypervisor.ErrSnapshotNotFound)
+
+	vms, err = hv.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, vms, 1)
+}
+
+func TestDeleteGracefully(t *testing.T) {
+	hv, err := New([]byte(`{"shutdown_latency": "50ms"}`))
+	require.NoError(t, err)
+
+	vm, err := hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+
+	// the guest doesn't shut down within the grace period
+	method, err := hv.DeleteGracefully(context.Background(), vm.GetId(), 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, hypervisor.StopForced, method)
+
+	vm, err = hv.Create(context.Background(), "image", hypervisor.CreateOptions{})
+	require.NoError(t, err)
+
+	method, err = hv.DeleteGracefully(context.Background(), vm.GetId(), time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, hypervisor.StopGraceful, method)
+
+	vms, err := hv.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	_, err = hv.DeleteGracefully(context.Background(), vm.GetId(), time.Second)
+	assert.Error(t, err)
+}
+
+func TestCapabilities(t *testing.T) {
+	hv, err := New([]byte(`{"max_vms": 2}`))
+	require.NoError(t, err)
+
+	caps, err := hv.Capabilities(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), caps.MaxVMs)
+
+	// the optional interface features match the interfaces implemented
+	var h hypervisor.Hypervisor = hv
+	_, ok := h.(hypervisor.Notifier)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureEvents))
+	_, ok = h.(hypervisor.Executor)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureExec))
+	_, ok = h.(hypervisor.ImageManager)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureImages))
+	_, ok = h.(hypervisor.ImageUploader)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureImageUpload))
+	_, ok = h.(hypervisor.Snapshotter)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureSnapshots))
+	_, ok = h.(hypervisor.GracefulDeleter)
+	assert.Equal(t, ok, caps.Has(hypervisor.FeatureGracefulDelete))
+}
@@ -2,6 +2,37 @@ package hypervisor
 
 import (
 	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidOption is returned, wrapped, by Create when the hypervisor cannot
+// honour one of the CreateOptions.
+var ErrInvalidOption = errors.New("invalid create option")
+
+// Errors returned, wrapped, by the ImageManager methods. ErrInvalidImageName
+// is also returned by Create, for names that aren't an image's.
+var (
+	ErrImageNotFound    = errors.New("image not found")
+	ErrImageExists      = errors.New("image already exists")
+	ErrInvalidImageName = errors.New("invalid image name")
+)
+
+// ErrImageVerification is returned, wrapped, by Create when the image doesn't
+// match its manifest, or its manifest isn't signed by a trusted key.
+var ErrImageVerification = errors.New("image failed verification")
+
+// Errors returned, wrapped, by Snapshot and DeleteSnapshot, and by Create when
+// restoring a snapshot. ErrSnapshotInUse is returned by hypervisors that can
+// only run one VM restored from a snapshot at a time.
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotExists   = errors.New("snapshot already exists")
+	ErrSnapshotInUse    = errors.New("snapshot in use")
 )
 
 //go:generate mockery --name=Hypervisor --with-expecter
@@ -9,11 +40,201 @@ type Hypervisor interface {
 	Init(ctx context.Context, config []byte) error
 	Shutdown(ctx context.Context) error
 
-	Create(ctx context.Context, name string) (VirtualMachine, error)
+	// Capabilities reports what the hypervisor supports. It's only called
+	// once the hypervisor is initialized, as they can depend on its config.
+	Capabilities(ctx context.Context) (Capabilities, error)
+
+	Create(ctx context.Context, name string, opts CreateOptions) (VirtualMachine, error)
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context) ([]VirtualMachine, error)
 }
 
+// Capabilities describe what a hypervisor supports, so that clients can adapt
+// to it rather than to the driver.
+type Capabilities struct {
+	// Version is the version of the virtualization software the driver
+	// uses, such as Tart's, or empty if it's unknown.
+	Version string
+
+	Features      []Feature
+	AddressFormat AddressFormat
+
+	// MaxVMs is how many VMs the hypervisor can run at once, or zero if it
+	// doesn't limit them.
+	MaxVMs uint32
+}
+
+// Has reports whether the feature is supported.
+func (c Capabilities) Has(feature Feature) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+type Feature string
+
+const (
+	// FeatureListNames is set if List returns the image name of each VM.
+	FeatureListNames Feature = "list_names"
+
+	// FeaturePersistentVMs is set if VMs outlive the server process, so a VM
+	// created in a slot can still exist after a restart, until the slot is
+	// reused.
+	FeaturePersistentVMs Feature = "persistent_vms"
+
+	// FeatureResourceOverrides is set if Create honours CreateOptions'
+	// resource overrides.
+	FeatureResourceOverrides Feature = "resource_overrides"
+
+	// FeaturePortForwards is set if Create honours CreateOptions' port
+	// forwards.
+	FeaturePortForwards Feature = "port_forwards"
+
+	// The remaining features are set if the hypervisor implements the
+	// matching optional interface: Notifier, Executor, ImageManager,
+	// ImageUploader, Snapshotter and GracefulDeleter.
+	FeatureEvents         Feature = "events"
+	FeatureExec           Feature = "exec"
+	FeatureImages         Feature = "images"
+	FeatureImageUpload    Feature = "image_upload"
+	FeatureSnapshots      Feature = "snapshots"
+	FeatureGracefulDelete Feature = "graceful_delete"
+)
+
+// AddressFormat is the format of a VM's address.
+type AddressFormat string
+
+const (
+	// AddressIP is a bare IP address, with the guest's services on their
+	// usual ports.
+	AddressIP AddressFormat = "ip"
+
+	// AddressHostPort is a host:port, forwarded to the guest's SSH port.
+	AddressHostPort AddressFormat = "host_port"
+)
+
+// Notifier is an optional interface for hypervisors that can report VM state
+// changes that happen outside of Create and Delete, such as a VM stopping
+// unexpectedly.
+type Notifier interface {
+	Notify(fn func(Event))
+}
+
+// Executor is an optional interface for hypervisors that can run commands
+// inside a VM's guest.
+type Executor interface {
+	// Exec runs the command to completion and returns its exit code. An error
+	// is only returned if the command couldn't be run, not if it exited with a
+	// non-zero code.
+	Exec(ctx context.Context, id string, cmd ExecCommand) (exitCode int, err error)
+}
+
+// ImageManager is an optional interface for hypervisors that can manage the
+// images VMs are created from.
+type ImageManager interface {
+	ListImages(ctx context.Context) ([]Image, error)
+
+	// ImportImage copies the image at source, a path on the hypervisor's
+	// host, into the hypervisor's images as name. The format of source
+	// depends on the hypervisor.
+	ImportImage(ctx context.Context, name, source string) error
+
+	DeleteImage(ctx context.Context, name string) error
+}
+
+// ImageUploader is an optional interface for hypervisors that can import
+// images uploaded as an archive, a zstd compressed tar.
+type ImageUploader interface {
+	// UploadDirectory is where partial uploads are kept. It's on the same
+	// filesystem as the images, so that a complete upload can be moved into
+	// place.
+	UploadDirectory() string
+
+	// ImportArchive imports the complete and verified archive at path as an
+	// image, taking ownership of the file.
+	ImportArchive(ctx context.Context, name, path string) error
+}
+
+// Snapshotter is an optional interface for hypervisors that can save a VM's
+// state, so that VMs can be created by restoring it instead of booting. Create
+// restores the snapshot named by CreateOptions.Snapshot, which must have been
+// taken of a VM of the same image.
+type Snapshotter interface {
+	// Snapshot saves the running VM's memory and device state, along with its
+	// disk, as the named snapshot. The VM is stopped, and no longer exists
+	// once the snapshot is saved.
+	Snapshot(ctx context.Context, id, snapshot string) error
+
+	// DeleteSnapshot deletes the named snapshot. VMs already restored from
+	// it are unaffected, though hypervisors that can't delete a snapshot
+	// while a VM restored from it is running return ErrSnapshotInUse.
+	DeleteSnapshot(ctx context.Context, snapshot string) error
+}
+
+// GracefulDeleter is an optional interface for hypervisors that can ask a VM's
+// guest to shut down before it's deleted, so that it can flush its caches or
+// upload artifacts.
+type GracefulDeleter interface {
+	// DeleteGracefully requests the guest shuts down, waits up to grace for
+	// it to, and forcibly stops the VM if it hasn't, before deleting it. It
+	// reports how the VM was stopped.
+	DeleteGracefully(ctx context.Context, id string, grace time.Duration) (StopMethod, error)
+}
+
+// StopMethod is how a deleted VM was stopped.
+type StopMethod string
+
+const (
+	// StopGraceful is a guest that shut down within the grace period.
+	StopGraceful StopMethod = "graceful"
+
+	// StopForced is a VM that was forcibly stopped, as there was no grace
+	// period, the guest didn't shut down within it, or it couldn't be asked
+	// to.
+	StopForced StopMethod = "forced"
+)
+
+// Image is an image VMs can be created from. SizeBytes is zero if the
+// hypervisor doesn't report it.
+type Image struct {
+	Name      string
+	SizeBytes uint64
+}
+
+// ExecCommand is a command to run inside a guest. Stdin is read until EOF, and
+// may be nil for no input.
+type ExecCommand struct {
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// CreateOptions override the resources an image would otherwise give a VM.
+// Zero values use the image's defaults.
+type CreateOptions struct {
+	CPUs          uint32
+	MemoryBytes   uint64
+	DiskSizeBytes uint64
+
+	// Snapshot, if set, is the snapshot the VM is restored from, instead of
+	// being booted. Only hypervisors implementing Snapshotter support it.
+	Snapshot string
+
+	// Ports are guest ports, in addition to the image's, that the VM is to
+	// be reachable on. Each is returned as one of the VM's endpoints.
+	Ports []PortForward
+}
+
+// PortForward is a guest port a VM is to be reachable on, such as WinRM's or
+// an application's. Hypervisors whose guests can't be reached at their own
+// address forward a host port to it.
+type PortForward struct {
+	Port uint16 `json:"port"`
+
+	// Protocol defaults to tcp.
+	Protocol string `json:"protocol,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+}
+
 type VirtualMachine interface {
 	GetId() string
 	GetName() string
@@ -24,6 +245,10 @@ type VirtualMachineInfo struct {
 	Id   string
 	Name string
 	Addr string
+
+	// Endpoints are the services the VM can be reached on. Addr remains set
+	// for clients that only know about a single address.
+	Endpoints []Endpoint
 }
 
 func (vmi VirtualMachineInfo) GetId() string {
@@ -37,3 +262,83 @@ func (vmi VirtualMachineInfo) GetName() string {
 func (vmi VirtualMachineInfo) GetAddr() string {
 	return vmi.Addr
 }
+
+func (vmi VirtualMachineInfo) GetEndpoints() []Endpoint {
+	return vmi.Endpoints
+}
+
+// Protocols an endpoint is reached over.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// Purposes of the services endpoints are for.
+const (
+	PurposeSSH   = "ssh"
+	PurposeRDP   = "rdp"
+	PurposeWinRM = "winrm"
+)
+
+// Endpoint is a service a VM can be reached on, at host and port. GuestPort is
+// the port in the guest it reaches, which differs from Port when it's
+// forwarded from the host.
+type Endpoint struct {
+	Host      string `json:"host"`
+	Port      uint16 `json:"port"`
+	GuestPort uint16 `json:"guest_port,omitempty"`
+	Protocol  string `json:"protocol"`
+	Purpose   string `json:"purpose"`
+}
+
+// String returns the endpoint's host:port.
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(int(e.Port)))
+}
+
+// Endpoints returns the endpoints the VM reports, or nil if it doesn't report
+// any.
+func Endpoints(vm VirtualMachine) []Endpoint {
+	if vm, ok := vm.(interface{ GetEndpoints() []Endpoint }); ok {
+		return vm.GetEndpoints()
+	}
+	return nil
+}
+
+// SSHEndpoints returns the SSH endpoint of an address, either an IP, on port
+// 22, or a host:port forwarded to the guest's port 22, or nil if the address
+// is empty or invalid.
+func SSHEndpoints(addr string) []Endpoint {
+	if addr == "" {
+		return nil
+	}
+
+	host, port := addr, uint64(22)
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil
+		}
+		host, port = h, n
+	}
+
+	return []Endpoint{{Host: host, Port: uint16(port), GuestPort: 22, Protocol: ProtocolTCP, Purpose: PurposeSSH}}
+}
+
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventRunning EventType = "running"
+	EventStopped EventType = "stopped"
+	EventErrored EventType = "errored"
+	EventDeleted EventType = "deleted"
+)
+
+type Event struct {
+	Type   EventType
+	Id     string
+	Name   string
+	Time   time.Time
+	Reason string
+}
@@ -0,0 +1,65 @@
+package hvutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
+)
+
+// execWaitDelay is how long to wait for output to be copied once a command
+// has exited, in case a process it started still holds stdout or stderr open.
+const execWaitDelay = time.Second
+
+// Exec runs a command that proxies a guest command's stdio, such as prlctl
+// exec, and returns its exit code, which is taken to be the guest command's.
+//
+// Stdin is copied until the command exits, rather than until EOF, so that a
+// caller that never closes it doesn't block Exec. A read already in progress
+// when the command exits only returns once the caller closes stdin.
+func Exec(ctx context.Context, commands []string, cmd hypervisor.ExecCommand) (int, error) {
+	c := exec.CommandContext(ctx, commands[0], commands[1:]...)
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	c.WaitDelay = execWaitDelay
+
+	var stdin io.WriteCloser
+	if cmd.Stdin != nil {
+		var err error
+		if stdin, err = c.StdinPipe(); err != nil {
+			return 0, fmt.Errorf("creating stdin pipe: %w", err)
+		}
+	}
+
+	start := time.Now()
+	err := c.Start()
+	if err == nil {
+		if stdin != nil {
+			go func() {
+				io.Copy(stdin, cmd.Stdin)
+				stdin.Close()
+			}()
+		}
+		err = c.Wait()
+	}
+
+	// the guest command exiting with a non-zero code isn't a failure of the
+	// proxying command
+	if c.ProcessState != nil && ctx.Err() == nil {
+		LogCommand(ctx, commands, start, nil, "")
+		metrics.ObserveCommand(commands[0], commands[1], nil)
+		return c.ProcessState.ExitCode(), nil
+	}
+
+	LogCommand(ctx, commands, start, err, "")
+	metrics.ObserveCommand(commands[0], commands[1], err)
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	return 0, fmt.Errorf("%s: %w", commands[0], err)
+}
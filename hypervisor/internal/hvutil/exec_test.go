@@ -0,0 +1,64 @@
+package hvutil
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	var stdout, stderr strings.Builder
+	exitCode, err := Exec(context.Background(), []string{"sh", "-c", "cat; echo oops >&2; exit 3"}, hypervisor.ExecCommand{
+		Stdin:  strings.NewReader("hello"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "hello", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestExecUnclosedStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// the command exiting without reading stdin returns, even though stdin is
+	// never closed
+	stdin, _ := io.Pipe()
+	defer stdin.Close()
+
+	exitCode, err := Exec(context.Background(), []string{"sh", "-c", "exit 0"}, hypervisor.ExecCommand{Stdin: stdin})
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+}
+
+func TestExecNotFound(t *testing.T) {
+	_, err := Exec(context.Background(), []string{"nesting-no-such-command", "exec"}, hypervisor.ExecCommand{})
+	require.Error(t, err)
+}
+
+func TestExecCancelled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := Exec(ctx, []string{"sh", "-c", "sleep 10"}, hypervisor.ExecCommand{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
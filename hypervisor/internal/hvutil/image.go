@@ -0,0 +1,216 @@
+package hvutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// ImagePath returns the path of an image stored in dir as <name><suffix>,
+// for drivers that keep images as files or directories. Names that could
+// escape dir are invalid.
+func ImagePath(dir, name, suffix string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: %q", hypervisor.ErrInvalidImageName, name)
+	}
+
+	return filepath.Join(dir, name+suffix), nil
+}
+
+// ListImages returns the images stored in dir as <name><suffix>. Hidden
+// entries, such as imports in progress, are skipped, and a dir that doesn't
+// exist has no images.
+func ListImages(dir, suffix string) ([]hypervisor.Image, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading image directory: %w", err)
+	}
+
+	var images []hypervisor.Image
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), suffix)
+		if !ok || name == "" || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		size, err := pathSize(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading image %q size: %w", name, err)
+		}
+
+		images = append(images, hypervisor.Image{Name: name, SizeBytes: size})
+	}
+
+	return images, nil
+}
+
+// ImportImage copies the file or directory at source to path.
+func ImportImage(ctx context.Context, source, path string) error {
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("reading import source: %w", err)
+	}
+
+	return ImportImageFunc(path, func(dst string) error {
+		if err := copyPath(ctx, source, dst); err != nil {
+			return fmt.Errorf("copying %s: %w", source, err)
+		}
+		return nil
+	})
+}
+
+// ImportImageFunc imports an image to path, with fn creating it at dst. dst is
+// alongside path and renamed into place once fn returns, so that a failed or
+// cancelled import never leaves a partial image behind.
+func ImportImageFunc(path string, fn func(dst string) error) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageExists, filepath.Base(path))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return fmt.Errorf("creating image directory: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+".import-")
+	if err != nil {
+		return fmt.Errorf("creating import directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dst := filepath.Join(tmp, filepath.Base(path))
+	if err := fn(dst); err != nil {
+		return err
+	}
+
+	// a concurrent import of the same image may have finished first
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageExists, filepath.Base(path))
+	}
+
+	if err := os.Rename(dst, path); err != nil {
+		return fmt.Errorf("renaming import: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteImage removes the file or directory at path.
+func DeleteImage(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageNotFound, filepath.Base(path))
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("deleting image: %w", err)
+	}
+
+	return nil
+}
+
+func copyPath(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, 0o777)
+
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case d.Type().IsRegular():
+			return copyFile(ctx, path, target)
+
+		default:
+			return fmt.Errorf("unsupported file type %s: %s", d.Type(), rel)
+		}
+	})
+}
+
+func copyFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, ContextReader(ctx, in)); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// ContextReader returns a reader of r that stops reading once ctx is done, so
+// that copying or hashing large files can be cancelled.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func pathSize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += uint64(fi.Size())
+		return nil
+	})
+
+	return size, err
+}
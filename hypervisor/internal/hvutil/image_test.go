@@ -0,0 +1,73 @@
+package hvutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestImagePath(t *testing.T) {
+	path, err := ImagePath("/images", "macos-14", ".pvm")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/images", "macos-14.pvm"), path)
+
+	for _, name := range []string{"", ".", "..", "../escape", "a/b", `a\b`, ".hidden"} {
+		_, err := ImagePath("/images", name, ".pvm")
+		assert.ErrorIs(t, err, hypervisor.ErrInvalidImageName, name)
+	}
+}
+
+func TestImages(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source")
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "sub"), 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "config.json"), []byte("{}"), 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "sub", "disk.img"), make([]byte, 1024), 0o666))
+
+	dir := filepath.Join(t.TempDir(), "images")
+
+	images, err := ListImages(dir, ".pvm")
+	require.NoError(t, err)
+	assert.Empty(t, images)
+
+	path, err := ImagePath(dir, "image", ".pvm")
+	require.NoError(t, err)
+	require.NoError(t, ImportImage(context.Background(), source, path))
+	require.ErrorIs(t, ImportImage(context.Background(), source, path), hypervisor.ErrImageExists)
+
+	data, err := os.ReadFile(filepath.Join(path, "sub", "disk.img"))
+	require.NoError(t, err)
+	assert.Len(t, data, 1024)
+
+	// unrelated and hidden entries aren't images
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.qcow2"), nil, 0o666))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".partial.pvm"), 0o777))
+
+	images, err = ListImages(dir, ".pvm")
+	require.NoError(t, err)
+	assert.Equal(t, []hypervisor.Image{{Name: "image", SizeBytes: 1026}}, images)
+
+	require.NoError(t, DeleteImage(path))
+	require.ErrorIs(t, DeleteImage(path), hypervisor.ErrImageNotFound)
+}
+
+func TestImportImageCancelled(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "disk.qcow2")
+	require.NoError(t, os.WriteFile(source, make([]byte, 1024), 0o666))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dir := t.TempDir()
+	require.ErrorIs(t, ImportImage(ctx, source, filepath.Join(dir, "image.qcow2")), context.Canceled)
+
+	// nothing is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,44 @@
+package hvutil
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Logger returns the default logger, annotated with the hypervisor's name.
+func Logger(hypervisor string) *slog.Logger {
+	return slog.Default().With("hypervisor", hypervisor)
+}
+
+// LogCommand logs a command run by a driver's control package. Successful
+// commands are logged at debug level, failed commands at warn level along with
+// their exit code and stderr, as some failures are expected and handled by the
+// caller.
+func LogCommand(ctx context.Context, commands []string, start time.Time, err error, stderr string) {
+	attrs := []slog.Attr{
+		slog.String("command", strings.Join(commands, " ")),
+		slog.Duration("duration", time.Since(start)),
+	}
+
+	if err == nil {
+		slog.LogAttrs(ctx, slog.LevelDebug, "command succeeded", attrs...)
+		return
+	}
+
+	exitCode := -1
+	var errExit *exec.ExitError
+	if errors.As(err, &errExit) {
+		exitCode = errExit.ExitCode()
+	}
+
+	attrs = append(attrs,
+		slog.Int("exit_code", exitCode),
+		slog.String("stderr", strings.TrimSpace(stderr)),
+		slog.Any("error", err),
+	)
+	slog.LogAttrs(ctx, slog.LevelWarn, "command failed", attrs...)
+}
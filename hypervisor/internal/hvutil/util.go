@@ -3,6 +3,14 @@ package hvutil
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+const (
+	MiB = 1 << 20
+	GiB = 1 << 30
 )
 
 func UniqueID() (string, error) {
@@ -30,3 +38,14 @@ func GenerateMAC() (string, error) {
 
 	return hex.EncodeToString(b), nil
 }
+
+// WholeUnits converts a size in bytes into a whole number of units, for
+// drivers that can only be configured in MiB or GiB. A size that isn't a
+// multiple of unit is an invalid option.
+func WholeUnits(field string, bytes, unit uint64) (int, error) {
+	if bytes%unit != 0 {
+		return 0, fmt.Errorf("%w: %s must be a multiple of %d bytes", hypervisor.ErrInvalidOption, field, unit)
+	}
+
+	return int(bytes / unit), nil
+}
@@ -0,0 +1,262 @@
+// Package integrity verifies images against their manifests, the sha256
+// digests of the image's files, optionally signed with a trusted ed25519 key.
+//
+// An image's manifest is kept alongside it, as <image>.manifest.json, and its
+// detached signature, the base64 encoded ed25519 signature of the manifest,
+// as <image>.manifest.json.sig. The manifest's paths are relative to the
+// directory the image is in, and have to be within the image:
+//
+//	{"files": {"macos-14/disk.img": "sha256:9f86d0..."}}
+package integrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+)
+
+const (
+	manifestSuffix  = ".manifest.json"
+	signatureSuffix = manifestSuffix + ".sig"
+
+	// maxManifestSize is the largest manifest read.
+	maxManifestSize = 1 << 20
+)
+
+// Config is embedded in drivers' configs.
+type Config struct {
+	// TrustedKeys are the base64 encoded ed25519 public keys manifests are
+	// signed with. With any, a manifest has to be signed by one of them.
+	TrustedKeys []string `json:"trusted_keys"`
+
+	// RequireManifest refuses images without a manifest.
+	RequireManifest bool `json:"require_manifest"`
+}
+
+// Manifest is the sha256 digests of an image's files, hex encoded and
+// optionally prefixed with "sha256:", by path.
+type Manifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// Verifier verifies images the first time they're used, and caches the
+// images that pass until they're forgotten.
+type Verifier struct {
+	keys            []ed25519.PublicKey
+	requireManifest bool
+
+	mu     sync.Mutex
+	images map[string]*image
+}
+
+type image struct {
+	mu       sync.Mutex
+	verified bool
+}
+
+func New(cfg Config) (*Verifier, error) {
+	v := &Verifier{
+		requireManifest: cfg.RequireManifest,
+		images:          make(map[string]*image),
+	}
+
+	for _, key := range cfg.TrustedKeys {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid config: trusted_keys: invalid ed25519 public key %q", key)
+		}
+		v.keys = append(v.keys, ed25519.PublicKey(raw))
+	}
+
+	return v, nil
+}
+
+// Verify verifies the image at path against its manifest, unless it already
+// has been. Images without a manifest pass, unless one is required. Failures
+// wrap hypervisor.ErrImageVerification.
+func (v *Verifier) Verify(ctx context.Context, path string) error {
+	v.mu.Lock()
+	img, ok := v.images[key(path)]
+	if !ok {
+		img = &image{}
+		v.images[key(path)] = img
+	}
+	v.mu.Unlock()
+
+	// concurrent creates of the same image wait for a single verification
+	img.mu.Lock()
+	defer img.mu.Unlock()
+
+	if img.verified {
+		return nil
+	}
+
+	manifest, err := v.manifest(path)
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	if err := verifyFiles(ctx, path, manifest); err != nil {
+		return err
+	}
+
+	img.verified = true
+
+	return nil
+}
+
+// Forget drops the result cached for the image at path, as it's being
+// replaced or deleted.
+func (v *Verifier) Forget(path string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.images, key(path))
+}
+
+// key is the path images are cached by, so that a relative and an absolute
+// path to the same image are forgotten together.
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// manifest reads the image's manifest, and verifies its signature if there
+// are trusted keys. It returns nil if the image has no manifest and none is
+// required.
+func (v *Verifier) manifest(path string) (*Manifest, error) {
+	raw, err := readFile(path+manifestSuffix, maxManifestSize)
+	if errors.Is(err, os.ErrNotExist) {
+		if !v.requireManifest {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: no manifest", hypervisor.ErrImageVerification)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	if len(v.keys) > 0 {
+		if err := v.verifySignature(path, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", hypervisor.ErrImageVerification, err)
+	}
+	if len(manifest.Files) == 0 {
+		return nil, fmt.Errorf("%w: manifest has no files", hypervisor.ErrImageVerification)
+	}
+
+	return &manifest, nil
+}
+
+func (v *Verifier) verifySignature(path string, manifest []byte) error {
+	raw, err := readFile(path+signatureSuffix, maxManifestSize)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: manifest isn't signed", hypervisor.ErrImageVerification)
+	}
+	if err != nil {
+		return fmt.Errorf("reading manifest signature: %w", err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return fmt.Errorf("%w: invalid manifest signature: %w", hypervisor.ErrImageVerification, err)
+	}
+
+	for _, key := range v.keys {
+		if ed25519.Verify(key, manifest, sig) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: manifest isn't signed by a trusted key", hypervisor.ErrImageVerification)
+}
+
+// verifyFiles checks the digest of each of the manifest's files, which have
+// to be regular files within the image at imagePath.
+func verifyFiles(ctx context.Context, imagePath string, manifest *Manifest) error {
+	dir, base := filepath.Split(imagePath)
+
+	for name, want := range manifest.Files {
+		clean := path.Clean(name)
+		if !filepath.IsLocal(clean) || (clean != base && !strings.HasPrefix(clean, base+"/")) {
+			return fmt.Errorf("%w: manifest file %q is outside the image", hypervisor.ErrImageVerification, name)
+		}
+
+		got, err := digest(ctx, filepath.Join(dir, filepath.FromSlash(clean)))
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			return fmt.Errorf("%w: %s: %w", hypervisor.ErrImageVerification, name, err)
+		}
+
+		if !strings.EqualFold(strings.TrimPrefix(want, "sha256:"), got) {
+			return fmt.Errorf("%w: %s has digest sha256:%s, expected %s", hypervisor.ErrImageVerification, name, got, want)
+		}
+	}
+
+	return nil
+}
+
+// digest returns the hex encoded sha256 digest of the regular file at path.
+func digest(ctx context.Context, path string) (string, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("not a regular file")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, hvutil.ContextReader(ctx, f)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readFile(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > max {
+		return nil, fmt.Errorf("larger than %d bytes", max)
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,217 @@
+package integrity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeImage writes a directory image, macos-14, with a disk, returning its
+// path and a manifest for it.
+func writeImage(t *testing.T) (string, Manifest) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "macos-14")
+	require.NoError(t, os.Mkdir(path, 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "disk.img"), []byte("disk"), 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "nvram.bin"), []byte("nvram"), 0o666))
+
+	return path, Manifest{Files: map[string]string{
+		"macos-14/disk.img":  "sha256:" + sha256Hex([]byte("disk")),
+		"macos-14/nvram.bin": sha256Hex([]byte("nvram")),
+	}}
+}
+
+// writeManifest writes the image's manifest, and its signature if key is set.
+func writeManifest(t *testing.T, path string, manifest Manifest, key ed25519.PrivateKey) {
+	t.Helper()
+
+	raw, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+manifestSuffix, raw, 0o666))
+
+	if key != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, raw))
+		require.NoError(t, os.WriteFile(path+signatureSuffix, []byte(sig+"\n"), 0o666))
+	}
+}
+
+func newKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(pub), priv
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no manifest", func(t *testing.T) {
+		path, _ := writeImage(t)
+
+		v, err := New(Config{})
+		require.NoError(t, err)
+		assert.NoError(t, v.Verify(ctx, path))
+
+		v, err = New(Config{RequireManifest: true})
+		require.NoError(t, err)
+		assert.ErrorIs(t, v.Verify(ctx, path), hypervisor.ErrImageVerification)
+	})
+
+	t.Run("file image", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ubuntu.qcow2")
+		require.NoError(t, os.WriteFile(path, []byte("qcow2"), 0o666))
+		writeManifest(t, path, Manifest{Files: map[string]string{"ubuntu.qcow2": sha256Hex([]byte("qcow2"))}}, nil)
+
+		v, err := New(Config{RequireManifest: true})
+		require.NoError(t, err)
+		assert.NoError(t, v.Verify(ctx, path))
+	})
+
+	t.Run("cached until forgotten", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, nil)
+
+		v, err := New(Config{})
+		require.NoError(t, err)
+		require.NoError(t, v.Verify(ctx, path))
+
+		require.NoError(t, os.WriteFile(filepath.Join(path, "disk.img"), []byte("tampered"), 0o666))
+		assert.NoError(t, v.Verify(ctx, path))
+
+		v.Forget(path)
+		assert.ErrorIs(t, v.Verify(ctx, path), hypervisor.ErrImageVerification)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, nil)
+
+		v, err := New(Config{})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.ErrorIs(t, v.Verify(ctx, path), context.Canceled)
+
+		// a cancelled verification isn't cached
+		assert.NoError(t, v.Verify(context.Background(), path))
+	})
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	testCases := map[string]func(t *testing.T, path string, manifest Manifest) Manifest{
+		"digest differs": func(t *testing.T, path string, manifest Manifest) Manifest {
+			require.NoError(t, os.WriteFile(filepath.Join(path, "disk.img"), []byte("tampered"), 0o666))
+			return manifest
+		},
+		"file missing": func(t *testing.T, path string, manifest Manifest) Manifest {
+			require.NoError(t, os.Remove(filepath.Join(path, "nvram.bin")))
+			return manifest
+		},
+		"symlink": func(t *testing.T, path string, manifest Manifest) Manifest {
+			require.NoError(t, os.Remove(filepath.Join(path, "disk.img")))
+			require.NoError(t, os.WriteFile(filepath.Join(path, "real.img"), []byte("disk"), 0o666))
+			require.NoError(t, os.Symlink("real.img", filepath.Join(path, "disk.img")))
+			return manifest
+		},
+		"outside the image": func(t *testing.T, path string, manifest Manifest) Manifest {
+			require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "other.img"), []byte("other"), 0o666))
+			return Manifest{Files: map[string]string{"other.img": sha256Hex([]byte("other"))}}
+		},
+		"another image": func(t *testing.T, path string, manifest Manifest) Manifest {
+			return Manifest{Files: map[string]string{"macos-14-other/disk.img": sha256Hex([]byte("disk"))}}
+		},
+		"traversal": func(t *testing.T, path string, manifest Manifest) Manifest {
+			return Manifest{Files: map[string]string{"macos-14/../../disk.img": sha256Hex([]byte("disk"))}}
+		},
+		"no files": func(t *testing.T, path string, manifest Manifest) Manifest {
+			return Manifest{}
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path, manifest := writeImage(t)
+			writeManifest(t, path, tc(t, path, manifest), nil)
+
+			v, err := New(Config{})
+			require.NoError(t, err)
+			assert.ErrorIs(t, v.Verify(context.Background(), path), hypervisor.ErrImageVerification)
+		})
+	}
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		path, _ := writeImage(t)
+		require.NoError(t, os.WriteFile(path+manifestSuffix, []byte("{"), 0o666))
+
+		v, err := New(Config{})
+		require.NoError(t, err)
+		assert.ErrorIs(t, v.Verify(context.Background(), path), hypervisor.ErrImageVerification)
+	})
+}
+
+func TestVerifySignature(t *testing.T) {
+	trusted, trustedKey := newKey(t)
+	_, untrustedKey := newKey(t)
+
+	v, err := New(Config{TrustedKeys: []string{trusted}})
+	require.NoError(t, err)
+
+	t.Run("signed", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, trustedKey)
+		assert.NoError(t, v.Verify(context.Background(), path))
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, nil)
+		assert.ErrorIs(t, v.Verify(context.Background(), path), hypervisor.ErrImageVerification)
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, untrustedKey)
+		assert.ErrorIs(t, v.Verify(context.Background(), path), hypervisor.ErrImageVerification)
+	})
+
+	t.Run("manifest changed after signing", func(t *testing.T) {
+		path, manifest := writeImage(t)
+		writeManifest(t, path, manifest, trustedKey)
+
+		// the digests match the changed disk, but the signature doesn't
+		require.NoError(t, os.WriteFile(filepath.Join(path, "disk.img"), []byte("tampered"), 0o666))
+		manifest.Files["macos-14/disk.img"] = sha256Hex([]byte("tampered"))
+		raw, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+manifestSuffix, raw, 0o666))
+
+		assert.ErrorIs(t, v.Verify(context.Background(), path), hypervisor.ErrImageVerification)
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+			_, err := New(Config{TrustedKeys: []string{key}})
+			assert.Error(t, err, key)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !darwin && !linux
+
+package materialize
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// allocated returns a file's size, as the bytes allocated to it are unknown
+// on this platform.
+func allocated(t *testing.T, path string) int64 {
+	t.Helper()
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+
+	return fi.Size()
+}
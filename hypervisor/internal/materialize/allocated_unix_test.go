@@ -0,0 +1,21 @@
+//go:build darwin || linux
+
+package materialize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// allocated returns the bytes allocated to a file, which are fewer than its
+// size if it has holes.
+func allocated(t *testing.T, path string) int64 {
+	t.Helper()
+
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(path, &st))
+
+	return st.Blocks * 512
+}
@@ -0,0 +1,148 @@
+package materialize
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrInvalidArchive is returned, wrapped, by Extract for archives with entries
+// it refuses to extract, or files that don't match their digests.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ExtractOptions restrict what Extract extracts from an archive.
+type ExtractOptions struct {
+	// Files are the names of the files the archive can contain, which are
+	// extracted into the directory itself, never a subdirectory of it.
+	Files []string
+
+	// MaxSize is the most bytes the archive's files can hold uncompressed,
+	// zero is unlimited.
+	MaxSize int64
+
+	// Digests are the sha256 digests of files, hex encoded and optionally
+	// prefixed with "sha256:", by name. Every file with a digest has to be
+	// in the archive.
+	Digests map[string]string
+}
+
+// Extract extracts a zstd compressed tar archive's files into dir, with
+// SparseCopy, so that blocks of zeros are holes. Only regular files allowed
+// by the options are extracted, any other entry fails the extraction, and
+// files are verified against their digests.
+func Extract(ctx context.Context, r io.Reader, dir string, opts ExtractOptions) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("creating zstd reader: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	buf := make([]byte, BlockSize)
+	extracted := make(map[string]bool)
+	var size int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %w", err)
+		}
+
+		name, err := opts.check(hdr)
+		if err != nil {
+			return err
+		}
+		if extracted[name] {
+			return fmt.Errorf("%w: %q is in the archive more than once", ErrInvalidArchive, hdr.Name)
+		}
+		extracted[name] = true
+
+		size += hdr.Size
+		if opts.MaxSize > 0 && size > opts.MaxSize {
+			return fmt.Errorf("%w: files larger than %d bytes", ErrInvalidArchive, opts.MaxSize)
+		}
+
+		digest, err := extractFile(tr, hdr, name, filepath.Join(dir, name), buf)
+		if err != nil {
+			return err
+		}
+
+		if want, ok := opts.Digests[name]; ok && !strings.EqualFold(strings.TrimPrefix(want, "sha256:"), digest) {
+			return fmt.Errorf("%w: %s has digest sha256:%s, expected %s", ErrInvalidArchive, name, digest, want)
+		}
+	}
+
+	for name := range opts.Digests {
+		if !extracted[name] {
+			return fmt.Errorf("%w: %s isn't in the archive", ErrInvalidArchive, name)
+		}
+	}
+
+	return nil
+}
+
+// check returns the name an entry is extracted as, if it's allowed.
+func (opts ExtractOptions) check(hdr *tar.Header) (string, error) {
+	name := path.Clean(hdr.Name)
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: entry %q is outside the directory", ErrInvalidArchive, hdr.Name)
+	}
+
+	if hdr.Typeflag != tar.TypeReg {
+		return "", fmt.Errorf("%w: entry %q isn't a regular file", ErrInvalidArchive, hdr.Name)
+	}
+
+	if !slices.Contains(opts.Files, name) {
+		return "", fmt.Errorf("%w: unexpected file %q", ErrInvalidArchive, hdr.Name)
+	}
+
+	if hdr.Size < 0 {
+		return "", fmt.Errorf("%w: entry %q has an invalid size", ErrInvalidArchive, hdr.Name)
+	}
+
+	return name, nil
+}
+
+// extractFile extracts an entry to dstpath, which mustn't exist, returning
+// its hex encoded sha256 digest.
+func extractFile(tr *tar.Reader, hdr *tar.Header, name, dstpath string, buf []byte) (string, error) {
+	dst, err := os.OpenFile(dstpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", dstpath, err)
+	}
+	defer dst.Close()
+
+	h := sha256.New()
+	n, err := SparseCopy(dst, io.TeeReader(tr, h), 0, buf)
+	if err != nil {
+		return "", fmt.Errorf("copying %s -> %s: %w", name, dstpath, err)
+	}
+	if n != hdr.Size {
+		return "", fmt.Errorf("copying %s -> %s: %w", name, dstpath, io.ErrUnexpectedEOF)
+	}
+	if err := dst.Truncate(n); err != nil {
+		return "", fmt.Errorf("sizing %s: %w", dstpath, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("flushing %s: %w", dstpath, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
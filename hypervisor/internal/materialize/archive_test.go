@@ -0,0 +1,157 @@
+package materialize
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entry is a tar entry, a regular file unless its header says otherwise.
+type entry struct {
+	hdr  tar.Header
+	data []byte
+}
+
+func file(name string, data []byte) entry {
+	return entry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg}, data: data}
+}
+
+// archive returns a zstd compressed tar of the entries.
+func archive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Mode = 0o644
+		hdr.Size = int64(len(e.data))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write(e.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtract(t *testing.T) {
+	// the disk ends with zeros, which have to be kept even though they
+	// aren't written
+	disk := make([]byte, 3*BlockSize)
+	copy(disk, "boot")
+	nvram := []byte("nvram")
+
+	opts := ExtractOptions{
+		Files: []string{"disk.img", "nvram.bin"},
+		Digests: map[string]string{
+			"disk.img":  "sha256:" + digest(disk),
+			"nvram.bin": digest(nvram),
+		},
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, Extract(context.Background(), bytes.NewReader(archive(t, file("disk.img", disk), file("./nvram.bin", nvram))), dir, opts))
+
+	for name, want := range map[string][]byte{"disk.img": disk, "nvram.bin": nvram} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(want, got), "%s differs", name)
+	}
+
+	t.Run("not an archive", func(t *testing.T) {
+		assert.Error(t, Extract(context.Background(), bytes.NewReader([]byte("not zstd")), t.TempDir(), opts))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var raw bytes.Buffer
+		tw := tar.NewWriter(&raw)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "disk.img", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(disk))}))
+		_, err := tw.Write(disk)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		zw, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		_, err = zw.Write(raw.Bytes()[:raw.Len()-BlockSize])
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		err = Extract(context.Background(), &buf, t.TempDir(), opts)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := Extract(ctx, bytes.NewReader(archive(t, file("disk.img", disk))), t.TempDir(), opts)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestExtractInvalid(t *testing.T) {
+	opts := ExtractOptions{Files: []string{"disk.img", "nvram.bin"}, MaxSize: 1024}
+
+	testCases := map[string]struct {
+		entries []entry
+		digests map[string]string
+	}{
+		"traversal":  {entries: []entry{file("../disk.img", []byte("x"))}},
+		"nested":     {entries: []entry{file("sub/disk.img", []byte("x"))}},
+		"absolute":   {entries: []entry{file("/tmp/disk.img", []byte("x"))}},
+		"unexpected": {entries: []entry{file("authorized_keys", []byte("x"))}},
+		"duplicate":  {entries: []entry{file("disk.img", []byte("x")), file("./disk.img", []byte("y"))}},
+		"too large":  {entries: []entry{file("disk.img", make([]byte, 1000)), file("nvram.bin", make([]byte, 25))}},
+		"symlink":    {entries: []entry{{hdr: tar.Header{Name: "disk.img", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}}},
+		"hard link":  {entries: []entry{{hdr: tar.Header{Name: "disk.img", Typeflag: tar.TypeLink, Linkname: "nvram.bin"}}}},
+		"directory":  {entries: []entry{{hdr: tar.Header{Name: "disk.img/", Typeflag: tar.TypeDir}}}},
+		"device":     {entries: []entry{{hdr: tar.Header{Name: "disk.img", Typeflag: tar.TypeChar}}}},
+		"digest differs": {
+			entries: []entry{file("disk.img", []byte("tampered"))},
+			digests: map[string]string{"disk.img": digest([]byte("disk"))},
+		},
+		"digested file missing": {
+			entries: []entry{file("disk.img", []byte("disk"))},
+			digests: map[string]string{"disk.img": digest([]byte("disk")), "nvram.bin": digest([]byte("nvram"))},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "vm")
+			require.NoError(t, os.Mkdir(dir, 0o777))
+
+			opts := opts
+			opts.Digests = tc.digests
+
+			err := Extract(context.Background(), bytes.NewReader(archive(t, tc.entries...)), dir, opts)
+			assert.ErrorIs(t, err, ErrInvalidArchive)
+
+			// nothing is written outside the directory
+			entries, err := os.ReadDir(parent)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package materialize
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// baseKeyFile is kept in each base, holding the key it was built with.
+const baseKeyFile = ".key"
+
+// BaseCache keeps read-only bases, such as an image's extracted archive, that
+// are built once and then cloned for each VM, rather than materialising every
+// VM from the archive. A base is rebuilt if the key it was built with, which
+// identifies what it was built from, changes. The zero value is ready to use.
+type BaseCache struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+// Use calls fn with the base at dir, first building it with build if there's
+// no base, or it was built with a different key. Concurrent first uses wait
+// for a single build. build is called with an empty directory alongside dir,
+// renamed into place once the base is complete, so a failed build never
+// leaves a partial base. fn is called holding a read lock, so the base isn't
+// rebuilt while it's in use. Use reports whether it built the base, or
+// tried to.
+func (c *BaseCache) Use(ctx context.Context, dir, key string, build func(dir string) error, fn func(dir string) error) (built bool, err error) {
+	lock := c.lock(dir)
+
+	if ok, err := useBase(lock, dir, key, fn); ok {
+		return false, err
+	}
+
+	lock.Lock()
+	if !validBase(dir, key) {
+		built = true
+		err = buildBase(ctx, dir, key, build)
+	}
+	lock.Unlock()
+
+	if err != nil {
+		return built, err
+	}
+
+	if ok, err := useBase(lock, dir, key, fn); ok {
+		return built, err
+	}
+
+	return built, fmt.Errorf("base %s changed while being built", dir)
+}
+
+func (c *BaseCache) lock(dir string) *sync.RWMutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.locks == nil {
+		c.locks = make(map[string]*sync.RWMutex)
+	}
+
+	lock, ok := c.locks[dir]
+	if !ok {
+		lock = &sync.RWMutex{}
+		c.locks[dir] = lock
+	}
+
+	return lock
+}
+
+// useBase calls fn if the base is valid, reporting whether it was.
+func useBase(lock *sync.RWMutex, dir, key string, fn func(dir string) error) (bool, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if !validBase(dir, key) {
+		return false, nil
+	}
+
+	return true, fn(dir)
+}
+
+func validBase(dir, key string) bool {
+	got, err := os.ReadFile(filepath.Join(dir, baseKeyFile))
+	return err == nil && string(got) == key
+}
+
+// buildBase builds the base alongside dir and replaces dir with it. The
+// caller must hold the base's write lock.
+func buildBase(ctx context.Context, dir, key string, build func(dir string) error) (err error) {
+	// remove partial bases left behind by a process that exited mid-build
+	if partial, err := filepath.Glob(dir + ".tmp-*"); err == nil {
+		for _, path := range partial {
+			os.RemoveAll(path)
+		}
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("creating base directory: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmp)
+		}
+	}()
+
+	if err := build(tmp); err != nil {
+		return fmt.Errorf("building base: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	names, err := baseFiles(tmp)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := setWritable(filepath.Join(tmp, name), false); err != nil {
+			return fmt.Errorf("making base read-only: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(tmp, baseKeyFile), []byte(key), 0o444); err != nil {
+		return fmt.Errorf("writing base key: %w", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("removing stale base: %w", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return fmt.Errorf("renaming base into place: %w", err)
+	}
+
+	return nil
+}
+
+// CloneBase copies the files of the base at dir to dst, an existing
+// directory, with the first of the strategies to support them, and makes the
+// copies writable. It returns the strategy used, which is the same for each
+// file of a base, as they're on the same filesystem.
+func CloneBase(ctx context.Context, dst, dir string, strategies []Strategy) (string, error) {
+	names, err := baseFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var strategy string
+	for _, name := range names {
+		strategy, err = CopyFile(ctx, filepath.Join(dst, name), filepath.Join(dir, name), strategies)
+		if err != nil {
+			return strategy, err
+		}
+
+		if err := setWritable(filepath.Join(dst, name), true); err != nil {
+			return strategy, fmt.Errorf("making %s writable: %w", name, err)
+		}
+	}
+
+	return strategy, nil
+}
+
+// baseFiles returns the names of the base's files, excluding its key.
+func baseFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading base: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			return nil, fmt.Errorf("reading base: %s isn't a regular file", entry.Name())
+		}
+		names = append(names, entry.Name())
+	}
+
+	return names, nil
+}
+
+// setWritable adds or removes write permission from a file.
+func setWritable(path string, writable bool) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	perm := fi.Mode().Perm() &^ 0o222
+	if writable {
+		perm |= 0o200
+	}
+
+	return os.Chmod(path, perm)
+}
@@ -0,0 +1,134 @@
+package materialize
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseCache(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), ".base")
+
+	var builds atomic.Int32
+	build := func(content string) func(string) error {
+		return func(dir string) error {
+			builds.Add(1)
+			path := filepath.Join(dir, "disk.img")
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return err
+			}
+			return os.Chmod(path, 0o644) // regardless of umask
+
+		}
+	}
+
+	clone := func(t *testing.T, c *BaseCache, key, content string) (bool, string) {
+		dst := t.TempDir()
+		built, err := c.Use(ctx, dir, key, build(content), func(dir string) error {
+			_, err := CloneBase(ctx, dst, dir, Strategies())
+			return err
+		})
+		require.NoError(t, err)
+
+		got, err := os.ReadFile(filepath.Join(dst, "disk.img"))
+		require.NoError(t, err)
+
+		fi, err := os.Stat(filepath.Join(dst, "disk.img"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm(), "clones are writable")
+
+		entries, err := os.ReadDir(dst)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "the key isn't cloned")
+
+		return built, string(got)
+	}
+
+	var c BaseCache
+
+	t.Run("concurrent first use builds once", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var built atomic.Int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ok, got := clone(t, &c, "v1", "disk v1")
+				assert.Equal(t, "disk v1", got)
+				if ok {
+					built.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, builds.Load())
+		assert.EqualValues(t, 1, built.Load())
+
+		fi, err := os.Stat(filepath.Join(dir, "disk.img"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o444), fi.Mode().Perm(), "the base is read-only")
+	})
+
+	t.Run("reused", func(t *testing.T) {
+		built, got := clone(t, &c, "v1", "unused")
+		assert.False(t, built)
+		assert.Equal(t, "disk v1", got)
+		assert.EqualValues(t, 1, builds.Load())
+	})
+
+	t.Run("reused by another process", func(t *testing.T) {
+		built, got := clone(t, &BaseCache{}, "v1", "unused")
+		assert.False(t, built)
+		assert.Equal(t, "disk v1", got)
+	})
+
+	t.Run("rebuilt when the key changes", func(t *testing.T) {
+		built, got := clone(t, &c, "v2", "disk v2")
+		assert.True(t, built)
+		assert.Equal(t, "disk v2", got)
+		assert.EqualValues(t, 2, builds.Load())
+	})
+}
+
+func TestBaseCacheBuildFailure(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	dir := filepath.Join(parent, ".base")
+
+	// a partial base left behind by an earlier process is removed
+	require.NoError(t, os.Mkdir(dir+".tmp-123", 0o777))
+
+	var c BaseCache
+	built, err := c.Use(ctx, dir, "v1", func(dir string) error {
+		if err := os.WriteFile(filepath.Join(dir, "disk.img"), []byte("partial"), 0o644); err != nil {
+			return err
+		}
+		return errors.New("truncated archive")
+	}, func(string) error {
+		t.Fatal("a failed base was used")
+		return nil
+	})
+	require.ErrorContains(t, err, "truncated archive")
+	assert.True(t, built)
+
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the next use builds it again
+	built, err = c.Use(ctx, dir, "v1", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "disk.img"), []byte("disk"), 0o644)
+	}, func(string) error { return nil })
+	require.NoError(t, err)
+	assert.True(t, built)
+}
@@ -0,0 +1,16 @@
+package materialize
+
+import (
+	"context"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformStrategies clones files on APFS, with clonefile.
+func platformStrategies() []Strategy {
+	return []Strategy{{Name: "clonefile", Copy: clonefile}}
+}
+
+func clonefile(ctx context.Context, dst, src string) error {
+	return unsupported(unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW))
+}
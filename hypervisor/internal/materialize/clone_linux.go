@@ -0,0 +1,72 @@
+package materialize
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformStrategies clones files on filesystems supporting reflinks, such as
+// btrfs and xfs, with FICLONE, and otherwise copies them within the kernel,
+// with copy_file_range.
+func platformStrategies() []Strategy {
+	return []Strategy{
+		{Name: "ficlone", Copy: ficlone},
+		{Name: "copy_file_range", Copy: copyFileRange},
+	}
+}
+
+func ficlone(ctx context.Context, dst, src string) error {
+	in, out, _, err := openFiles(dst, src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	defer out.Close()
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		return unsupported(err)
+	}
+
+	return out.Close()
+}
+
+// copyFileRange copies the data regions of src, so that holes are kept.
+func copyFileRange(ctx context.Context, dst, src string) error {
+	in, out, size, err := openFiles(dst, src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	defer out.Close()
+
+	regions, err := dataRegions(in, size)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range regions {
+		for off, end := r.offset, r.offset+r.length; off < end; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			roff, woff := off, off
+			n, err := unix.CopyFileRange(int(in.Fd()), &roff, int(out.Fd()), &woff, int(min(end-off, 1<<30)), 0)
+			if err != nil {
+				return unsupported(err)
+			}
+			if n == 0 {
+				return io.ErrUnexpectedEOF
+			}
+			off += int64(n)
+		}
+	}
+
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package materialize
+
+// platformStrategies has no strategies on this platform, files are only
+// copied sparsely.
+func platformStrategies() []Strategy {
+	return nil
+}
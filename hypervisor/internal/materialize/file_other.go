@@ -0,0 +1,15 @@
+//go:build !darwin && !linux
+
+package materialize
+
+import "os"
+
+// dataRegions returns the whole of f as data, as holes can't be found on this
+// platform.
+func dataRegions(f *os.File, size int64) ([]region, error) {
+	if size == 0 {
+		return nil, nil
+	}
+
+	return []region{{offset: 0, length: size}}, nil
+}
@@ -0,0 +1,62 @@
+//go:build darwin || linux
+
+package materialize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions returns the regions of f, of size bytes, that hold data, found
+// with SEEK_DATA and SEEK_HOLE. Filesystems that don't support them report
+// the whole file as data.
+func dataRegions(f *os.File, size int64) ([]region, error) {
+	var regions []region
+	for offset := int64(0); offset < size; {
+		data, err := f.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// there's only a hole past offset
+			break
+		}
+		if errors.Is(err, unix.EINVAL) && offset == 0 {
+			return []region{{offset: 0, length: size}}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("seeking data: %w", err)
+		}
+
+		hole, err := f.Seek(data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, fmt.Errorf("seeking hole: %w", err)
+		}
+		hole = min(hole, size)
+
+		if hole > data {
+			regions = append(regions, region{offset: data, length: hole - data})
+		}
+		offset = hole
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+// unsupported wraps errors.ErrUnsupported around the errors a copy strategy
+// fails with for files or filesystems it doesn't support, such as EXDEV for
+// files on different filesystems.
+func unsupported(err error) error {
+	for _, errno := range []unix.Errno{unix.EXDEV, unix.EINVAL, unix.ENOTTY, unix.ENOTSUP, unix.EOPNOTSUPP, unix.ENOSYS} {
+		if errors.Is(err, errno) {
+			return fmt.Errorf("%w: %w", errors.ErrUnsupported, err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+// Package materialize creates a VM's files from an image, either by copying
+// the image's files with the most efficient strategy their filesystem
+// supports, or by extracting the image's archive. Sparse files stay sparse.
+package materialize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Strategy copies the file at src to dst, which mustn't exist yet. Copy fails
+// with errors.ErrUnsupported, wrapped, if the strategy can't copy between the
+// files' filesystems, so that the next strategy can be tried.
+type Strategy struct {
+	Name string
+	Copy func(ctx context.Context, dst, src string) error
+}
+
+// Sparse copies a file's data regions, skipping holes and blocks of zeros. It
+// works on any filesystem, so it's the last of the Strategies.
+var Sparse = Strategy{Name: "sparse", Copy: sparseCopyFile}
+
+// Strategies returns the platform's copy strategies, most efficient first.
+func Strategies() []Strategy {
+	return append(platformStrategies(), Sparse)
+}
+
+// CopyFile copies src to dst with the first of the strategies to support
+// them, returning the name of the strategy used.
+func CopyFile(ctx context.Context, dst, src string, strategies []Strategy) (string, error) {
+	err := fmt.Errorf("%w: no strategies", errors.ErrUnsupported)
+	for _, strategy := range strategies {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		err = strategy.Copy(ctx, dst, src)
+		if err == nil {
+			return strategy.Name, nil
+		}
+
+		// a strategy can fail part way, so the next starts afresh
+		os.Remove(dst)
+
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return strategy.Name, fmt.Errorf("copying %s -> %s with %s: %w", src, dst, strategy.Name, err)
+		}
+	}
+
+	// none of the strategies support the files
+	return "", fmt.Errorf("copying %s -> %s: %w", src, dst, err)
+}
+
+// openFiles opens src, and creates dst with the same permissions, returning
+// src's size.
+func openFiles(dst, src string) (in, out *os.File, size int64, err error) {
+	in, err = os.Open(src)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	fi, err := in.Stat()
+	if err != nil {
+		in.Close()
+		return nil, nil, 0, err
+	}
+
+	out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		in.Close()
+		return nil, nil, 0, err
+	}
+
+	return in, out, fi.Size(), nil
+}
+
+// region is a range of a file that can hold data, as opposed to a hole.
+type region struct {
+	offset int64
+	length int64
+}
@@ -0,0 +1,153 @@
+package materialize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSparse writes a file of size bytes, with data only at the offsets
+// given, so that the rest can be holes.
+func writeSparse(t *testing.T, path string, size int64, data map[int64][]byte) []byte {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	require.NoError(t, err)
+	defer f.Close()
+
+	want := make([]byte, size)
+	for offset, b := range data {
+		_, err := f.WriteAt(b, offset)
+		require.NoError(t, err)
+		copy(want[offset:], b)
+	}
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+
+	return want
+}
+
+func TestCopyFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "disk.img")
+	want := writeSparse(t, src, 8<<20, map[int64][]byte{
+		0:       []byte("boot"),
+		4 << 20: bytes.Repeat([]byte{1}, 2*BlockSize+1),
+	})
+
+	for _, strategy := range Strategies() {
+		t.Run(strategy.Name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "disk.img")
+
+			name, err := CopyFile(context.Background(), dst, src, []Strategy{strategy})
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skipf("%s unsupported: %v", strategy.Name, err)
+			}
+			require.NoError(t, err)
+			assert.Equal(t, strategy.Name, name)
+
+			got, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(want, got), "copy differs")
+
+			fi, err := os.Stat(dst)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+
+			// holes are kept, if the filesystem has them
+			if allocated(t, src) < int64(len(want)) {
+				assert.Less(t, allocated(t, dst), int64(len(want)))
+			}
+		})
+	}
+}
+
+func TestCopyFileFallback(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "nvram.bin")
+	want := writeSparse(t, src, 1024, map[int64][]byte{0: []byte("nvram")})
+
+	unsupported := Strategy{Name: "unsupported", Copy: func(ctx context.Context, dst, src string) error {
+		require.NoError(t, os.WriteFile(dst, []byte("partial"), 0o666))
+		return fmt.Errorf("%w: cross-device", errors.ErrUnsupported)
+	}}
+	failing := Strategy{Name: "failing", Copy: func(ctx context.Context, dst, src string) error {
+		require.NoError(t, os.WriteFile(dst, []byte("partial"), 0o666))
+		return errors.New("disk full")
+	}}
+
+	t.Run("unsupported falls back", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "nvram.bin")
+
+		name, err := CopyFile(context.Background(), dst, src, []Strategy{unsupported, Sparse})
+		require.NoError(t, err)
+		assert.Equal(t, "sparse", name)
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("failure doesn't fall back", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "nvram.bin")
+
+		name, err := CopyFile(context.Background(), dst, src, []Strategy{failing, Sparse})
+		assert.ErrorContains(t, err, "disk full")
+		assert.Equal(t, "failing", name)
+		assert.NoFileExists(t, dst)
+	})
+
+	t.Run("no strategy", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "nvram.bin")
+
+		_, err := CopyFile(context.Background(), dst, src, []Strategy{unsupported})
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+		assert.NoFileExists(t, dst)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := CopyFile(ctx, filepath.Join(t.TempDir(), "nvram.bin"), src, Strategies())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestDataRegions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	writeSparse(t, path, 16<<20, map[int64][]byte{8 << 20: []byte("data")})
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	regions, err := dataRegions(f, 16<<20)
+	require.NoError(t, err)
+	require.NotEmpty(t, regions)
+
+	// however coarse the filesystem's regions are, the data is within them
+	// and they're in order
+	var covered bool
+	var end int64
+	for _, r := range regions {
+		assert.GreaterOrEqual(t, r.offset, end)
+		end = r.offset + r.length
+		covered = covered || (r.offset <= 8<<20 && end >= 8<<20+4)
+	}
+	assert.True(t, covered, "data not within %v", regions)
+	assert.LessOrEqual(t, end, int64(16<<20))
+
+	empty, err := os.Create(filepath.Join(t.TempDir(), "empty"))
+	require.NoError(t, err)
+	defer empty.Close()
+
+	regions, err = dataRegions(empty, 0)
+	require.NoError(t, err)
+	assert.Empty(t, regions)
+}
@@ -0,0 +1,95 @@
+package materialize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// BlockSize is the size of the blocks compared against zeros by SparseCopy,
+// and the smallest buffer it can be given.
+const BlockSize = 64 * 1024
+
+var zeroBlock = make([]byte, BlockSize)
+
+// SparseCopy copies src to dst, starting at offset, and returns the number of
+// bytes copied. Blocks of zeros are skipped rather than written, so that they
+// stay holes, which means dst has to be truncated to its size afterwards for
+// trailing zeros to be kept.
+func SparseCopy(dst io.WriterAt, src io.Reader, offset int64, buf []byte) (int64, error) {
+	if len(buf) < BlockSize {
+		panic("sparse copy buffer cannot be smaller than the block size")
+	}
+	buf = buf[:BlockSize]
+
+	var written int64
+	for {
+		n, err := readBlock(src, buf)
+		if n > 0 && !bytes.Equal(buf[:n], zeroBlock[:n]) {
+			if _, err := dst.WriteAt(buf[:n], offset+written); err != nil {
+				return written, err
+			}
+		}
+		written += int64(n)
+
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// readBlock fills buf, so that blocks of zeros are recognised however src
+// splits its reads, unless src ends or fails first.
+func readBlock(src io.Reader, buf []byte) (int, error) {
+	var n int
+	for n < len(buf) {
+		m, err := src.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// sparseCopyFile copies the data regions of src to dst, with SparseCopy, and
+// sizes dst to match.
+func sparseCopyFile(ctx context.Context, dst, src string) error {
+	in, out, size, err := openFiles(dst, src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	defer out.Close()
+
+	regions, err := dataRegions(in, size)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, BlockSize)
+	for _, r := range regions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := SparseCopy(out, io.NewSectionReader(in, r.offset, r.length), r.offset, buf)
+		if err != nil {
+			return err
+		}
+		if n != r.length {
+			return io.ErrUnexpectedEOF
+		}
+	}
+
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,70 @@
+package materialize
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writerAt records the offsets written at.
+type writerAt struct {
+	buf     []byte
+	offsets []int64
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+	copy(w.buf[off:], p)
+	w.offsets = append(w.offsets, off)
+
+	return len(p), nil
+}
+
+func TestSparseCopy(t *testing.T) {
+	src := make([]byte, 4*BlockSize+100)
+	copy(src[BlockSize:], "data")
+	copy(src[3*BlockSize+10:], "more data")
+
+	t.Run("whole blocks", func(t *testing.T) {
+		w := &writerAt{}
+		n, err := SparseCopy(w, bytes.NewReader(src), 10, make([]byte, BlockSize))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(src)), n)
+
+		// only the blocks with data are written, at the offset given, so the
+		// trailing zeros aren't
+		assert.Equal(t, []int64{10 + BlockSize, 10 + 3*BlockSize}, w.offsets)
+		assert.Equal(t, src[:4*BlockSize], w.buf[10:])
+	})
+
+	t.Run("short reads", func(t *testing.T) {
+		w := &writerAt{}
+		n, err := SparseCopy(w, iotest.HalfReader(bytes.NewReader(src)), 0, make([]byte, 2*BlockSize))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(src)), n)
+		assert.Equal(t, []int64{BlockSize, 3 * BlockSize}, w.offsets)
+	})
+
+	t.Run("unexpected eof", func(t *testing.T) {
+		r := io.MultiReader(bytes.NewReader(src[:BlockSize+10]), iotest.ErrReader(io.ErrUnexpectedEOF))
+		_, err := SparseCopy(&writerAt{}, r, 0, make([]byte, BlockSize))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		_, err := SparseCopy(&writerAt{}, iotest.TimeoutReader(bytes.NewReader(src)), 0, make([]byte, BlockSize))
+		assert.ErrorIs(t, err, iotest.ErrTimeout)
+	})
+
+	t.Run("small buffer", func(t *testing.T) {
+		assert.Panics(t, func() {
+			SparseCopy(&writerAt{}, bytes.NewReader(src), 0, make([]byte, BlockSize-1))
+		})
+	})
+}
@@ -0,0 +1,219 @@
+package oci
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tart compresses disk layers with Apple's Compression framework, whose LZ4
+// format is a sequence of blocks, each starting with a magic:
+//
+//   - "bv41", the decoded and encoded sizes, and an LZ4 compressed block
+//   - "bv4-", the size, and uncompressed data
+//   - "bv4$", the end of the stream
+//
+// Sizes are little-endian uint32s. Compressed blocks can refer back to the
+// output of previous blocks.
+const (
+	lz4MagicCompressed   = "bv41"
+	lz4MagicUncompressed = "bv4-"
+	lz4MagicEnd          = "bv4$"
+
+	// lz4Window is how far back a match can refer
+	lz4Window = 64 * 1024
+
+	// lz4MaxBlockSize bounds the memory a corrupt block size can make the
+	// reader allocate
+	lz4MaxBlockSize = 64 << 20
+)
+
+var errCorruptLZ4 = errors.New("corrupt lz4 stream")
+
+// lz4Reader decodes Apple's LZ4 format.
+type lz4Reader struct {
+	r *bufio.Reader
+
+	// buf holds up to lz4Window of history, followed by the current block's
+	// output, of which buf[pos:] is yet to be read
+	buf []byte
+	pos int
+	end bool
+}
+
+func newLZ4Reader(r io.Reader) *lz4Reader {
+	return &lz4Reader{r: bufio.NewReader(r)}
+}
+
+func (z *lz4Reader) Read(p []byte) (int, error) {
+	for z.pos == len(z.buf) {
+		if z.end {
+			return 0, io.EOF
+		}
+		if err := z.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, z.buf[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// next decodes the next block.
+func (z *lz4Reader) next() error {
+	// the end of stream marker is optional
+	var magic [4]byte
+	if _, err := io.ReadFull(z.r, magic[:]); errors.Is(err, io.EOF) {
+		z.end = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: reading block: %w", errCorruptLZ4, unexpectedEOF(err))
+	}
+
+	// keep the window of history for the block's matches to refer to
+	if len(z.buf) > lz4Window {
+		z.buf = append(z.buf[:0], z.buf[len(z.buf)-lz4Window:]...)
+	}
+	z.pos = len(z.buf)
+
+	switch string(magic[:]) {
+	case lz4MagicEnd:
+		z.end = true
+		return nil
+
+	case lz4MagicUncompressed:
+		size, err := z.readSize()
+		if err != nil {
+			return err
+		}
+		z.buf = grow(z.buf, size)
+		if _, err := io.ReadFull(z.r, z.buf[z.pos:]); err != nil {
+			return fmt.Errorf("%w: reading block: %w", errCorruptLZ4, unexpectedEOF(err))
+		}
+		return nil
+
+	case lz4MagicCompressed:
+		decodedSize, err := z.readSize()
+		if err != nil {
+			return err
+		}
+		encodedSize, err := z.readSize()
+		if err != nil {
+			return err
+		}
+
+		src := make([]byte, encodedSize)
+		if _, err := io.ReadFull(z.r, src); err != nil {
+			return fmt.Errorf("%w: reading block: %w", errCorruptLZ4, unexpectedEOF(err))
+		}
+
+		z.buf, err = decodeLZ4Block(z.buf, src)
+		if err != nil {
+			return err
+		}
+		if len(z.buf)-z.pos != decodedSize {
+			return fmt.Errorf("%w: block decoded to %d bytes, expected %d", errCorruptLZ4, len(z.buf)-z.pos, decodedSize)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown block magic %q", errCorruptLZ4, magic[:])
+}
+
+func (z *lz4Reader) readSize() (int, error) {
+	var size uint32
+	if err := binary.Read(z.r, binary.LittleEndian, &size); err != nil {
+		return 0, fmt.Errorf("%w: reading block size: %w", errCorruptLZ4, unexpectedEOF(err))
+	}
+	if size > lz4MaxBlockSize {
+		return 0, fmt.Errorf("%w: block size %d too large", errCorruptLZ4, size)
+	}
+	return int(size), nil
+}
+
+// decodeLZ4Block appends an LZ4 block's output to dst, which matches can refer
+// back into.
+func decodeLZ4Block(dst, src []byte) ([]byte, error) {
+	// length reads the extra bytes of a literal or match length, n being the
+	// token's 4 bits of it
+	length := func(i int, n int) (int, int, error) {
+		if n != 15 {
+			return i, n, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, 0, fmt.Errorf("%w: truncated length", errCorruptLZ4)
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if n > lz4MaxBlockSize {
+				return 0, 0, fmt.Errorf("%w: length too large", errCorruptLZ4)
+			}
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+
+	var (
+		i, literals, match int
+		err                error
+	)
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		i, literals, err = length(i, int(token>>4))
+		if err != nil {
+			return nil, err
+		}
+		if literals > len(src)-i {
+			return nil, fmt.Errorf("%w: truncated literals", errCorruptLZ4)
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+
+		// the last sequence only has literals
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, fmt.Errorf("%w: truncated offset", errCorruptLZ4)
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("%w: invalid match offset %d", errCorruptLZ4, offset)
+		}
+
+		i, match, err = length(i, int(token&15))
+		if err != nil {
+			return nil, err
+		}
+		match += 4
+
+		// matches can overlap their own output, so are copied bytewise
+		start := len(dst) - offset
+		for j := 0; j < match; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+
+	return dst, nil
+}
+
+func grow(buf []byte, n int) []byte {
+	return append(buf, make([]byte, n)...)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lz4Block(magic string, sizes []uint32, data []byte) []byte {
+	buf := []byte(magic)
+	for _, size := range sizes {
+		buf = binary.LittleEndian.AppendUint32(buf, size)
+	}
+	return append(buf, data...)
+}
+
+// lz4Uncompressed encodes b as uncompressed blocks, which is enough for
+// building test images.
+func lz4Uncompressed(b []byte, blockSize int) []byte {
+	var buf []byte
+	for len(b) > 0 {
+		n := min(len(b), blockSize)
+		buf = append(buf, lz4Block(lz4MagicUncompressed, []uint32{uint32(n)}, b[:n])...)
+		b = b[n:]
+	}
+	return append(buf, lz4MagicEnd...)
+}
+
+func TestLZ4Reader(t *testing.T) {
+	// "abcd", then a match of 8 at offset 4, then "xyz"
+	block1 := []byte{0x44, 'a', 'b', 'c', 'd', 4, 0, 0x30, 'x', 'y', 'z'}
+
+	// a match of 19, using extra length bytes, back into the previous block,
+	// then "!"
+	block2 := []byte{0x0f, 15, 0, 0, 0x10, '!'}
+
+	var stream []byte
+	stream = append(stream, lz4Block(lz4MagicCompressed, []uint32{15, uint32(len(block1))}, block1)...)
+	stream = append(stream, lz4Block(lz4MagicUncompressed, []uint32{3}, []byte("raw"))...)
+	stream = append(stream, lz4Block(lz4MagicCompressed, []uint32{20, uint32(len(block2))}, block2)...)
+	stream = append(stream, lz4MagicEnd...)
+
+	got, err := io.ReadAll(newLZ4Reader(bytes.NewReader(stream)))
+	require.NoError(t, err)
+	assert.Equal(t, "abcdabcdabcdxyz"+"raw"+"dabcdabcdxyzrawdabc"+"!", string(got))
+}
+
+func TestLZ4ReaderCorrupt(t *testing.T) {
+	testCases := map[string][]byte{
+		"unknown magic":     []byte("bv99"),
+		"truncated block":   lz4Block(lz4MagicUncompressed, []uint32{10}, []byte("short")),
+		"offset too far":    lz4Block(lz4MagicCompressed, []uint32{8, 4}, []byte{0x00, 8, 0, 0x00}),
+		"zero offset":       lz4Block(lz4MagicCompressed, []uint32{5, 5}, []byte{0x10, 'a', 0, 0, 0x00}),
+		"wrong size":        lz4Block(lz4MagicCompressed, []uint32{4, 4}, []byte{0x30, 'a', 'b', 'c'}),
+		"truncated literal": lz4Block(lz4MagicCompressed, []uint32{4, 2}, []byte{0x40, 'a'}),
+		"block too large":   lz4Block(lz4MagicUncompressed, []uint32{lz4MaxBlockSize + 1}, nil),
+	}
+
+	for name, stream := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := io.ReadAll(newLZ4Reader(bytes.NewReader(stream)))
+			assert.ErrorIs(t, err, errCorruptLZ4)
+		})
+	}
+}
+
+func TestLZ4ReaderWindow(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 30_000)
+
+	got, err := io.ReadAll(newLZ4Reader(bytes.NewReader(lz4Uncompressed(data, 4096))))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
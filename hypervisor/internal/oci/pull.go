@@ -0,0 +1,412 @@
+// Package oci pulls VM images stored in an OCI registry using Tart's layout:
+// the VM's config.json, its disk split into LZ4 compressed layers, and its
+// NVRAM, each a layer of the image's manifest.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/materialize"
+)
+
+// Media types of Tart's layout.
+const (
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeConfig   = "application/vnd.cirruslabs.tart.config.v1"
+	MediaTypeDiskV1   = "application/vnd.cirruslabs.tart.disk.v1"
+	MediaTypeDiskV2   = "application/vnd.cirruslabs.tart.disk.v2"
+	MediaTypeNVRAM    = "application/vnd.cirruslabs.tart.nvram.v1"
+)
+
+// Annotations of v2 disk layers, describing the layer's decompressed chunk of
+// the disk.
+const (
+	AnnotationUncompressedSize   = "org.cirruslabs.tart.uncompressed-size"
+	AnnotationUncompressedDigest = "org.cirruslabs.tart.uncompressed-content-digest"
+)
+
+const (
+	maxManifestSize = 4 << 20
+	maxConfigSize   = 1 << 20
+)
+
+// ErrDigestMismatch is returned, wrapped, when a manifest or layer doesn't
+// match the digest it was referenced by.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Puller pulls images. Registries configures access per registry host, such
+// as ghcr.io or localhost:5000, and the zero value pulls anonymously over
+// https using http.DefaultClient.
+type Puller struct {
+	Client     *http.Client
+	Registries map[string]Registry
+}
+
+// Pull fetches an image and lays it out in dir as config.json, disk.img and
+// nvram.bin, creating dir if needed. Every layer is verified against its
+// digest, and the disk is written sparsely. A failed pull leaves dir
+// partially written, so callers pull into a temporary directory.
+func (p *Puller) Pull(ctx context.Context, ref Reference, dir string) error {
+	httpClient := p.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	c := &client{http: httpClient, ref: ref, registry: p.Registries[ref.Registry]}
+
+	manifest, err := c.manifest(ctx)
+	if err != nil {
+		return err
+	}
+
+	layers, err := tartLayers(manifest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", ref, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return fmt.Errorf("creating image directory: %w", err)
+	}
+
+	config, err := c.blobBytes(ctx, layers.config, maxConfigSize)
+	if err != nil {
+		return fmt.Errorf("fetching config: %w", err)
+	}
+	if !json.Valid(config) {
+		return fmt.Errorf("fetching config: invalid json")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), config, 0o666); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	if err := c.blobFile(ctx, layers.nvram, filepath.Join(dir, "nvram.bin")); err != nil {
+		return fmt.Errorf("fetching nvram: %w", err)
+	}
+
+	if err := c.disk(ctx, layers.disk, filepath.Join(dir, "disk.img")); err != nil {
+		return fmt.Errorf("fetching disk: %w", err)
+	}
+
+	return nil
+}
+
+type layers struct {
+	config Descriptor
+	nvram  Descriptor
+	disk   []Descriptor
+}
+
+// tartLayers sorts a manifest's layers by what they are, in the order the
+// disk's layers are to be concatenated.
+func tartLayers(manifest Manifest) (layers, error) {
+	var l layers
+	var configs, nvrams int
+	var diskType string
+
+	for _, layer := range manifest.Layers {
+		if !digestPattern.MatchString(layer.Digest) {
+			return layers{}, fmt.Errorf("layer %q: unsupported digest", layer.Digest)
+		}
+		if layer.Size <= 0 {
+			return layers{}, fmt.Errorf("layer %s: invalid size %d", layer.Digest, layer.Size)
+		}
+
+		switch layer.MediaType {
+		case MediaTypeConfig:
+			l.config = layer
+			configs++
+
+		case MediaTypeNVRAM:
+			l.nvram = layer
+			nvrams++
+
+		case MediaTypeDiskV1, MediaTypeDiskV2:
+			if diskType != "" && diskType != layer.MediaType {
+				return layers{}, fmt.Errorf("mixed disk layer versions")
+			}
+			diskType = layer.MediaType
+			l.disk = append(l.disk, layer)
+		}
+	}
+
+	if configs != 1 || nvrams != 1 || len(l.disk) == 0 {
+		return layers{}, fmt.Errorf("not a tart image: expected a config, nvram and disk layers")
+	}
+
+	return l, nil
+}
+
+func (c *client) manifest(ctx context.Context) (Manifest, error) {
+	resp, err := c.get(ctx, "/manifests/"+c.ref.manifestRef(), MediaTypeManifest)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return Manifest{}, fmt.Errorf("reading manifest: %w", err)
+	}
+	if len(body) > maxManifestSize {
+		return Manifest{}, fmt.Errorf("reading manifest: too large")
+	}
+
+	if c.ref.Digest != "" {
+		if digest := digestOf(body); digest != c.ref.Digest {
+			return Manifest{}, fmt.Errorf("%w: manifest is %s, expected %s", ErrDigestMismatch, digest, c.ref.Digest)
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if manifest.SchemaVersion != 2 {
+		return Manifest{}, fmt.Errorf("unsupported manifest schema version %d", manifest.SchemaVersion)
+	}
+
+	return manifest, nil
+}
+
+// blob returns a reader of a layer, that fails with ErrDigestMismatch at the
+// end if the layer didn't match its descriptor.
+func (c *client) blob(ctx context.Context, desc Descriptor) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, "/blobs/"+desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifiedReader{r: resp.Body, desc: desc, hash: sha256.New()}, nil
+}
+
+func (c *client) blobBytes(ctx context.Context, desc Descriptor, limit int64) ([]byte, error) {
+	if desc.Size > limit {
+		return nil, fmt.Errorf("layer %s too large", desc.Digest)
+	}
+
+	r, err := c.blob(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// the layer is only verified once it's been read, so what's read is
+	// limited too, rather than trusting its descriptor's size
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("layer %s too large", desc.Digest)
+	}
+
+	return data, nil
+}
+
+func (c *client) blobFile(ctx context.Context, desc Descriptor, path string) error {
+	r, err := c.blob(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// disk decompresses the disk layers into path. v2 layers are each compressed
+// separately, whereas v1 layers are chunks of a single compressed stream.
+func (c *client) disk(ctx context.Context, layers []Descriptor, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// zeros aren't written, so the disk stays sparse
+	buf := make([]byte, materialize.BlockSize)
+
+	var size int64
+	if layers[0].MediaType == MediaTypeDiskV1 {
+		stream := &layersReader{open: func(i int) (io.ReadCloser, error) {
+			if i == len(layers) {
+				return nil, io.EOF
+			}
+			return c.blob(ctx, layers[i])
+		}}
+		defer stream.Close()
+
+		if size, err = materialize.SparseCopy(f, newLZ4Reader(stream), 0, buf); err != nil {
+			return err
+		}
+
+		// verify anything after the compressed stream's end marker
+		if _, err := io.Copy(io.Discard, stream); err != nil {
+			return err
+		}
+	} else {
+		for _, layer := range layers {
+			n, err := c.diskChunk(ctx, layer, f, size, buf)
+			if err != nil {
+				return fmt.Errorf("layer %s: %w", layer.Digest, err)
+			}
+			size += n
+		}
+	}
+
+	// the disk may end in zeros that were never written
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// diskChunk decompresses a v2 disk layer into w at offset, verifying the
+// chunk against the layer's annotations, and returns the chunk's size.
+func (c *client) diskChunk(ctx context.Context, layer Descriptor, w io.WriterAt, offset int64, buf []byte) (int64, error) {
+	r, err := c.blob(ctx, layer)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := materialize.SparseCopy(w, io.TeeReader(newLZ4Reader(r), h), offset, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	// the compressed stream's end marker may come before the blob's end, so
+	// the rest is drained to verify the digest
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return 0, err
+	}
+
+	if size, ok := layer.Annotations[AnnotationUncompressedSize]; ok {
+		if want, err := strconv.ParseInt(size, 10, 64); err != nil || want != n {
+			return 0, fmt.Errorf("decompressed to %d bytes, expected %s", n, size)
+		}
+	}
+
+	if want, ok := layer.Annotations[AnnotationUncompressedDigest]; ok {
+		if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != want {
+			return 0, fmt.Errorf("%w: decompressed to %s, expected %s", ErrDigestMismatch, got, want)
+		}
+	}
+
+	return n, nil
+}
+
+// verifiedReader fails with ErrDigestMismatch, rather than io.EOF, if what
+// was read doesn't match the descriptor.
+type verifiedReader struct {
+	r    io.ReadCloser
+	desc Descriptor
+	hash hash.Hash
+	n    int64
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	v.n += int64(n)
+
+	if v.n > v.desc.Size {
+		return n, fmt.Errorf("%w: layer %s is larger than %d bytes", ErrDigestMismatch, v.desc.Digest, v.desc.Size)
+	}
+
+	if errors.Is(err, io.EOF) {
+		if v.n != v.desc.Size {
+			return n, fmt.Errorf("%w: layer %s is %d bytes, expected %d", ErrDigestMismatch, v.desc.Digest, v.n, v.desc.Size)
+		}
+		if digest := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); digest != v.desc.Digest {
+			return n, fmt.Errorf("%w: layer is %s, expected %s", ErrDigestMismatch, digest, v.desc.Digest)
+		}
+	}
+
+	return n, err
+}
+
+func (v *verifiedReader) Close() error {
+	return v.r.Close()
+}
+
+// layersReader concatenates layers, opening each once the previous one has
+// been read.
+type layersReader struct {
+	open func(i int) (io.ReadCloser, error)
+
+	i   int
+	cur io.ReadCloser
+}
+
+func (l *layersReader) Read(p []byte) (int, error) {
+	for {
+		if l.cur == nil {
+			cur, err := l.open(l.i)
+			if err != nil {
+				return 0, err
+			}
+			l.cur = cur
+		}
+
+		n, err := l.cur.Read(p)
+		if errors.Is(err, io.EOF) {
+			l.cur.Close()
+			l.cur = nil
+			l.i++
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (l *layersReader) Close() error {
+	if l.cur != nil {
+		return l.cur.Close()
+	}
+	return nil
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,239 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registry is a stand-in for an OCI registry, serving manifests and blobs of
+// a single repository. With a token set, requests must present it, which is
+// handed out by the registry's token endpoint.
+type registry struct {
+	*httptest.Server
+
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	token     string
+}
+
+func newRegistry(t *testing.T) *registry {
+	r := &registry{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			assert.Equal(t, "repository:images/macos:pull", req.URL.Query().Get("scope"))
+			json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+			return
+		}
+
+		if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+r.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		kind, ref, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/images/macos/"), "/")
+
+		var content []byte
+		var ok bool
+		switch kind {
+		case "manifests":
+			content, ok = r.manifests[ref]
+			w.Header().Set("Content-Type", MediaTypeManifest)
+		case "blobs":
+			content, ok = r.blobs[ref]
+		}
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Write(content)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *registry) ref(t *testing.T, tag string) Reference {
+	ref, err := ParseReference(strings.TrimPrefix(r.URL, "http://") + "/images/macos:" + tag)
+	require.NoError(t, err)
+	return ref
+}
+
+func (r *registry) puller() *Puller {
+	return &Puller{
+		Registries: map[string]Registry{strings.TrimPrefix(r.URL, "http://"): {Insecure: true}},
+	}
+}
+
+func (r *registry) blob(mediaType string, content []byte, annotations map[string]string) Descriptor {
+	digest := digestOf(content)
+	r.blobs[digest] = content
+
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content)), Annotations: annotations}
+}
+
+// push adds a tart image, with its disk split into chunks of chunkSize, and
+// returns its manifest's digest.
+func (r *registry) push(t *testing.T, tag, diskType string, disk []byte, chunkSize int) string {
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        r.blob("application/vnd.oci.image.config.v1+json", []byte(`{}`), nil),
+	}
+
+	manifest.Layers = append(manifest.Layers, r.blob(MediaTypeConfig, []byte(`{"os":"darwin","cpuCount":4}`), nil))
+
+	if diskType == MediaTypeDiskV1 {
+		compressed := lz4Uncompressed(disk, 4096)
+		for len(compressed) > 0 {
+			n := min(len(compressed), chunkSize)
+			manifest.Layers = append(manifest.Layers, r.blob(MediaTypeDiskV1, compressed[:n], nil))
+			compressed = compressed[n:]
+		}
+	} else {
+		for len(disk) > 0 {
+			n := min(len(disk), chunkSize)
+			manifest.Layers = append(manifest.Layers, r.blob(MediaTypeDiskV2, lz4Uncompressed(disk[:n], 4096), map[string]string{
+				AnnotationUncompressedSize:   strconv.Itoa(n),
+				AnnotationUncompressedDigest: digestOf(disk[:n]),
+			}))
+			disk = disk[n:]
+		}
+	}
+
+	manifest.Layers = append(manifest.Layers, r.blob(MediaTypeNVRAM, []byte("nvram"), nil))
+
+	body, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	digest := digestOf(body)
+	r.manifests[tag] = body
+	r.manifests[digest] = body
+
+	return digest
+}
+
+func testDisk() []byte {
+	// a sparse region between data
+	disk := make([]byte, 300*1024)
+	copy(disk, "boot")
+	copy(disk[len(disk)-4:], "tail")
+	return disk
+}
+
+func TestPull(t *testing.T) {
+	for _, diskType := range []string{MediaTypeDiskV1, MediaTypeDiskV2} {
+		t.Run(diskType, func(t *testing.T) {
+			r := newRegistry(t)
+			r.push(t, "14", diskType, testDisk(), 100*1024)
+
+			dir := filepath.Join(t.TempDir(), "macos")
+			require.NoError(t, r.puller().Pull(context.Background(), r.ref(t, "14"), dir))
+
+			disk, err := os.ReadFile(filepath.Join(dir, "disk.img"))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(testDisk(), disk))
+
+			config, err := os.ReadFile(filepath.Join(dir, "config.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"os":"darwin","cpuCount":4}`, string(config))
+
+			nvram, err := os.ReadFile(filepath.Join(dir, "nvram.bin"))
+			require.NoError(t, err)
+			assert.Equal(t, "nvram", string(nvram))
+		})
+	}
+}
+
+func TestPullByDigest(t *testing.T) {
+	r := newRegistry(t)
+	digest := r.push(t, "14", MediaTypeDiskV2, testDisk(), 100*1024)
+
+	ref := r.ref(t, "14")
+	ref.Digest = digest
+	require.NoError(t, r.puller().Pull(context.Background(), ref, t.TempDir()))
+
+	// the tag was moved to a different image
+	r.push(t, "14", MediaTypeDiskV2, []byte("different"), 100*1024)
+	r.manifests[digest] = r.manifests["14"]
+
+	err := r.puller().Pull(context.Background(), ref, t.TempDir())
+	assert.ErrorIs(t, err, ErrDigestMismatch)
+}
+
+func TestPullTamperedLayer(t *testing.T) {
+	for _, diskType := range []string{MediaTypeDiskV1, MediaTypeDiskV2} {
+		t.Run(diskType, func(t *testing.T) {
+			r := newRegistry(t)
+			r.push(t, "14", diskType, testDisk(), 100*1024)
+
+			// flip a byte of every disk layer
+			var manifest Manifest
+			require.NoError(t, json.Unmarshal(r.manifests["14"], &manifest))
+			for _, layer := range manifest.Layers {
+				if layer.MediaType == diskType {
+					blob := r.blobs[layer.Digest]
+					blob[len(blob)/2] ^= 0xff
+				}
+			}
+
+			err := r.puller().Pull(context.Background(), r.ref(t, "14"), t.TempDir())
+			assert.ErrorIs(t, err, ErrDigestMismatch)
+		})
+	}
+}
+
+func TestPullAuthenticates(t *testing.T) {
+	r := newRegistry(t)
+	r.token = "secret"
+	r.push(t, "14", MediaTypeDiskV2, testDisk(), 100*1024)
+
+	require.NoError(t, r.puller().Pull(context.Background(), r.ref(t, "14"), t.TempDir()))
+}
+
+func TestPullNotTart(t *testing.T) {
+	r := newRegistry(t)
+
+	body, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		Layers:        []Descriptor{r.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("layer"), nil)},
+	})
+	require.NoError(t, err)
+	r.manifests["14"] = body
+
+	err = r.puller().Pull(context.Background(), r.ref(t, "14"), t.TempDir())
+	assert.ErrorContains(t, err, "not a tart image")
+}
+
+func TestPullInvalidLayerSize(t *testing.T) {
+	r := newRegistry(t)
+	r.push(t, "14", MediaTypeDiskV2, testDisk(), 100*1024)
+
+	// a layer without a size would otherwise be read unbounded
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(r.manifests["14"], &manifest))
+	manifest.Layers[0].Size = 0
+
+	body, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	r.manifests["14"] = body
+
+	err = r.puller().Pull(context.Background(), r.ref(t, "14"), t.TempDir())
+	assert.ErrorContains(t, err, "invalid size")
+}
@@ -0,0 +1,86 @@
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultRegistry = "docker.io"
+	defaultTag      = "latest"
+)
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Reference is an image in a registry, such as
+// ghcr.io/cirruslabs/macos-sonoma-base:latest. If Digest is set, it's pulled
+// by digest and Tag is ignored.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses a reference of the form
+// [registry/]repository[:tag][@digest]. The registry defaults to docker.io,
+// and the tag to latest.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+
+	rest := s
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		if !digestPattern.MatchString(digest) {
+			return Reference{}, fmt.Errorf("invalid reference %q: unsupported digest", s)
+		}
+		rest, ref.Digest = name, digest
+	}
+
+	// a colon after the last slash separates the tag, a colon before it is
+	// the registry's port
+	if idx := strings.LastIndex(rest, ":"); idx > strings.LastIndex(rest, "/") {
+		rest, ref.Tag = rest[:idx], rest[idx+1:]
+	}
+
+	// the first component is a registry if it looks like a host
+	if first, repo, ok := strings.Cut(rest, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, rest = first, repo
+	}
+
+	ref.Repository = rest
+	if ref.Registry == "" {
+		ref.Registry = defaultRegistry
+		if !strings.Contains(ref.Repository, "/") {
+			ref.Repository = "library/" + ref.Repository
+		}
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	if ref.Repository == "" || strings.HasPrefix(ref.Repository, "/") || strings.HasSuffix(ref.Repository, "/") {
+		return Reference{}, fmt.Errorf("invalid reference %q: missing repository", s)
+	}
+
+	return ref, nil
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// manifestRef is the tag or digest a manifest is fetched by.
+func (r Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
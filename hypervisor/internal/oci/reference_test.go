@@ -0,0 +1,60 @@
+package oci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	testCases := map[string]struct {
+		ref  string
+		want Reference
+		err  bool
+	}{
+		"full": {
+			ref:  "ghcr.io/cirruslabs/macos-sonoma-base:latest",
+			want: Reference{Registry: "ghcr.io", Repository: "cirruslabs/macos-sonoma-base", Tag: "latest"},
+		},
+		"default tag": {
+			ref:  "ghcr.io/cirruslabs/macos-sonoma-base",
+			want: Reference{Registry: "ghcr.io", Repository: "cirruslabs/macos-sonoma-base", Tag: "latest"},
+		},
+		"registry with port": {
+			ref:  "localhost:5000/images/macos:14",
+			want: Reference{Registry: "localhost:5000", Repository: "images/macos", Tag: "14"},
+		},
+		"digest": {
+			ref:  "ghcr.io/cirruslabs/macos@" + digest,
+			want: Reference{Registry: "ghcr.io", Repository: "cirruslabs/macos", Digest: digest},
+		},
+		"default registry": {
+			ref:  "macos:14",
+			want: Reference{Registry: "docker.io", Repository: "library/macos", Tag: "14"},
+		},
+		"invalid digest": {
+			ref: "ghcr.io/cirruslabs/macos@sha256:abc",
+			err: true,
+		},
+		"missing repository": {
+			ref: "ghcr.io/",
+			err: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ref, err := ParseReference(tc.ref)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ref)
+		})
+	}
+}
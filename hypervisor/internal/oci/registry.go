@@ -0,0 +1,180 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Registry configures access to a registry. Credentials are optional, and
+// anonymous access is used without them.
+type Registry struct {
+	// Insecure registries are accessed over plain http
+	Insecure bool   `json:"insecure"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// client makes requests to a repository, authenticating as the registry asks
+// it to.
+type client struct {
+	http     *http.Client
+	ref      Reference
+	registry Registry
+
+	mu    sync.Mutex
+	token string
+}
+
+func (c *client) url(path string) string {
+	scheme := "https"
+	if c.registry.Insecure {
+		scheme = "http"
+	}
+
+	return scheme + "://" + c.ref.Registry + "/v2/" + c.ref.Repository + path
+}
+
+// get requests a path within the repository, returning the response if it
+// was successful.
+func (c *client) get(ctx context.Context, path string, accept ...string) (*http.Response, error) {
+	resp, err := c.do(ctx, path, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if err := c.authenticate(ctx, challenge); err != nil {
+			return nil, err
+		}
+
+		resp, err = c.do(ctx, path, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("fetching %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+func (c *client) do(ctx context.Context, path string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.registry.Username != "":
+		req.SetBasicAuth(c.registry.Username, c.registry.Password)
+	}
+
+	return c.http.Do(req)
+}
+
+// authenticate fetches a bearer token for pulling from the repository, as
+// described by the registry's challenge.
+func (c *client) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return fmt.Errorf("registry %s: unauthorized", c.ref.Registry)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid auth realm %q: %w", params["realm"], err)
+	}
+
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.registry.Username != "" {
+		req.SetBasicAuth(c.registry.Username, c.registry.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching auth token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching auth token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decoding auth token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return fmt.Errorf("fetching auth token: empty token")
+	}
+
+	c.mu.Lock()
+	c.token = token.Token
+	c.mu.Unlock()
+
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, such as
+// Bearer realm="https://ghcr.io/token",service="ghcr.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+
+	return scheme, params
+}
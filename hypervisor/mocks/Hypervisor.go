@@ -22,13 +22,57 @@ func (_m *Hypervisor) EXPECT() *Hypervisor_Expecter {
 	return &Hypervisor_Expecter{mock: &_m.Mock}
 }
 
-// Create provides a mock function with given fields: ctx, name
-func (_m *Hypervisor) Create(ctx context.Context, name string) (hypervisor.VirtualMachine, error) {
-	ret := _m.Called(ctx, name)
+// Capabilities provides a mock function with given fields: ctx
+func (_m *Hypervisor) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	ret := _m.Called(ctx)
+
+	var r0 hypervisor.Capabilities
+	if rf, ok := ret.Get(0).(func(context.Context) hypervisor.Capabilities); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(hypervisor.Capabilities)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Hypervisor_Capabilities_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capabilities'
+type Hypervisor_Capabilities_Call struct {
+	*mock.Call
+}
+
+// Capabilities is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Hypervisor_Expecter) Capabilities(ctx interface{}) *Hypervisor_Capabilities_Call {
+	return &Hypervisor_Capabilities_Call{Call: _e.mock.On("Capabilities", ctx)}
+}
+
+func (_c *Hypervisor_Capabilities_Call) Run(run func(ctx context.Context)) *Hypervisor_Capabilities_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Hypervisor_Capabilities_Call) Return(_a0 hypervisor.Capabilities, _a1 error) *Hypervisor_Capabilities_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+// Create provides a mock function with given fields: ctx, name, opts
+func (_m *Hypervisor) Create(ctx context.Context, name string, opts hypervisor.CreateOptions) (hypervisor.VirtualMachine, error) {
+	ret := _m.Called(ctx, name, opts)
 
 	var r0 hypervisor.VirtualMachine
-	if rf, ok := ret.Get(0).(func(context.Context, string) hypervisor.VirtualMachine); ok {
-		r0 = rf(ctx, name)
+	if rf, ok := ret.Get(0).(func(context.Context, string, hypervisor.CreateOptions) hypervisor.VirtualMachine); ok {
+		r0 = rf(ctx, name, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(hypervisor.VirtualMachine)
@@ -36,8 +80,8 @@ func (_m *Hypervisor) Create(ctx context.Context, name string) (hypervisor.Virtu
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+	if rf, ok := ret.Get(1).(func(context.Context, string, hypervisor.CreateOptions) error); ok {
+		r1 = rf(ctx, name, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -53,13 +97,14 @@ type Hypervisor_Create_Call struct {
 // Create is a helper method to define mock.On call
 //   - ctx context.Context
 //   - name string
-func (_e *Hypervisor_Expecter) Create(ctx interface{}, name interface{}) *Hypervisor_Create_Call {
-	return &Hypervisor_Create_Call{Call: _e.mock.On("Create", ctx, name)}
+//   - opts hypervisor.CreateOptions
+func (_e *Hypervisor_Expecter) Create(ctx interface{}, name interface{}, opts interface{}) *Hypervisor_Create_Call {
+	return &Hypervisor_Create_Call{Call: _e.mock.On("Create", ctx, name, opts)}
 }
 
-func (_c *Hypervisor_Create_Call) Run(run func(ctx context.Context, name string)) *Hypervisor_Create_Call {
+func (_c *Hypervisor_Create_Call) Run(run func(ctx context.Context, name string, opts hypervisor.CreateOptions)) *Hypervisor_Create_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string))
+		run(args[0].(context.Context), args[1].(string), args[2].(hypervisor.CreateOptions))
 	})
 	return _c
 }
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/integrity"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/parallels/internal/control"
 )
 
@@ -19,18 +21,25 @@ const (
 
 	vmNamePrefix      = "nesting-"
 	networkNamePrefix = "isolation-"
+
+	// snapshotNamePrefix names the stopped vms snapshots are kept by, which
+	// VM ids, a unique id after vmNamePrefix, can't collide with
+	snapshotNamePrefix = vmNamePrefix + "snapshot-"
 )
 
 type Parallels struct {
 	mu       sync.Mutex
 	networks map[string]bool
 	cfg      Config
+	verifier *integrity.Verifier
 }
 
 type Config struct {
 	ImageDirectory   string `json:"image_directory"`
 	WorkingDirectory string `json:"working_directory"`
 	LicenseKey       string `json:"license_key"`
+
+	integrity.Config
 }
 
 func New(config []byte) (*Parallels, error) {
@@ -42,6 +51,12 @@ func New(config []byte) (*Parallels, error) {
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	hv.verifier = verifier
+
 	return hv, nil
 }
 
@@ -52,6 +67,12 @@ func (hv *Parallels) Init(ctx context.Context, config []byte) error {
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return err
+	}
+	hv.verifier = verifier
+
 	ctx, cancel := context.WithTimeout(ctx, hvInitTimeout)
 	defer cancel()
 
@@ -70,38 +91,127 @@ func (hv *Parallels) Shutdown(ctx context.Context) error {
 	return control.RemoveLicense(ctx)
 }
 
-func (hv *Parallels) Create(ctx context.Context, name string) (vm hypervisor.VirtualMachine, err error) {
-	network, err := hv.getNetwork()
+// Capabilities reports Parallels' version and features. Each VM is attached
+// to its own isolation network, so there can't be more VMs than networks.
+func (hv *Parallels) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	version, err := control.Version(ctx)
+	if err != nil {
+		return hypervisor.Capabilities{}, err
+	}
+
+	hv.mu.Lock()
+	networks := len(hv.networks)
+	hv.mu.Unlock()
+
+	return hypervisor.Capabilities{
+		Version: version,
+		Features: []hypervisor.Feature{
+			hypervisor.FeatureListNames,
+			hypervisor.FeaturePersistentVMs,
+			hypervisor.FeatureResourceOverrides,
+			hypervisor.FeatureExec,
+			hypervisor.FeatureImages,
+			hypervisor.FeatureSnapshots,
+			hypervisor.FeatureGracefulDelete,
+		},
+		AddressFormat: hypervisor.AddressIP,
+		MaxVMs:        uint32(networks),
+	}, nil
+}
+
+func (hv *Parallels) Create(ctx context.Context, name string, createOpts hypervisor.CreateOptions) (vm hypervisor.VirtualMachine, err error) {
+	imagePath, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".pvm")
+	if err != nil {
+		return nil, err
+	}
+
+	memorySize, err := hvutil.WholeUnits("memory", createOpts.MemoryBytes, hvutil.MiB)
 	if err != nil {
 		return nil, err
 	}
+	diskSize, err := hvutil.WholeUnits("disk size", createOpts.DiskSizeBytes, hvutil.MiB)
+	if err != nil {
+		return nil, err
+	}
+
+	// a vm restored from a snapshot resumes with the address its guest was
+	// leased, so it's attached to the template's network with its mac
+	// address, which the template keeps for it
+	var template, network, mac string
+	if createOpts.Snapshot != "" {
+		if createOpts.CPUs > 0 || memorySize > 0 || diskSize > 0 {
+			return nil, fmt.Errorf("%w: a vm restored from a snapshot can't override its resources", hypervisor.ErrInvalidOption)
+		}
+
+		item, err := snapshotTemplate(ctx, name, createOpts.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		template, network, mac = item.Name, item.Hardware.Net0.Iface, item.Hardware.Net0.Mac
+	}
+
+	if err := hv.verifier.Verify(ctx, imagePath); err != nil {
+		return nil, err
+	}
 
-	var id, mac string
+	if template == "" {
+		if network, err = hv.getNetwork(); err != nil {
+			return nil, err
+		}
+		if mac, err = hvutil.GenerateMAC(); err != nil {
+			hv.putNetwork(network)
+			return nil, fmt.Errorf("generating mac address: %w", err)
+		}
+	}
+
+	var id string
 	if id, err = hvutil.UniqueID(); err != nil {
+		if template == "" {
+			hv.putNetwork(network)
+		}
 		return nil, fmt.Errorf("generating unique id: %w", err)
 	}
-	if mac, err = hvutil.GenerateMAC(); err != nil {
-		return nil, fmt.Errorf("generating mac address: %w", err)
-	}
 
 	opts := control.CreateOptions{
 		Id:         vmNamePrefix + id,
-		ImagePath:  filepath.Join(hv.cfg.ImageDirectory, name+".pvm"),
+		ImagePath:  imagePath,
 		MAC:        mac,
 		Network:    network,
 		WorkingDir: hv.cfg.WorkingDirectory,
+		CPUs:       int(createOpts.CPUs),
+		MemorySize: memorySize,
+		DiskSize:   diskSize,
+		Template:   template,
+		Snapshot:   createOpts.Snapshot,
+	}
+
+	log := hvutil.Logger("parallels").With("id", opts.Id, "name", name)
+
+	// a snapshot's template is switched to it when a vm is created from it,
+	// and only one vm restored from it can run, as they'd share its network
+	if template != "" {
+		hv.mu.Lock()
+		if err := checkSnapshotNotRestored(ctx, createOpts.Snapshot, mac); err != nil {
+			hv.mu.Unlock()
+			return nil, err
+		}
 	}
 
 	defer func() {
 		if err != nil {
-			control.VirtualMachineDelete(context.Background(), opts.Id)
-			hv.putNetwork(network)
+			if err := control.VirtualMachineDelete(context.Background(), opts.Id); err != nil {
+				log.Warn("cleaning up failed vm", "error", err)
+			}
+			if template == "" {
+				hv.putNetwork(network)
+			}
 		}
 	}()
 
-	hv.mu.Lock()
 	err = control.VirtualMachineCreate(ctx, opts)
-	hv.mu.Unlock()
+	if template != "" {
+		hv.mu.Unlock()
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("starting vm: %w", err)
@@ -112,14 +222,72 @@ func (hv *Parallels) Create(ctx context.Context, name string) (vm hypervisor.Vir
 		return nil, err
 	}
 
+	log.Info("vm started", "addr", ipAddr, "mac", opts.MAC, "network", network)
+
 	return hypervisor.VirtualMachineInfo{
-		Id:   opts.Id,
-		Name: name,
-		Addr: ipAddr,
+		Id:        opts.Id,
+		Name:      name,
+		Addr:      ipAddr,
+		Endpoints: hypervisor.SSHEndpoints(ipAddr),
 	}, nil
 }
 
 func (hv *Parallels) Delete(ctx context.Context, id string) error {
+	_, err := hv.delete(ctx, id, 0)
+	return err
+}
+
+// DeleteGracefully shuts the guest down with prlctl stop, and kills the vm if
+// it hasn't shut down within the grace period.
+func (hv *Parallels) DeleteGracefully(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	return hv.delete(ctx, id, grace)
+}
+
+func (hv *Parallels) delete(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	items, err := control.VirtualMachineList(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("fetching vm (%v) details: %w", id, err)
+	}
+
+	if len(items) == 0 {
+		return "", fmt.Errorf("no vm (%v) found", id)
+	}
+
+	vm := items[0]
+
+	method := hypervisor.StopForced
+	if grace > 0 {
+		shutdownCtx, cancel := context.WithTimeout(ctx, grace)
+		if err := control.VirtualMachineShutdown(shutdownCtx, vm.Name); err == nil {
+			method = hypervisor.StopGraceful
+		}
+		cancel()
+	}
+
+	if method == hypervisor.StopGraceful {
+		err = control.VirtualMachineRemove(ctx, vm.Name)
+	} else {
+		err = control.VirtualMachineDelete(ctx, vm.Name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("stopping vm (%v): %w", id, err)
+	}
+
+	hv.releaseNetwork(ctx, vm.Hardware.Net0.Iface, vm.Hardware.Net0.Mac)
+
+	hvutil.Logger("parallels").Info("vm deleted", "id", id, "network", vm.Hardware.Net0.Iface, "stop_method", method)
+
+	return method, nil
+}
+
+// Snapshot takes a snapshot of the running vm, including its memory, and keeps
+// the vm, stopped and renamed, as the snapshot's template. VMs restored from
+// the snapshot are linked clones of the template, once switched to the
+// snapshot, so they resume where the vm was when the snapshot was taken.
+//
+// The template keeps the vm's network, and its mac address's dhcp lease, as
+// the guest resumes with the address it was leased on it.
+func (hv *Parallels) Snapshot(ctx context.Context, id, snapshot string) error {
 	items, err := control.VirtualMachineList(ctx, id)
 	if err != nil {
 		return fmt.Errorf("fetching vm (%v) details: %w", id, err)
@@ -128,17 +296,203 @@ func (hv *Parallels) Delete(ctx context.Context, id string) error {
 	if len(items) == 0 {
 		return fmt.Errorf("no vm (%v) found", id)
 	}
-
 	vm := items[0]
-	if err := control.VirtualMachineDelete(ctx, vm.Name); err != nil {
-		return fmt.Errorf("stopping vm (%v): %w", id, err)
+
+	template := snapshotNamePrefix + snapshot
+
+	// templates are switched to their snapshot when a vm is created from them
+	hv.mu.Lock()
+	err = saveSnapshot(ctx, vm.Name, template, snapshot)
+	hv.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	hvutil.Logger("parallels").Info("vm snapshot saved", "id", id, "name", vm.Description, "snapshot", snapshot)
+
+	return nil
+}
+
+// DeleteSnapshot deletes the snapshot's template, and releases the network and
+// dhcp lease it kept. The template can't be deleted while a vm restored from
+// it is running, as the vm is a linked clone of it, on its network.
+func (hv *Parallels) DeleteSnapshot(ctx context.Context, snapshot string) error {
+	template := snapshotNamePrefix + snapshot
+
+	items, err := control.VirtualMachineList(ctx, template)
+	if err != nil {
+		return fmt.Errorf("fetching snapshots: %w", err)
+	}
+
+	for _, item := range items {
+		if item.Name != template {
+			continue
+		}
+
+		hv.mu.Lock()
+		err = checkSnapshotNotRestored(ctx, snapshot, item.Hardware.Net0.Mac)
+		if err == nil {
+			err = control.VirtualMachineRemove(ctx, template)
+		}
+		hv.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		// make network available
+		hv.putNetwork(item.Hardware.Net0.Iface)
+
+		// remove dhcp lease
+		removeLease(item.Hardware.Net0.Mac)
+
+		hvutil.Logger("parallels").Info("vm snapshot deleted", "snapshot", snapshot, "network", item.Hardware.Net0.Iface)
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotNotFound, snapshot)
+}
+
+func saveSnapshot(ctx context.Context, name, template, snapshot string) error {
+	existing, err := control.VirtualMachineList(ctx, template)
+	if err != nil {
+		return fmt.Errorf("fetching snapshots: %w", err)
+	}
+	for _, item := range existing {
+		if item.Name == template {
+			return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotExists, snapshot)
+		}
+	}
+
+	if err := control.SnapshotCreate(ctx, name, snapshot); err != nil {
+		return err
+	}
+
+	if err := control.VirtualMachineStop(ctx, name); err != nil {
+		return err
+	}
+
+	return control.VirtualMachineRename(ctx, name, template)
+}
+
+// snapshotTemplate returns the template vm keeping the snapshot, which must
+// have been taken of a vm of the image.
+func snapshotTemplate(ctx context.Context, name, snapshot string) (control.VirtualMachine, error) {
+	template := snapshotNamePrefix + snapshot
+
+	items, err := control.VirtualMachineList(ctx, template)
+	if err != nil {
+		return control.VirtualMachine{}, fmt.Errorf("fetching snapshots: %w", err)
+	}
+
+	for _, item := range items {
+		if item.Name == template && item.Description == name {
+			return item, nil
+		}
+	}
+
+	return control.VirtualMachine{}, fmt.Errorf("%w: %s of image %s", hypervisor.ErrSnapshotNotFound, snapshot, name)
+}
+
+// checkSnapshotNotRestored fails if a vm restored from the snapshot, with its
+// template's mac address, is running.
+func checkSnapshotNotRestored(ctx context.Context, snapshot, mac string) error {
+	items, err := control.VirtualMachineList(ctx, vmNamePrefix)
+	if err != nil {
+		return fmt.Errorf("fetching vms: %w", err)
+	}
+
+	for _, item := range items {
+		if !strings.HasPrefix(item.Name, snapshotNamePrefix) && strings.EqualFold(item.Hardware.Net0.Mac, mac) {
+			return fmt.Errorf("%w: %s is restored by vm %s", hypervisor.ErrSnapshotInUse, snapshot, item.Name)
+		}
+	}
+
+	return nil
+}
+
+// releaseNetwork makes a deleted vm's network available, and removes its mac
+// address's dhcp lease, unless a snapshot's template keeps them, as the vm was
+// restored from it. If the templates can't be listed, the network is kept
+// rather than risk handing a template's network out, until it's reclaimed
+// on restart.
+func (hv *Parallels) releaseNetwork(ctx context.Context, network, mac string) {
+	templates, err := control.VirtualMachineList(ctx, snapshotNamePrefix)
+	if err != nil {
+		hvutil.Logger("parallels").Warn("fetching snapshots failed, keeping network", "network", network, "error", err)
+		return
+	}
+
+	for _, template := range templates {
+		if strings.EqualFold(template.Hardware.Net0.Mac, mac) {
+			return
+		}
 	}
 
 	// make network available
-	hv.putNetwork(vm.Hardware.Net0.Iface)
+	hv.putNetwork(network)
 
 	// remove dhcp lease
-	removeLease(vm.Hardware.Net0.Mac)
+	removeLease(mac)
+}
+
+func (hv *Parallels) Exec(ctx context.Context, id string, cmd hypervisor.ExecCommand) (int, error) {
+	items, err := control.VirtualMachineList(ctx, id)
+	if err != nil {
+		return 0, fmt.Errorf("fetching vm (%v) details: %w", id, err)
+	}
+
+	if len(items) == 0 {
+		return 0, fmt.Errorf("no vm (%v) found", id)
+	}
+
+	return control.VirtualMachineExec(ctx, items[0].Name, cmd)
+}
+
+// ListImages returns the .pvm bundles in the image directory.
+func (hv *Parallels) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	return hvutil.ListImages(hv.cfg.ImageDirectory, ".pvm")
+}
+
+// ImportImage copies a .pvm bundle into the image directory. It's registered
+// with Parallels when a vm is first created from it.
+func (hv *Parallels) ImportImage(ctx context.Context, name, source string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".pvm")
+	if err != nil {
+		return err
+	}
+
+	if err := hvutil.ImportImage(ctx, source, path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("parallels").Info("image imported", "name", name, "source", source)
+
+	return nil
+}
+
+func (hv *Parallels) DeleteImage(ctx context.Context, name string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".pvm")
+	if err != nil {
+		return err
+	}
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		control.ImageUnregister(ctx, name)
+	}
+
+	if err := hvutil.DeleteImage(path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("parallels").Info("image deleted", "name", name)
 
 	return nil
 }
@@ -151,15 +505,20 @@ func (hv *Parallels) List(ctx context.Context) ([]hypervisor.VirtualMachine, err
 
 	vms := make([]hypervisor.VirtualMachine, 0, len(items))
 	for _, item := range items {
+		if strings.HasPrefix(item.Name, snapshotNamePrefix) {
+			continue
+		}
+
 		addr, err := getAddress(ctx, item.Hardware.Net0.Mac, 0)
 		if err != nil {
 			return nil, fmt.Errorf("getting vm addr: %w", err)
 		}
 
 		vms = append(vms, hypervisor.VirtualMachineInfo{
-			Id:   item.Name,
-			Name: item.Description,
-			Addr: addr,
+			Id:        item.Name,
+			Name:      item.Description,
+			Addr:      addr,
+			Endpoints: hypervisor.SSHEndpoints(addr),
 		})
 	}
 
@@ -0,0 +1,25 @@
+package parallels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestCreateInvalidImageName(t *testing.T) {
+	config, err := json.Marshal(Config{ImageDirectory: t.TempDir(), WorkingDirectory: t.TempDir()})
+	require.NoError(t, err)
+
+	hv, err := New(config)
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "../image", "images/image", ".snapshots", ".uploads"} {
+		_, err := hv.Create(context.Background(), name, hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, hypervisor.ErrInvalidImageName, name)
+	}
+}
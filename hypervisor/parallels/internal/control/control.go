@@ -7,7 +7,13 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
 )
 
 const (
@@ -20,7 +26,8 @@ var (
 	errLicenseRemoveFailure  = errors.New("failed to remove license")
 )
 
-type vmListItem struct {
+// VirtualMachine is a vm, as prlctl lists it.
+type VirtualMachine struct {
 	Name        string
 	Description string
 	Hardware    struct {
@@ -54,22 +61,51 @@ func RemoveLicense(ctx context.Context) error {
 	return nil
 }
 
+// Version returns the version of Parallels, as reported by prlctl.
+func Version(ctx context.Context) (string, error) {
+	out, err := run(ctx, controlCmd, "--version")
+	if err != nil {
+		return "", fmt.Errorf("fetching version: %w", err)
+	}
+
+	// prlctl version 19.1.0 (54729)
+	return strings.TrimPrefix(strings.TrimSpace(out), controlCmd+" version "), nil
+}
+
 type CreateOptions struct {
 	Id         string
 	ImagePath  string
 	WorkingDir string
 	MAC        string
 	Network    string
+
+	// overrides of the template's resources, zero keeps the template's value
+	CPUs       int
+	MemorySize int // MiB
+	DiskSize   int // MiB
+
+	// Template, if set, is the vm the vm is cloned from instead of the image,
+	// once switched to its Snapshot
+	Template string
+	Snapshot string
 }
 
 func VirtualMachineCreate(ctx context.Context, opts CreateOptions) error {
 	name := filepath.Base(opts.ImagePath)
 	name = strings.TrimSuffix(name, ".pvm")
 
-	run(ctx, controlCmd, "register", opts.ImagePath)
+	source := name
+	if opts.Template != "" {
+		if err := SnapshotSwitch(ctx, opts.Template, opts.Snapshot); err != nil {
+			return err
+		}
+		source = opts.Template
+	} else {
+		run(ctx, controlCmd, "register", opts.ImagePath)
+	}
 
-	if _, err := run(ctx, controlCmd, "clone", name, "--name", opts.Id, "--linked", "--dst", opts.WorkingDir); err != nil {
-		return fmt.Errorf("cloning image %s (%s): %w", opts.Id, name, err)
+	if _, err := run(ctx, controlCmd, "clone", source, "--name", opts.Id, "--linked", "--dst", opts.WorkingDir); err != nil {
+		return fmt.Errorf("cloning image %s (%s): %w", opts.Id, source, err)
 	}
 
 	if _, err := run(ctx, controlCmd, "set", opts.Id, "--description", name); err != nil {
@@ -80,6 +116,25 @@ func VirtualMachineCreate(ctx context.Context, opts CreateOptions) error {
 		return fmt.Errorf("updating image settings %s: %w", opts.Id, err)
 	}
 
+	var resources []string
+	if opts.CPUs > 0 {
+		resources = append(resources, "--cpus", strconv.Itoa(opts.CPUs))
+	}
+	if opts.MemorySize > 0 {
+		resources = append(resources, "--memsize", strconv.Itoa(opts.MemorySize))
+	}
+	if len(resources) > 0 {
+		if _, err := run(ctx, append([]string{controlCmd, "set", opts.Id}, resources...)...); err != nil {
+			return fmt.Errorf("updating image resources %s: %w", opts.Id, err)
+		}
+	}
+
+	if opts.DiskSize > 0 {
+		if _, err := run(ctx, controlCmd, "set", opts.Id, "--device-set", "hdd0", "--size", strconv.Itoa(opts.DiskSize)); err != nil {
+			return fmt.Errorf("resizing disk %s: %w", opts.Id, err)
+		}
+	}
+
 	if _, err := run(ctx, controlCmd, "start", opts.Id); err != nil {
 		return fmt.Errorf("starting image: %w", err)
 	}
@@ -92,6 +147,21 @@ func VirtualMachineDelete(ctx context.Context, name string) error {
 		return fmt.Errorf("deleting image: %w", err)
 	}
 
+	return VirtualMachineRemove(ctx, name)
+}
+
+// VirtualMachineShutdown asks the vm's guest to shut down, and waits until it
+// has, or the context is done.
+func VirtualMachineShutdown(ctx context.Context, name string) error {
+	if _, err := run(ctx, controlCmd, "stop", name); err != nil {
+		return fmt.Errorf("shutting down vm: %w", err)
+	}
+
+	return nil
+}
+
+// VirtualMachineRemove deletes a stopped vm.
+func VirtualMachineRemove(ctx context.Context, name string) error {
 	if _, err := run(ctx, controlCmd, "delete", name); err != nil {
 		return fmt.Errorf("deleting image: %w", err)
 	}
@@ -99,18 +169,88 @@ func VirtualMachineDelete(ctx context.Context, name string) error {
 	return nil
 }
 
-func VirtualMachineList(ctx context.Context, prefix string) ([]vmListItem, error) {
+// VirtualMachineStop stops the vm without deleting it.
+func VirtualMachineStop(ctx context.Context, name string) error {
+	if _, err := run(ctx, controlCmd, "stop", name, "--kill"); err != nil {
+		return fmt.Errorf("stopping vm: %w", err)
+	}
+
+	return nil
+}
+
+// VirtualMachineRename renames a stopped vm.
+func VirtualMachineRename(ctx context.Context, name, newName string) error {
+	if _, err := run(ctx, controlCmd, "set", name, "--name", newName); err != nil {
+		return fmt.Errorf("renaming vm %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// SnapshotCreate takes a snapshot of the vm, which includes its memory if
+// it's running.
+func SnapshotCreate(ctx context.Context, name, snapshot string) error {
+	if _, err := run(ctx, controlCmd, "snapshot", name, "--name", snapshot); err != nil {
+		return fmt.Errorf("taking snapshot %s of %s: %w", snapshot, name, err)
+	}
+
+	return nil
+}
+
+// SnapshotSwitch reverts the vm to the named snapshot, leaving it suspended if
+// the snapshot was taken of the running vm.
+func SnapshotSwitch(ctx context.Context, name, snapshot string) error {
+	rawList, err := run(ctx, controlCmd, "snapshot-list", name, "-j")
+	if err != nil {
+		return fmt.Errorf("listing snapshots of %s: %w", name, err)
+	}
+
+	// snapshots are keyed by their id
+	var snapshots map[string]struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(rawList), &snapshots); err != nil {
+		return fmt.Errorf("listing snapshots of %s: %w", name, err)
+	}
+
+	for id, item := range snapshots {
+		if item.Name != snapshot {
+			continue
+		}
+
+		if _, err := run(ctx, controlCmd, "snapshot-switch", name, "--id", id, "--skip-resume"); err != nil {
+			return fmt.Errorf("switching %s to snapshot %s: %w", name, snapshot, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s of %s", hypervisor.ErrSnapshotNotFound, snapshot, name)
+}
+
+// VirtualMachineExec runs a command inside the vm with prlctl exec, which
+// requires Parallels Tools to be installed in the guest.
+func VirtualMachineExec(ctx context.Context, name string, cmd hypervisor.ExecCommand) (int, error) {
+	return hvutil.Exec(ctx, append([]string{controlCmd, "exec", name}, cmd.Args...), cmd)
+}
+
+// ImageUnregister unregisters an image registered by VirtualMachineCreate, so
+// that it can be deleted. Images that were never registered are ignored.
+func ImageUnregister(ctx context.Context, name string) {
+	run(ctx, controlCmd, "unregister", name)
+}
+
+func VirtualMachineList(ctx context.Context, prefix string) ([]VirtualMachine, error) {
 	rawList, err := run(ctx, controlCmd, "list", "-a", "-i", "-j")
 	if err != nil {
 		return nil, err
 	}
 
-	var items []vmListItem
+	var items []VirtualMachine
 	if err := json.Unmarshal([]byte(rawList), &items); err != nil {
 		return nil, err
 	}
 
-	filtered := make([]vmListItem, 0, len(items))
+	filtered := make([]VirtualMachine, 0, len(items))
 	for _, item := range items {
 		if !strings.HasPrefix(item.Name, prefix) {
 			continue
@@ -147,22 +287,35 @@ func NetworkList(ctx context.Context, prefix string) ([]string, error) {
 	return networks, nil
 }
 
-func run(ctx context.Context, commands ...string) (string, error) {
-	var stdout strings.Builder
-	var stderr strings.Builder
+// testing hook
+var run func(ctx context.Context, commands ...string) (string, error)
 
-	cmd := exec.CommandContext(ctx, commands[0], commands[1:]...)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+func init() {
+	run = func(ctx context.Context, commands ...string) (string, error) {
+		var stdout strings.Builder
+		var stderr strings.Builder
 
-	var errExit *exec.ExitError
-	if errors.As(err, &errExit) {
-		return stdout.String(), fmt.Errorf("%s: %w (%s)", strings.Join(commands, " "), err, stderr.String())
-	}
-	if err != nil {
-		return stdout.String(), fmt.Errorf("%s: %w", commands[0], err)
-	}
+		cmd := exec.CommandContext(ctx, commands[0], commands[1:]...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		start := time.Now()
+		err := cmd.Run()
+		hvutil.LogCommand(ctx, commands, start, err, stderr.String())
+
+		var subcommand string
+		if len(commands) > 1 {
+			subcommand = commands[1]
+		}
+		metrics.ObserveCommand(commands[0], subcommand, err)
 
-	return stdout.String(), nil
+		var errExit *exec.ExitError
+		if errors.As(err, &errExit) {
+			return stdout.String(), fmt.Errorf("%s: %w (%s)", strings.Join(commands, " "), err, stderr.String())
+		}
+		if err != nil {
+			return stdout.String(), fmt.Errorf("%s: %w", commands[0], err)
+		}
+
+		return stdout.String(), nil
+	}
 }
@@ -0,0 +1,226 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestSnapshotCreate(t *testing.T) {
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	m := &mockRun{calls: []mockCall{
+		{commands: []string{"prlctl", "snapshot", "nesting-template-abc", "--name", "warm"}},
+	}}
+	run = m.fn()
+
+	require.NoError(t, SnapshotCreate(context.TODO(), "nesting-template-abc", "warm"))
+	m.verify(t)
+
+	m = &mockRun{calls: []mockCall{
+		{commands: []string{"prlctl", "snapshot", "nesting-template-abc", "--name", "warm"}, returnErr: fmt.Errorf("no can do")},
+	}}
+	run = m.fn()
+
+	assert.Error(t, SnapshotCreate(context.TODO(), "nesting-template-abc", "warm"))
+	m.verify(t)
+}
+
+func TestSnapshotSwitch(t *testing.T) {
+	const list = `{
+	"{0b6a1d0e-6a2f-4bb4-8e0e-3c7d5f1c2a11}": {"name": "cold", "date": "2024-05-01 10:00:00", "state": "poweroff", "current": false, "parent": ""},
+	"{5f0c3a9e-1d2b-4c6a-9f7e-8a1b2c3d4e5f}": {"name": "warm", "date": "2024-05-01 10:05:00", "state": "poweron", "current": true, "parent": "{0b6a1d0e-6a2f-4bb4-8e0e-3c7d5f1c2a11}"}
+}`
+
+	listCmd := []string{"prlctl", "snapshot-list", "nesting-template-abc", "-j"}
+	switchCmd := []string{"prlctl", "snapshot-switch", "nesting-template-abc", "--id", "{5f0c3a9e-1d2b-4c6a-9f7e-8a1b2c3d4e5f}", "--skip-resume"}
+
+	cases := []struct {
+		name     string
+		snapshot string
+		calls    []mockCall
+		err      bool
+		errIs    error
+	}{
+		{
+			name:     "switched",
+			snapshot: "warm",
+			calls: []mockCall{
+				{commands: listCmd, returnString: list},
+				{commands: switchCmd},
+			},
+		},
+		{
+			name:     "not found",
+			snapshot: "missing",
+			calls: []mockCall{
+				{commands: listCmd, returnString: list},
+			},
+			err:   true,
+			errIs: hypervisor.ErrSnapshotNotFound,
+		},
+		{
+			name:     "no snapshots",
+			snapshot: "warm",
+			calls: []mockCall{
+				{commands: listCmd, returnString: "{}"},
+			},
+			err:   true,
+			errIs: hypervisor.ErrSnapshotNotFound,
+		},
+		{
+			name:     "invalid list",
+			snapshot: "warm",
+			calls: []mockCall{
+				{commands: listCmd, returnString: "garbage"},
+			},
+			err: true,
+		},
+		{
+			name:     "list failure",
+			snapshot: "warm",
+			calls: []mockCall{
+				{commands: listCmd, returnErr: fmt.Errorf("no can do")},
+			},
+			err: true,
+		},
+		{
+			name:     "switch failure",
+			snapshot: "warm",
+			calls: []mockCall{
+				{commands: listCmd, returnString: list},
+				{commands: switchCmd, returnErr: fmt.Errorf("no can do")},
+			},
+			err: true,
+		},
+	}
+
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mockRun{calls: tc.calls}
+			run = m.fn()
+
+			err := SnapshotSwitch(context.TODO(), "nesting-template-abc", tc.snapshot)
+			m.verify(t)
+
+			if !tc.err {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			if tc.errIs != nil {
+				assert.ErrorIs(t, err, tc.errIs)
+			}
+		})
+	}
+}
+
+func TestVirtualMachineCreateFromTemplate(t *testing.T) {
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	m := &mockRun{calls: []mockCall{
+		{commands: []string{"prlctl", "snapshot-list", "nesting-template-abc", "-j"}, returnString: `{"{1}": {"name": "warm"}}`},
+		{commands: []string{"prlctl", "snapshot-switch", "nesting-template-abc", "--id", "{1}", "--skip-resume"}},
+		{commands: []string{"prlctl", "clone", "nesting-template-abc", "--name", "nesting-def", "--linked", "--dst", "/work"}},
+		{commands: []string{"prlctl", "set", "nesting-def", "--description", "macos"}},
+		{commands: []string{"prlctl", "set", "nesting-def", "--device-set", "net0", "--type", "host-only", "--iface", "nesting-0", "--adapter-type", "virtio", "--mac", "001C42AABBCC"}},
+		{commands: []string{"prlctl", "start", "nesting-def"}},
+	}}
+	run = m.fn()
+
+	err := VirtualMachineCreate(context.TODO(), CreateOptions{
+		Id:         "nesting-def",
+		ImagePath:  "/images/macos.pvm",
+		WorkingDir: "/work",
+		MAC:        "001C42AABBCC",
+		Network:    "nesting-0",
+		Template:   "nesting-template-abc",
+		Snapshot:   "warm",
+	})
+	require.NoError(t, err)
+	m.verify(t)
+}
+
+func TestVirtualMachineList(t *testing.T) {
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	m := &mockRun{calls: []mockCall{
+		{
+			commands: []string{"prlctl", "list", "-a", "-i", "-j"},
+			returnString: `[
+	{"Name": "nesting-abc", "Description": "macos", "Hardware": {"net0": {"iface": "nesting-0", "mac": "001C42AABBCC"}}},
+	{"Name": "not-nesting", "Description": "macos", "Hardware": {"net0": {"iface": "Shared", "mac": "001C42DDEEFF"}}}
+]`,
+		},
+	}}
+	run = m.fn()
+
+	items, err := VirtualMachineList(context.TODO(), "nesting-")
+	require.NoError(t, err)
+	m.verify(t)
+
+	require.Len(t, items, 1)
+	assert.Equal(t, "nesting-abc", items[0].Name)
+	assert.Equal(t, "nesting-0", items[0].Hardware.Net0.Iface)
+	assert.Equal(t, "001C42AABBCC", items[0].Hardware.Net0.Mac)
+}
+
+// mockCall is a command expected to be run, and what running it returns.
+type mockCall struct {
+	commands     []string
+	returnString string
+	returnErr    error
+}
+
+// mockRun expects its calls to be run in order.
+type mockRun struct {
+	calls []mockCall
+	got   [][]string
+}
+
+func (m *mockRun) fn() func(context.Context, ...string) (string, error) {
+	return func(_ context.Context, commands ...string) (string, error) {
+		m.got = append(m.got, commands)
+		if len(m.got) > len(m.calls) {
+			return "", fmt.Errorf("unexpected command: %s", strings.Join(commands, " "))
+		}
+
+		call := m.calls[len(m.got)-1]
+		return call.returnString, call.returnErr
+	}
+}
+
+func (m *mockRun) verify(t *testing.T) {
+	expect := make([]string, 0, len(m.calls))
+	for _, call := range m.calls {
+		expect = append(expect, strings.Join(call.commands, " "))
+	}
+
+	got := make([]string, 0, len(m.got))
+	for _, commands := range m.got {
+		got = append(got, strings.Join(commands, " "))
+	}
+
+	assert.Equal(t, strings.Join(expect, "\n"), strings.Join(got, "\n"))
+}
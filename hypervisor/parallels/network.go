@@ -52,6 +52,18 @@ func (p *Parallels) populateNetworks(ctx context.Context) error {
 		for _, network := range networks {
 			p.networks[network] = false
 		}
+
+		// the networks of vms, and of snapshots' templates, that outlived a
+		// restart stay acquired
+		items, err := control.VirtualMachineList(ctx, vmNamePrefix)
+		if err != nil {
+			return fmt.Errorf("fetching initial vm list: %v", err)
+		}
+		for _, item := range items {
+			if _, ok := p.networks[item.Hardware.Net0.Iface]; ok {
+				p.networks[item.Hardware.Net0.Iface] = true
+			}
+		}
 	}
 
 	return nil
@@ -0,0 +1,461 @@
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/integrity"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/qemu/internal/control"
+)
+
+const (
+	vmAddressTimeout = 5 * time.Minute
+	vmStopTimeout    = 30 * time.Second
+
+	vmNamePrefix = "nesting-"
+)
+
+type Qemu struct {
+	mu  sync.Mutex
+	vms map[string]virtualMachine
+	cfg Config
+
+	verifier *integrity.Verifier
+}
+
+type virtualMachine struct {
+	id   string
+	name string
+	addr string
+
+	pidFile string
+}
+
+// vmMetadata is stored alongside each VM's disk, so that VMs can be restored
+// after a restart: qemu is daemonized, so VMs outlive the nesting process.
+type vmMetadata struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+}
+
+type Config struct {
+	ImageDirectory   string `json:"image_directory"`
+	WorkingDirectory string `json:"working_directory"`
+
+	// Binary is the qemu-system binary to use, defaulting to the one
+	// matching the host architecture.
+	Binary  string `json:"binary"`
+	Machine string `json:"machine"`
+
+	// Accelerator is either "kvm" or "tcg". If empty, kvm is used when
+	// /dev/kvm is accessible, otherwise tcg.
+	Accelerator string `json:"accelerator"`
+	Firmware    string `json:"firmware"`
+
+	CPUs int `json:"cpus"`
+	// Memory is the guest memory size in MiB.
+	Memory int `json:"memory"`
+
+	// Bridge, if set, attaches VMs to an existing host bridge rather than
+	// using user-mode networking. The guest address is then discovered
+	// from the DHCP LeaseFile.
+	Bridge    string `json:"bridge"`
+	LeaseFile string `json:"lease_file"`
+
+	integrity.Config
+}
+
+func New(config []byte) (*Qemu, error) {
+	hv := &Qemu{
+		vms: make(map[string]virtualMachine),
+	}
+
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &hv.cfg); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	if hv.cfg.ImageDirectory == "" || hv.cfg.WorkingDirectory == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get current user directory: %w", err)
+		}
+
+		if hv.cfg.ImageDirectory == "" {
+			hv.cfg.ImageDirectory = filepath.Join(home, ".nesting/images")
+			os.MkdirAll(hv.cfg.ImageDirectory, 0o777)
+		}
+		if hv.cfg.WorkingDirectory == "" {
+			hv.cfg.WorkingDirectory = filepath.Join(home, ".nesting/data")
+			os.MkdirAll(hv.cfg.WorkingDirectory, 0o777)
+		}
+	}
+
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	hv.verifier = verifier
+
+	hv.restore()
+
+	return hv, nil
+}
+
+func (hv *Qemu) Init(ctx context.Context, config []byte) error {
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &hv.cfg); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	if hv.cfg.Bridge != "" && hv.cfg.LeaseFile == "" {
+		return fmt.Errorf("invalid config: lease_file is required when using a bridge")
+	}
+
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return err
+	}
+	hv.verifier = verifier
+
+	return nil
+}
+
+func (hv *Qemu) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Capabilities reports QEMU's version and features. qemu is daemonized, so
+// VMs outlive the nesting process. With user-mode networking, addresses are
+// the local port forwarded to the guest's SSH port.
+func (hv *Qemu) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	version, err := control.Version(ctx, hv.createOptions().Binary)
+	if err != nil {
+		return hypervisor.Capabilities{}, err
+	}
+
+	format := hypervisor.AddressHostPort
+	if hv.cfg.Bridge != "" {
+		format = hypervisor.AddressIP
+	}
+
+	return hypervisor.Capabilities{
+		Version: version,
+		Features: []hypervisor.Feature{
+			hypervisor.FeatureListNames,
+			hypervisor.FeaturePersistentVMs,
+			hypervisor.FeatureResourceOverrides,
+			hypervisor.FeatureImages,
+		},
+		AddressFormat: format,
+	}, nil
+}
+
+func (hv *Qemu) Create(ctx context.Context, name string, createOpts hypervisor.CreateOptions) (vm hypervisor.VirtualMachine, err error) {
+	imagePath, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".qcow2")
+	if err != nil {
+		return nil, err
+	}
+	if imagePath, err = filepath.Abs(imagePath); err != nil {
+		return nil, fmt.Errorf("resolving image path: %w", err)
+	}
+	if _, err := os.Stat(imagePath); err != nil {
+		return nil, fmt.Errorf("opening image: %w", err)
+	}
+	if err := hv.verifier.Verify(ctx, imagePath); err != nil {
+		return nil, err
+	}
+
+	var id, mac string
+	if id, err = hvutil.UniqueID(); err != nil {
+		return nil, fmt.Errorf("generating unique id: %w", err)
+	}
+	if mac, err = hvutil.GenerateMAC(); err != nil {
+		return nil, fmt.Errorf("generating mac address: %w", err)
+	}
+
+	id = vmNamePrefix + id
+	workingDir := filepath.Join(hv.cfg.WorkingDirectory, id)
+
+	opts := hv.createOptions()
+	if createOpts.CPUs > 0 {
+		opts.CPUs = int(createOpts.CPUs)
+	}
+	if createOpts.MemoryBytes > 0 {
+		if opts.MemorySize, err = hvutil.WholeUnits("memory", createOpts.MemoryBytes, hvutil.MiB); err != nil {
+			return nil, err
+		}
+	}
+	opts.Id = id
+	opts.MAC = mac
+	opts.DiskPath = filepath.Join(workingDir, "disk.qcow2")
+	opts.PidFile = filepath.Join(workingDir, "qemu.pid")
+
+	log := hvutil.Logger("qemu").With("id", id, "name", name)
+
+	defer func() {
+		if err != nil {
+			if err := control.VirtualMachineDelete(context.Background(), opts.PidFile, id, vmStopTimeout); err != nil {
+				log.Warn("cleaning up failed vm", "error", err)
+			}
+			os.RemoveAll(workingDir)
+		}
+	}()
+
+	if err := os.MkdirAll(workingDir, 0o777); err != nil {
+		return nil, fmt.Errorf("creating vm directory: %w", err)
+	}
+
+	if err := control.DiskCreate(ctx, imagePath, opts.DiskPath, createOpts.DiskSizeBytes); err != nil {
+		return nil, fmt.Errorf("cloning vm: %w", err)
+	}
+
+	if opts.Bridge == "" {
+		// the port is held until qemu is listening on it, see freePort.
+		portMu.Lock()
+		opts.ForwardPort, err = freePort()
+		if err == nil {
+			err = control.VirtualMachineCreate(ctx, opts)
+		}
+		portMu.Unlock()
+	} else {
+		err = control.VirtualMachineCreate(ctx, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("starting vm: %w", err)
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", opts.ForwardPort)
+	if opts.Bridge != "" {
+		addr, err = getAddress(ctx, hv.cfg.LeaseFile, control.FormatMAC(mac), vmAddressTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	meta, err := json.Marshal(vmMetadata{Name: name, Addr: addr})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling vm metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(workingDir, "vm.json"), meta, 0o666); err != nil {
+		return nil, fmt.Errorf("writing vm metadata: %w", err)
+	}
+
+	hv.mu.Lock()
+	hv.vms[id] = virtualMachine{
+		id:      id,
+		name:    name,
+		addr:    addr,
+		pidFile: opts.PidFile,
+	}
+	hv.mu.Unlock()
+
+	log.Info("vm started", "addr", addr, "mac", control.FormatMAC(mac), "accelerator", opts.Accelerator)
+
+	return hypervisor.VirtualMachineInfo{
+		Id:        id,
+		Name:      name,
+		Addr:      addr,
+		Endpoints: hypervisor.SSHEndpoints(addr),
+	}, nil
+}
+
+func (hv *Qemu) Delete(ctx context.Context, id string) error {
+	hv.mu.Lock()
+	vm, ok := hv.vms[id]
+	hv.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no vm (%v) found", id)
+	}
+
+	if err := control.VirtualMachineDelete(ctx, vm.pidFile, id, vmStopTimeout); err != nil {
+		return fmt.Errorf("stopping vm (%v): %w", id, err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(hv.cfg.WorkingDirectory, id)); err != nil {
+		return fmt.Errorf("deleting vm dir: %w", err)
+	}
+
+	hv.mu.Lock()
+	delete(hv.vms, id)
+	hv.mu.Unlock()
+
+	hvutil.Logger("qemu").Info("vm deleted", "id", id)
+
+	return nil
+}
+
+func (hv *Qemu) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	vms := make([]hypervisor.VirtualMachine, 0, len(hv.vms))
+	for _, vm := range hv.vms {
+		vms = append(vms, hypervisor.VirtualMachineInfo{
+			Id:        vm.id,
+			Name:      vm.name,
+			Addr:      vm.addr,
+			Endpoints: hypervisor.SSHEndpoints(vm.addr),
+		})
+	}
+
+	return vms, nil
+}
+
+// ListImages returns the qcow2 images in the image directory.
+func (hv *Qemu) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	return hvutil.ListImages(hv.cfg.ImageDirectory, ".qcow2")
+}
+
+// ImportImage copies a qcow2 image into the image directory.
+func (hv *Qemu) ImportImage(ctx context.Context, name, source string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".qcow2")
+	if err != nil {
+		return err
+	}
+
+	if err := hvutil.ImportImage(ctx, source, path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("qemu").Info("image imported", "name", name, "source", source)
+
+	return nil
+}
+
+func (hv *Qemu) DeleteImage(ctx context.Context, name string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, ".qcow2")
+	if err != nil {
+		return err
+	}
+
+	if err := hvutil.DeleteImage(path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("qemu").Info("image deleted", "name", name)
+
+	return nil
+}
+
+// restore adopts VMs still running from a previous run. VM directories whose
+// qemu process has since exited, or that were never fully created, are
+// removed.
+func (hv *Qemu) restore() {
+	entries, err := os.ReadDir(hv.cfg.WorkingDirectory)
+	if err != nil {
+		return
+	}
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	log := hvutil.Logger("qemu")
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), vmNamePrefix) {
+			continue
+		}
+
+		id := entry.Name()
+		dir := filepath.Join(hv.cfg.WorkingDirectory, id)
+		pidFile := filepath.Join(dir, "qemu.pid")
+
+		var meta vmMetadata
+		buf, err := os.ReadFile(filepath.Join(dir, "vm.json"))
+		if err == nil {
+			err = json.Unmarshal(buf, &meta)
+		}
+
+		// the pid file's process is only the vm's if it's the qemu started
+		// with its id, as the pid can have been reused since, such as after a
+		// reboot
+		running := control.VirtualMachineRunning(pidFile, id)
+		if err != nil || !running {
+			log.Info("removing stale vm", "id", id)
+			if running {
+				control.VirtualMachineDelete(context.Background(), pidFile, id, vmStopTimeout)
+			}
+			os.RemoveAll(dir)
+			continue
+		}
+
+		log.Info("restored vm", "id", id, "name", meta.Name, "addr", meta.Addr)
+
+		hv.vms[id] = virtualMachine{
+			id:      id,
+			name:    meta.Name,
+			addr:    meta.Addr,
+			pidFile: pidFile,
+		}
+	}
+}
+
+// createOptions returns the create options derived from the config, with
+// defaults applied for anything left unset.
+func (hv *Qemu) createOptions() control.CreateOptions {
+	opts := control.CreateOptions{
+		Binary:      hv.cfg.Binary,
+		Machine:     hv.cfg.Machine,
+		Accelerator: hv.cfg.Accelerator,
+		Firmware:    hv.cfg.Firmware,
+		CPUs:        hv.cfg.CPUs,
+		MemorySize:  hv.cfg.Memory,
+		Bridge:      hv.cfg.Bridge,
+	}
+
+	if opts.Binary == "" {
+		opts.Binary = "qemu-system-x86_64"
+		if runtime.GOARCH == "arm64" {
+			opts.Binary = "qemu-system-aarch64"
+		}
+	}
+
+	if opts.Machine == "" {
+		opts.Machine = "q35"
+		if runtime.GOARCH == "arm64" {
+			opts.Machine = "virt"
+		}
+	}
+
+	if opts.Accelerator == "" {
+		opts.Accelerator = "tcg"
+		if kvmAvailable() {
+			opts.Accelerator = "kvm"
+		}
+	}
+
+	if opts.CPUs == 0 {
+		opts.CPUs = 2
+	}
+
+	if opts.MemorySize == 0 {
+		opts.MemorySize = 4096
+	}
+
+	return opts
+}
+
+func kvmAvailable() bool {
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+
+	return true
+}
@@ -0,0 +1,65 @@
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// TestRestoreStalePidFile checks that VMs whose pid file references a live,
+// but unrelated, process aren't restored, and that the process, here the
+// test's own, isn't signalled.
+func TestRestoreStalePidFile(t *testing.T) {
+	workingDir := t.TempDir()
+
+	writeVM := func(id string, meta bool) string {
+		dir := filepath.Join(workingDir, id)
+		require.NoError(t, os.Mkdir(dir, 0o777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "qemu.pid"), []byte(fmt.Sprintf("%d\n", os.Getpid())), 0o666))
+
+		if meta {
+			buf, err := json.Marshal(vmMetadata{Name: "image", Addr: "127.0.0.1:2222"})
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "vm.json"), buf, 0o666))
+		}
+
+		return dir
+	}
+
+	withMeta := writeVM(vmNamePrefix+"abc", true)
+	withoutMeta := writeVM(vmNamePrefix+"def", false)
+
+	config, err := json.Marshal(Config{ImageDirectory: t.TempDir(), WorkingDirectory: workingDir})
+	require.NoError(t, err)
+
+	hv, err := New(config)
+	require.NoError(t, err)
+
+	vms, err := hv.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, vms)
+
+	assert.NoDirExists(t, withMeta)
+	assert.NoDirExists(t, withoutMeta)
+}
+
+func TestCreateInvalidImageName(t *testing.T) {
+	config, err := json.Marshal(Config{ImageDirectory: t.TempDir(), WorkingDirectory: t.TempDir()})
+	require.NoError(t, err)
+
+	hv, err := New(config)
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "../image", "images/image", ".hidden"} {
+		_, err := hv.Create(context.Background(), name, hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, hypervisor.ErrInvalidImageName, name)
+	}
+}
@@ -0,0 +1,277 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
+)
+
+const imageCmd = "qemu-img"
+
+type CreateOptions struct {
+	Id          string
+	Binary      string
+	Machine     string
+	Accelerator string
+	CPUs        int
+	MemorySize  int
+	Firmware    string
+	DiskPath    string
+	PidFile     string
+	MAC         string
+
+	// Bridge attaches the VM to an existing host bridge. If empty, user-mode
+	// networking is used and ForwardPort on the host is forwarded to the
+	// guest's ssh port.
+	Bridge      string
+	ForwardPort int
+}
+
+// Version returns the version of the qemu-system binary.
+func Version(ctx context.Context, binary string) (string, error) {
+	out, err := run(ctx, binary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("fetching version: %w", err)
+	}
+
+	// QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)
+	line, _, _ := strings.Cut(out, "\n")
+	_, version, ok := strings.Cut(line, "version ")
+	if !ok {
+		return "", fmt.Errorf("unexpected version %q", line)
+	}
+	version, _, _ = strings.Cut(version, " ")
+
+	return version, nil
+}
+
+// DiskCreate creates a copy-on-write overlay of the base image. If size is
+// non-zero, the overlay's virtual disk is resized to size bytes, which can't be
+// smaller than the base image.
+func DiskCreate(ctx context.Context, base, overlay string, size uint64) error {
+	args := []string{imageCmd, "create", "-q", "-f", "qcow2", "-F", "qcow2", "-b", base, overlay}
+	if size > 0 {
+		args = append(args, strconv.FormatUint(size, 10))
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("creating overlay %s (%s): %w", overlay, base, err)
+	}
+
+	return nil
+}
+
+func VirtualMachineCreate(ctx context.Context, opts CreateOptions) error {
+	cpu := "host"
+	if opts.Accelerator == "tcg" {
+		cpu = "max"
+	}
+
+	args := []string{
+		opts.Binary,
+		"-name", opts.Id,
+		"-machine", opts.Machine + ",accel=" + opts.Accelerator,
+		"-cpu", cpu,
+		"-smp", strconv.Itoa(opts.CPUs),
+		"-m", strconv.Itoa(opts.MemorySize),
+	}
+
+	if opts.Firmware != "" {
+		args = append(args, "-bios", opts.Firmware)
+	}
+
+	netdev := "bridge,id=net0,br=" + opts.Bridge
+	if opts.Bridge == "" {
+		netdev = fmt.Sprintf("user,id=net0,hostfwd=tcp:127.0.0.1:%d-:22", opts.ForwardPort)
+	}
+
+	args = append(args,
+		"-drive", "file="+opts.DiskPath+",if=virtio,format=qcow2",
+		"-netdev", netdev,
+		"-device", "virtio-net-pci,netdev=net0,mac="+FormatMAC(opts.MAC),
+		"-display", "none",
+		"-daemonize",
+		"-pidfile", opts.PidFile,
+	)
+
+	// with -daemonize, qemu only exits once the vm has been initialized, so
+	// any configuration or startup error is returned here.
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("starting vm %s: %w", opts.Id, err)
+	}
+
+	return nil
+}
+
+// VirtualMachineRunning returns whether the qemu process of the vm, referenced
+// by the pid file, is still running.
+func VirtualMachineRunning(pidFile, id string) bool {
+	proc, err := findProcess(pidFile, id)
+	return err == nil && proc != nil
+}
+
+// VirtualMachineDelete stops the qemu process of the vm, referenced by the pid
+// file, escalating to SIGKILL if it has not exited before the timeout. A pid
+// file referencing any other process, such as after a reboot reused its pid,
+// is ignored.
+func VirtualMachineDelete(ctx context.Context, pidFile, id string, timeout time.Duration) error {
+	proc, err := findProcess(pidFile, id)
+	if err != nil {
+		return err
+	}
+	if proc == nil {
+		return nil
+	}
+
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+		return fmt.Errorf("terminating process %d: %w", proc.Pid, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if ok, err := isVirtualMachine(proc.Pid, id); err != nil || !ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := proc.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				return fmt.Errorf("killing process %d: %w", proc.Pid, err)
+			}
+			return nil
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// findProcess returns the qemu process of the vm referenced by the pid file,
+// or nil if the pid file doesn't exist, or the process isn't the vm's.
+func findProcess(pidFile, id string) (*os.Process, error) {
+	buf, err := os.ReadFile(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading pid file: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("parsing pid file: %w", err)
+	}
+
+	ok, err := isVirtualMachine(pid, id)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("finding process %d: %w", pid, err)
+	}
+
+	return proc, nil
+}
+
+// isVirtualMachine returns whether the process is the vm's qemu, started with
+// -name <id>, rather than a process that reused its pid.
+func isVirtualMachine(pid int, id string) (bool, error) {
+	args, err := processArgs(pid)
+	if err != nil {
+		return false, fmt.Errorf("reading process %d command line: %w", pid, err)
+	}
+
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-name" && args[i+1] == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// processArgs returns the process' command line, or nil if there's no such
+// process. It's read from /proc where there is one, and from ps otherwise.
+func processArgs(pid int) ([]string, error) {
+	buf, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err == nil {
+		return strings.Split(strings.TrimRight(string(buf), "\x00"), "\x00"), nil
+	}
+	if _, err := os.Stat("/proc/self/cmdline"); err == nil {
+		return nil, nil
+	}
+
+	out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	var errExit *exec.ExitError
+	if errors.As(err, &errExit) {
+		// ps exits non-zero if there's no such process
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(out)), nil
+}
+
+// FormatMAC converts a hex encoded MAC address into its colon separated form.
+func FormatMAC(mac string) string {
+	if strings.Contains(mac, ":") || len(mac) != 12 {
+		return strings.ToLower(mac)
+	}
+
+	parts := make([]string, 0, 6)
+	for i := 0; i < len(mac); i += 2 {
+		parts = append(parts, mac[i:i+2])
+	}
+
+	return strings.ToLower(strings.Join(parts, ":"))
+}
+
+// testing hook
+var run func(ctx context.Context, commands ...string) (string, error)
+
+func init() {
+	run = func(ctx context.Context, commands ...string) (string, error) {
+		var stdout strings.Builder
+		var stderr strings.Builder
+
+		cmd := exec.CommandContext(ctx, commands[0], commands[1:]...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		start := time.Now()
+		err := cmd.Run()
+		hvutil.LogCommand(ctx, commands, start, err, stderr.String())
+
+		// qemu-img has subcommands, qemu-system-* only has flags
+		var subcommand string
+		if len(commands) > 1 && !strings.HasPrefix(commands[1], "-") {
+			subcommand = commands[1]
+		}
+		metrics.ObserveCommand(commands[0], subcommand, err)
+
+		var errExit *exec.ExitError
+		if errors.As(err, &errExit) {
+			return stdout.String(), fmt.Errorf("%s: %w (%s)", strings.Join(commands, " "), err, stderr.String())
+		}
+		if err != nil {
+			return stdout.String(), fmt.Errorf("%s: %w", commands[0], err)
+		}
+
+		return stdout.String(), nil
+	}
+}
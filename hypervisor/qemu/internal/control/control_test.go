@@ -0,0 +1,252 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualMachineCreate(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   CreateOptions
+		expect *mockRun
+		err    bool
+	}{
+		{
+			name: "user networking",
+			opts: CreateOptions{
+				Id:          "nesting-abc",
+				Binary:      "qemu-system-x86_64",
+				Machine:     "q35",
+				Accelerator: "kvm",
+				CPUs:        2,
+				MemorySize:  4096,
+				DiskPath:    "/data/nesting-abc/disk.qcow2",
+				PidFile:     "/data/nesting-abc/qemu.pid",
+				MAC:         "02aabbccddee",
+				ForwardPort: 2222,
+			},
+			expect: &mockRun{
+				commands: []string{
+					"qemu-system-x86_64",
+					"-name", "nesting-abc",
+					"-machine", "q35,accel=kvm",
+					"-cpu", "host",
+					"-smp", "2",
+					"-m", "4096",
+					"-drive", "file=/data/nesting-abc/disk.qcow2,if=virtio,format=qcow2",
+					"-netdev", "user,id=net0,hostfwd=tcp:127.0.0.1:2222-:22",
+					"-device", "virtio-net-pci,netdev=net0,mac=02:aa:bb:cc:dd:ee",
+					"-display", "none",
+					"-daemonize",
+					"-pidfile", "/data/nesting-abc/qemu.pid",
+				},
+			},
+		},
+		{
+			name: "bridge networking with tcg and firmware",
+			opts: CreateOptions{
+				Id:          "nesting-abc",
+				Binary:      "qemu-system-aarch64",
+				Machine:     "virt",
+				Accelerator: "tcg",
+				CPUs:        4,
+				MemorySize:  2048,
+				Firmware:    "/usr/share/AAVMF/AAVMF_CODE.fd",
+				DiskPath:    "disk.qcow2",
+				PidFile:     "qemu.pid",
+				MAC:         "02aabbccddee",
+				Bridge:      "br0",
+			},
+			expect: &mockRun{
+				commands: []string{
+					"qemu-system-aarch64",
+					"-name", "nesting-abc",
+					"-machine", "virt,accel=tcg",
+					"-cpu", "max",
+					"-smp", "4",
+					"-m", "2048",
+					"-bios", "/usr/share/AAVMF/AAVMF_CODE.fd",
+					"-drive", "file=disk.qcow2,if=virtio,format=qcow2",
+					"-netdev", "bridge,id=net0,br=br0",
+					"-device", "virtio-net-pci,netdev=net0,mac=02:aa:bb:cc:dd:ee",
+					"-display", "none",
+					"-daemonize",
+					"-pidfile", "qemu.pid",
+				},
+			},
+		},
+		{
+			name: "check err",
+			opts: CreateOptions{Binary: "qemu-system-x86_64"},
+			expect: &mockRun{
+				returnErr: fmt.Errorf("no can do"),
+			},
+			err: true,
+		},
+	}
+
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run = tc.expect.fn()
+			err := VirtualMachineCreate(context.TODO(), tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			tc.expect.verify(t)
+		})
+	}
+}
+
+func TestDiskCreate(t *testing.T) {
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	expect := &mockRun{
+		commands: []string{"qemu-img", "create", "-q", "-f", "qcow2", "-F", "qcow2", "-b", "/images/base.qcow2", "/data/disk.qcow2"},
+	}
+	run = expect.fn()
+
+	assert.Nil(t, DiskCreate(context.TODO(), "/images/base.qcow2", "/data/disk.qcow2", 0))
+	expect.verify(t)
+
+	expect = &mockRun{
+		commands: []string{"qemu-img", "create", "-q", "-f", "qcow2", "-F", "qcow2", "-b", "/images/base.qcow2", "/data/disk.qcow2", "21474836480"},
+	}
+	run = expect.fn()
+
+	assert.Nil(t, DiskCreate(context.TODO(), "/images/base.qcow2", "/data/disk.qcow2", 20<<30))
+	expect.verify(t)
+}
+
+// TestFakeBinary runs a fake qemu binary that daemonizes a long-running
+// process, and then deletes it via its pid file.
+func TestFakeBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake qemu binary requires a posix shell")
+	}
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "qemu-system-fake")
+	pidFile := filepath.Join(dir, "qemu.pid")
+
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-pidfile" ]; then pidfile="$2"; fi
+	if [ "$1" = "-name" ]; then name="$2"; fi
+	shift
+done
+sh -c 'sleep 60; :' qemu-system-fake -name "$name" >/dev/null 2>&1 &
+echo $! > "$pidfile"
+`
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0o755))
+
+	err := VirtualMachineCreate(context.Background(), CreateOptions{
+		Id:          "nesting-abc",
+		Binary:      binary,
+		Machine:     "q35",
+		Accelerator: "tcg",
+		CPUs:        1,
+		MemorySize:  512,
+		DiskPath:    filepath.Join(dir, "disk.qcow2"),
+		PidFile:     pidFile,
+		MAC:         "02aabbccddee",
+		ForwardPort: 2222,
+	})
+	require.NoError(t, err)
+	require.FileExists(t, pidFile)
+	require.True(t, VirtualMachineRunning(pidFile, "nesting-abc"))
+
+	// the process is only the vm's if it was started with its name
+	require.False(t, VirtualMachineRunning(pidFile, "nesting-def"))
+
+	require.NoError(t, VirtualMachineDelete(context.Background(), pidFile, "nesting-abc", 2*time.Second))
+	require.Eventually(t, func() bool {
+		return !VirtualMachineRunning(pidFile, "nesting-abc")
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.False(t, VirtualMachineRunning(filepath.Join(dir, "missing.pid"), "nesting-abc"))
+
+	// deleting a vm without a pid file is a no-op
+	require.NoError(t, VirtualMachineDelete(context.Background(), filepath.Join(dir, "missing.pid"), "nesting-abc", time.Second))
+}
+
+// TestStalePidFile checks that a pid file left behind, whose pid now belongs
+// to an unrelated process, isn't taken for the vm or signalled.
+func TestStalePidFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pid files are only used on posix systems")
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "qemu.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0o666))
+
+	assert.False(t, VirtualMachineRunning(pidFile, "nesting-abc"))
+
+	// were the test's own process signalled, it wouldn't get any further
+	require.NoError(t, VirtualMachineDelete(context.Background(), pidFile, "nesting-abc", time.Second))
+}
+
+func TestVersion(t *testing.T) {
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	m := &mockRun{
+		commands:     []string{"qemu-system-x86_64", "--version"},
+		returnString: "QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)\nCopyright (c) 2003-2023 Fabrice Bellard and the QEMU Project developers\n",
+	}
+	run = m.fn()
+
+	version, err := Version(context.TODO(), "qemu-system-x86_64")
+	require.NoError(t, err)
+	assert.Equal(t, "8.2.2", version)
+	m.verify(t)
+
+	run = (&mockRun{returnString: "garbage"}).fn()
+	_, err = Version(context.TODO(), "qemu-system-x86_64")
+	assert.Error(t, err)
+}
+
+func TestFormatMAC(t *testing.T) {
+	assert.Equal(t, "02:aa:bb:cc:dd:ee", FormatMAC("02AABBCCDDEE"))
+	assert.Equal(t, "02:aa:bb:cc:dd:ee", FormatMAC("02:AA:BB:CC:DD:EE"))
+}
+
+type mockRun struct {
+	commands     []string
+	got          []string
+	returnString string
+	returnErr    error
+}
+
+func (m *mockRun) fn() func(context.Context, ...string) (string, error) {
+	return func(_ context.Context, commands ...string) (string, error) {
+		m.got = commands
+		return m.returnString, m.returnErr
+	}
+}
+
+func (m *mockRun) verify(t *testing.T) {
+	assert.Equal(t, strings.Join(m.commands, " "), strings.Join(m.got, " "))
+}
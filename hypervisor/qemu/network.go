@@ -0,0 +1,82 @@
+package qemu
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var portMu sync.Mutex
+
+// freePort finds a random free local port for qemu's user-mode networking to
+// forward to the guest. The caller must hold portMu until qemu has started
+// listening on the port.
+//
+// The listener is closed immediately, so there's a very slim chance that
+// another process could "steal" this port before qemu begins listening on it,
+// but it won't be this process, because of the portMu lock. If that does
+// happen, qemu fails to start and the error is returned from Create.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("finding free local port: %w", err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// getAddress returns the IP address of a VM via its MAC from a dnsmasq style
+// lease file.
+//
+// This call blocks until the lease exists and returns the address or the
+// timeout is exceeded.
+func getAddress(ctx context.Context, leaseFile, mac string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		addr, err := lookupLease(leaseFile, mac)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if addr != "" {
+			return addr, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("fetching address: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// lookupLease parses leases in the format "<expiry> <mac> <ip> <hostname> <client id>".
+func lookupLease(leaseFile, mac string) (string, error) {
+	f, err := os.Open(leaseFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		if strings.EqualFold(fields[1], mac) {
+			return fields[2], nil
+		}
+	}
+
+	return "", scanner.Err()
+}
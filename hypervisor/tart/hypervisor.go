@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/integrity"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/tart/internal/control"
 )
 
@@ -23,9 +27,12 @@ type Tart struct {
 	mu  sync.Mutex
 	vms map[string]func()
 	cfg Config
+
+	verifier *integrity.Verifier
 }
 
 type Config struct {
+	integrity.Config
 }
 
 func New(config []byte) (*Tart, error) {
@@ -39,6 +46,12 @@ func New(config []byte) (*Tart, error) {
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	hv.verifier = verifier
+
 	return hv, nil
 }
 
@@ -49,6 +62,12 @@ func (hv *Tart) Init(ctx context.Context, config []byte) error {
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return err
+	}
+	hv.verifier = verifier
+
 	ctx, cancel := context.WithTimeout(ctx, hvInitTimeout)
 	defer cancel()
 
@@ -59,7 +78,43 @@ func (hv *Tart) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (hv *Tart) Create(ctx context.Context, name string) (vm hypervisor.VirtualMachine, err error) {
+// Capabilities reports Tart's version and features. List doesn't know the
+// image a VM was cloned from, so it leaves names empty.
+func (hv *Tart) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	version, err := control.Version(ctx)
+	if err != nil {
+		return hypervisor.Capabilities{}, err
+	}
+
+	return hypervisor.Capabilities{
+		Version: version,
+		Features: []hypervisor.Feature{
+			hypervisor.FeaturePersistentVMs,
+			hypervisor.FeatureResourceOverrides,
+			hypervisor.FeatureExec,
+			hypervisor.FeatureImages,
+			hypervisor.FeatureGracefulDelete,
+		},
+		AddressFormat: hypervisor.AddressIP,
+	}, nil
+}
+
+func (hv *Tart) Create(ctx context.Context, name string, createOpts hypervisor.CreateOptions) (vm hypervisor.VirtualMachine, err error) {
+	memorySize, err := hvutil.WholeUnits("memory", createOpts.MemoryBytes, hvutil.MiB)
+	if err != nil {
+		return nil, err
+	}
+	diskSize, err := hvutil.WholeUnits("disk size", createOpts.DiskSizeBytes, hvutil.GiB)
+	if err != nil {
+		return nil, err
+	}
+
+	if path, ok := imagePath(name); ok {
+		if err := hv.verifier.Verify(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+
 	id, err := hvutil.UniqueID()
 	if err != nil {
 		return nil, fmt.Errorf("generating unique id: %w", err)
@@ -69,10 +124,16 @@ func (hv *Tart) Create(ctx context.Context, name string) (vm hypervisor.VirtualM
 		Id:      vmNamePrefix + id,
 		Name:    name,
 		Timeout: vmAddressTimeout,
+
+		CPUs:       int(createOpts.CPUs),
+		MemorySize: memorySize,
+		DiskSize:   diskSize,
 	}
 
 	var shutdown func()
 
+	log := hvutil.Logger("tart").With("id", opts.Id, "name", name)
+
 	defer func() {
 		if err == nil {
 			return
@@ -81,7 +142,9 @@ func (hv *Tart) Create(ctx context.Context, name string) (vm hypervisor.VirtualM
 		if shutdown != nil {
 			shutdown()
 		}
-		control.VirtualMachineDelete(context.Background(), opts.Id)
+		if err := control.VirtualMachineDelete(context.Background(), opts.Id); err != nil {
+			log.Warn("cleaning up failed vm", "error", err)
+		}
 	}()
 
 	shutdown, err = control.VirtualMachineCreate(ctx, opts)
@@ -98,14 +161,38 @@ func (hv *Tart) Create(ctx context.Context, name string) (vm hypervisor.VirtualM
 		return nil, err
 	}
 
+	log.Info("vm started", "addr", ipAddr)
+
 	return hypervisor.VirtualMachineInfo{
-		Id:   opts.Id,
-		Name: name,
-		Addr: ipAddr,
+		Id:        opts.Id,
+		Name:      name,
+		Addr:      ipAddr,
+		Endpoints: hypervisor.SSHEndpoints(ipAddr),
 	}, nil
 }
 
 func (hv *Tart) Delete(ctx context.Context, id string) error {
+	_, err := hv.delete(ctx, id, 0)
+	return err
+}
+
+// DeleteGracefully stops the vm with tart stop, which forcibly stops it if
+// the guest hasn't shut down within the grace period. The guest is taken to
+// have shut down if tart stop returns before then.
+func (hv *Tart) DeleteGracefully(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	return hv.delete(ctx, id, grace)
+}
+
+func (hv *Tart) delete(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	method := hypervisor.StopForced
+	if grace > 0 {
+		start := time.Now()
+		if err := control.VirtualMachineStop(ctx, id, grace); err == nil && time.Since(start) < grace {
+			method = hypervisor.StopGraceful
+		}
+	}
+
+	// cancelling tart run stops the vm, if it's still running
 	hv.mu.Lock()
 	if shutdown, ok := hv.vms[id]; ok {
 		shutdown()
@@ -115,21 +202,144 @@ func (hv *Tart) Delete(ctx context.Context, id string) error {
 
 	items, err := control.VirtualMachineList(ctx, id)
 	if err != nil {
-		return fmt.Errorf("fetching vm (%v) details: %w", id, err)
+		return "", fmt.Errorf("fetching vm (%v) details: %w", id, err)
 	}
 
 	if len(items) == 0 {
-		return fmt.Errorf("no vm (%v) found", id)
+		return "", fmt.Errorf("no vm (%v) found", id)
 	}
 
 	vm := items[0]
 	if err := control.VirtualMachineDelete(ctx, vm); err != nil {
-		return fmt.Errorf("stopping vm (%v): %w", id, err)
+		return "", fmt.Errorf("stopping vm (%v): %w", id, err)
+	}
+
+	hvutil.Logger("tart").Info("vm deleted", "id", id, "stop_method", method)
+
+	return method, nil
+}
+
+func (hv *Tart) Exec(ctx context.Context, id string, cmd hypervisor.ExecCommand) (int, error) {
+	items, err := control.VirtualMachineList(ctx, id)
+	if err != nil {
+		return 0, fmt.Errorf("fetching vm (%v) details: %w", id, err)
+	}
+
+	if len(items) == 0 {
+		return 0, fmt.Errorf("no vm (%v) found", id)
 	}
 
+	return control.VirtualMachineExec(ctx, items[0], cmd)
+}
+
+// ListImages returns tart's local and OCI images.
+func (hv *Tart) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	images, err := control.ImageList(ctx, vmNamePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("fetching images: %w", err)
+	}
+
+	return images, nil
+}
+
+// ImportImage imports a .tvm archive, as created by tart export.
+func (hv *Tart) ImportImage(ctx context.Context, name, source string) error {
+	if err := hv.validImageName(name); err != nil {
+		return err
+	}
+
+	exists, err := hv.imageExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageExists, name)
+	}
+
+	if err := control.ImageImport(ctx, source, name); err != nil {
+		return err
+	}
+	hv.forget(name)
+
+	hvutil.Logger("tart").Info("image imported", "name", name, "source", source)
+
+	return nil
+}
+
+func (hv *Tart) DeleteImage(ctx context.Context, name string) error {
+	if err := hv.validImageName(name); err != nil {
+		return err
+	}
+
+	exists, err := hv.imageExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", hypervisor.ErrImageNotFound, name)
+	}
+
+	if err := control.ImageDelete(ctx, name); err != nil {
+		return err
+	}
+	hv.forget(name)
+
+	hvutil.Logger("tart").Info("image deleted", "name", name)
+
 	return nil
 }
 
+// validImageName rejects names that would refer to the vms nesting creates.
+func (hv *Tart) validImageName(name string) error {
+	if name == "" || strings.HasPrefix(name, vmNamePrefix) {
+		return fmt.Errorf("%w: %q", hypervisor.ErrInvalidImageName, name)
+	}
+
+	return nil
+}
+
+// imagePath returns the directory tart keeps a local image in, which is where
+// its manifest is looked for. OCI images, whose names are references, are
+// verified by tart against their digests when pulled, so have no path.
+func imagePath(name string) (string, bool) {
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+
+	home := os.Getenv("TART_HOME")
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		home = filepath.Join(userHome, ".tart")
+	}
+
+	return filepath.Join(home, "vms", name), true
+}
+
+// forget drops the verification cached for the image, as it's changed.
+func (hv *Tart) forget(name string) {
+	if path, ok := imagePath(name); ok {
+		hv.verifier.Forget(path)
+	}
+}
+
+func (hv *Tart) imageExists(ctx context.Context, name string) (bool, error) {
+	images, err := hv.ListImages(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, image := range images {
+		if image.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (hv *Tart) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
 	items, err := control.VirtualMachineList(ctx, vmNamePrefix)
 	if err != nil {
@@ -144,8 +354,9 @@ func (hv *Tart) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
 		}
 
 		vms = append(vms, hypervisor.VirtualMachineInfo{
-			Id:   item,
-			Addr: addr,
+			Id:        item,
+			Addr:      addr,
+			Endpoints: hypervisor.SSHEndpoints(addr),
 		})
 	}
 
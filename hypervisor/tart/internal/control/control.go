@@ -8,12 +8,21 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
 )
 
 type CreateOptions struct {
 	Id      string
 	Name    string
 	Timeout time.Duration
+
+	// overrides of the image's resources, zero keeps the image's value
+	CPUs       int
+	MemorySize int // MiB
+	DiskSize   int // GiB
 }
 
 func VirtualMachineCreate(ctx context.Context, opts CreateOptions) (func(), error) {
@@ -21,6 +30,10 @@ func VirtualMachineCreate(ctx context.Context, opts CreateOptions) (func(), erro
 		return func() {}, fmt.Errorf("cloning image %s (%s): %w", opts.Id, opts.Name, err)
 	}
 
+	if err := VirtualMachineSet(ctx, opts); err != nil {
+		return func() {}, err
+	}
+
 	errCh := make(chan error, 2)
 
 	dctx, cancel := context.WithCancel(context.Background())
@@ -43,6 +56,41 @@ func VirtualMachineCreate(ctx context.Context, opts CreateOptions) (func(), erro
 	return cancel, err
 }
 
+// VirtualMachineSet applies the resource overrides to a cloned, stopped vm.
+func VirtualMachineSet(ctx context.Context, opts CreateOptions) error {
+	args := []string{"set", opts.Id}
+	if opts.CPUs > 0 {
+		args = append(args, "--cpu", strconv.Itoa(opts.CPUs))
+	}
+	if opts.MemorySize > 0 {
+		args = append(args, "--memory", strconv.Itoa(opts.MemorySize))
+	}
+	if opts.DiskSize > 0 {
+		args = append(args, "--disk-size", strconv.Itoa(opts.DiskSize))
+	}
+
+	if len(args) == 2 {
+		return nil
+	}
+
+	if _, err := run(ctx, args...); err != nil {
+		return fmt.Errorf("updating image settings %s: %w", opts.Id, err)
+	}
+
+	return nil
+}
+
+// VirtualMachineStop asks the vm's guest to shut down, and tart forcibly stops
+// it if it hasn't within the timeout, rounded up to whole seconds.
+func VirtualMachineStop(ctx context.Context, name string, timeout time.Duration) error {
+	seconds := (timeout + time.Second - 1) / time.Second
+	if _, err := run(ctx, "stop", name, "--timeout", strconv.Itoa(int(seconds))); err != nil {
+		return fmt.Errorf("stopping vm: %w", err)
+	}
+
+	return nil
+}
+
 func VirtualMachineDelete(ctx context.Context, name string) error {
 	if _, err := run(ctx, "delete", name); err != nil {
 		return fmt.Errorf("deleting image: %w", err)
@@ -51,6 +99,12 @@ func VirtualMachineDelete(ctx context.Context, name string) error {
 	return nil
 }
 
+// VirtualMachineExec runs a command inside the vm with tart exec, which
+// requires the Tart guest agent to be running in the guest.
+func VirtualMachineExec(ctx context.Context, name string, cmd hypervisor.ExecCommand) (int, error) {
+	return hvutil.Exec(ctx, append([]string{"tart", "exec", "-i", name}, cmd.Args...), cmd)
+}
+
 func VirtualMachineAddress(ctx context.Context, name string, timeout time.Duration) (string, error) {
 	ip, err := run(ctx, "ip", name, "--wait", strconv.Itoa(int(timeout.Seconds())))
 	if err != nil {
@@ -106,6 +160,83 @@ func VirtualMachineList(ctx context.Context, prefix string) ([]string, error) {
 	return names, nil
 }
 
+// Version returns the version of Tart.
+func Version(ctx context.Context) (string, error) {
+	out, err := run(ctx, "--version")
+	if err != nil {
+		return "", fmt.Errorf("fetching version: %w", err)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// ImageList returns the local and OCI images, excluding vms with the prefix.
+// Sizes are only known if tart reports them, in whole GB.
+func ImageList(ctx context.Context, vmPrefix string) ([]hypervisor.Image, error) {
+	rawList, err := run(ctx, "list")
+	if err != nil {
+		return nil, err
+	}
+
+	nameIdx, sizeIdx := -1, -1
+	var fields int
+	var images []hypervisor.Image
+	for _, line := range strings.Split(rawList, "\n") {
+		record := strings.Fields(line)
+
+		// parse header
+		if fields == 0 {
+			fields = len(record)
+			for idx, header := range record {
+				switch strings.ToLower(header) {
+				case "name":
+					nameIdx = idx
+				case "size":
+					sizeIdx = idx
+				}
+			}
+			continue
+		}
+
+		// parse record
+		if fields != len(record) || nameIdx < 0 {
+			continue
+		}
+
+		if strings.HasPrefix(record[nameIdx], vmPrefix) {
+			continue
+		}
+
+		image := hypervisor.Image{Name: record[nameIdx]}
+		if sizeIdx >= 0 {
+			if size, err := strconv.ParseUint(record[sizeIdx], 10, 64); err == nil {
+				image.SizeBytes = size * 1000 * 1000 * 1000
+			}
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// ImageImport imports an image exported with tart export.
+func ImageImport(ctx context.Context, path, name string) error {
+	if _, err := run(ctx, "import", path, name); err != nil {
+		return fmt.Errorf("importing image %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func ImageDelete(ctx context.Context, name string) error {
+	if _, err := run(ctx, "delete", name); err != nil {
+		return fmt.Errorf("deleting image %s: %w", name, err)
+	}
+
+	return nil
+}
+
 // testing hook
 var run func(ctx context.Context, commands ...string) (string, error)
 
@@ -117,7 +248,11 @@ func init() {
 		cmd := exec.CommandContext(ctx, "tart", commands...)
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
+		start := time.Now()
 		err := cmd.Run()
+		hvutil.LogCommand(ctx, append([]string{"tart"}, commands...), start, err, stderr.String())
+
+		metrics.ObserveCommand("tart", commands[0], err)
 
 		var errExit *exec.ExitError
 		if errors.As(err, &errExit) {
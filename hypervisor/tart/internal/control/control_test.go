@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 )
 
 func TestVirtualMachineList(t *testing.T) {
@@ -157,6 +160,174 @@ func TestVirtualMachineList(t *testing.T) {
 	}
 }
 
+func TestVirtualMachineSet(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   CreateOptions
+		expect *mockRun
+		err    bool
+	}{
+		{
+			name:   "no overrides",
+			opts:   CreateOptions{Id: "nesting-abc"},
+			expect: &mockRun{},
+		},
+		{
+			name: "all overrides",
+			opts: CreateOptions{Id: "nesting-abc", CPUs: 4, MemorySize: 8192, DiskSize: 100},
+			expect: &mockRun{
+				commands: []string{"set", "nesting-abc", "--cpu", "4", "--memory", "8192", "--disk-size", "100"},
+			},
+		},
+		{
+			name: "check err",
+			opts: CreateOptions{Id: "nesting-abc", CPUs: 4},
+			expect: &mockRun{
+				commands:  []string{"set", "nesting-abc", "--cpu", "4"},
+				returnErr: fmt.Errorf("no can do"),
+			},
+			err: true,
+		},
+	}
+
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run = tc.expect.fn()
+			err := VirtualMachineSet(context.TODO(), tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			tc.expect.verify(t)
+		})
+	}
+}
+
+func TestVirtualMachineStop(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		expect  *mockRun
+		err     bool
+	}{
+		{
+			name:    "whole seconds",
+			timeout: 30 * time.Second,
+			expect: &mockRun{
+				commands: []string{"stop", "nesting-abc", "--timeout", "30"},
+			},
+		},
+		{
+			name:    "rounded up",
+			timeout: 1500 * time.Millisecond,
+			expect: &mockRun{
+				commands: []string{"stop", "nesting-abc", "--timeout", "2"},
+			},
+		},
+		{
+			name:    "check err",
+			timeout: time.Second,
+			expect: &mockRun{
+				commands:  []string{"stop", "nesting-abc", "--timeout", "1"},
+				returnErr: fmt.Errorf("no can do"),
+			},
+			err: true,
+		},
+	}
+
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run = tc.expect.fn()
+			err := VirtualMachineStop(context.TODO(), "nesting-abc", tc.timeout)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			tc.expect.verify(t)
+		})
+	}
+}
+
+func TestImageList(t *testing.T) {
+	cases := []struct {
+		name   string
+		expect *mockRun
+		images []hypervisor.Image
+		err    bool
+	}{
+		{
+			name: "without sizes",
+			expect: &mockRun{
+				commands: []string{"list"},
+				returnString: []string{
+					"source\tname",
+					"local\tmacos-14",
+					"local\tnesting-abc",
+					"oci\tghcr.io/cirruslabs/macos-sonoma-base:latest",
+				},
+			},
+			images: []hypervisor.Image{
+				{Name: "macos-14"},
+				{Name: "ghcr.io/cirruslabs/macos-sonoma-base:latest"},
+			},
+		},
+		{
+			name: "with sizes",
+			expect: &mockRun{
+				commands: []string{"list"},
+				returnString: []string{
+					"Source\tName\tDisk\tSize\tState",
+					"local\tmacos-14\t50\t21\tstopped",
+					"local\tnesting-abc\t50\t21\trunning",
+					"local\tgarbage",
+				},
+			},
+			images: []hypervisor.Image{
+				{Name: "macos-14", SizeBytes: 21_000_000_000},
+			},
+		},
+		{
+			name: "check err",
+			expect: &mockRun{
+				commands:  []string{"list"},
+				returnErr: fmt.Errorf("no can do"),
+			},
+			err: true,
+		},
+	}
+
+	runFunc := run
+	defer func() {
+		run = runFunc
+	}()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			run = tc.expect.fn()
+			got, err := ImageList(context.TODO(), "nesting-")
+			assert.Equal(t, tc.images, got)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			tc.expect.verify(t)
+		})
+	}
+}
+
 type mockRun struct {
 	commands     []string
 	got          []string
@@ -3,28 +3,32 @@
 package virtualizationframework
 
 import (
-	"archive/tar"
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/klauspost/compress/zstd"
-	"golang.org/x/sys/unix"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/materialize"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/metrics"
 )
 
-func (hv *VirtualizationFramework) cloneVM(ctx context.Context, id, name string) (cfg *VirtualMachineConfig, err error) {
+// baseDirectory is where an image's archive is extracted to, within the
+// image's directory, for VMs to be cloned from.
+const baseDirectory = ".base"
+
+func (hv *VirtualizationFramework) cloneVM(ctx context.Context, id, name, imageDir string) (cfg *VirtualMachineConfig, err error) {
 	defer func() {
 		if err != nil {
 			os.RemoveAll(filepath.Join(hv.cfg.WorkingDirectory, id))
 		}
 	}()
 
-	imageDir := filepath.Join(hv.cfg.ImageDirectory, name)
 	workingDir := filepath.Join(hv.cfg.WorkingDirectory, id)
 
 	rawVmCfg, err := os.ReadFile(filepath.Join(imageDir, "config.json"))
@@ -41,120 +45,95 @@ func (hv *VirtualizationFramework) cloneVM(ctx context.Context, id, name string)
 		return nil, fmt.Errorf("creating image directory: %w", err)
 	}
 
-	f, err := os.Open(filepath.Join(imageDir, "archive.tar.zst"))
+	start := time.Now()
+	source := "archive"
+	defer func() {
+		metrics.CloneDuration.WithLabelValues(source, metrics.Result(err)).Observe(metrics.Since(start))
+		hvutil.Logger("vz").Debug("vm cloned", "id", id, "name", name, "source", source, "duration", time.Since(start), "error", err)
+	}()
+
+	archive := filepath.Join(imageDir, "archive.tar.zst")
+	fi, err := os.Stat(archive)
 	if errors.Is(err, os.ErrNotExist) {
-		return cfg, extractFromDisk(imageDir, workingDir)
+		source = "disk"
+		return cfg, copyFromDisk(ctx, imageDir, workingDir)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("opening compressed archive: %w", err)
 	}
-	defer f.Close()
-
-	return cfg, extractFromArchive(f, workingDir)
-}
-
-func extractFromDisk(imageDir, workingDir string) error {
-	var buf []byte
-	for _, pathname := range []string{"disk.img", "nvram.bin"} {
-		srcpath := filepath.Join(imageDir, pathname)
-		dstpath := filepath.Join(workingDir, pathname)
-
-		// use the more efficient clonefile is possible: this will error if cross-device.
-		if err := unix.Clonefile(srcpath, dstpath, unix.CLONE_NOFOLLOW); err == nil {
-			continue
-		}
-
-		if len(buf) == 0 { // lazily initialize buf size when needed
-			buf = make([]byte, len(sparseBlock))
-		}
-
-		src, err := os.Open(srcpath)
-		if err != nil {
-			return fmt.Errorf("reading %s: %w", srcpath, err)
-		}
-		defer src.Close()
 
-		dst, err := os.Create(dstpath)
+	// the archive is extracted once, into a base the VM is cloned from, that's
+	// rebuilt if the archive or config are replaced
+	built, err := hv.bases.Use(ctx, filepath.Join(imageDir, baseDirectory), baseKey(fi, rawVmCfg), func(dir string) error {
+		f, err := os.Open(archive)
 		if err != nil {
-			return fmt.Errorf("creating %s: %w", dstpath, err)
-		}
-		defer dst.Close()
-
-		if err := sparseCopyBuffer(dst, src, buf); err != nil {
-			return fmt.Errorf("copying %s -> %s: %w", srcpath, dstpath, err)
-		}
-
-		src.Close()
-		if err := dst.Close(); err != nil {
-			return fmt.Errorf("flushing %s: %w", dstpath, err)
+			return fmt.Errorf("opening compressed archive: %w", err)
 		}
+		defer f.Close()
+
+		return materialize.Extract(ctx, f, dir, hv.extractOptions(cfg))
+	}, func(dir string) error {
+		strategy, err := materialize.CloneBase(ctx, workingDir, dir, materialize.Strategies())
+		hvutil.Logger("vz").Debug("vm files cloned", "id", id, "strategy", strategy)
+		return err
+	})
+	if !built {
+		source = "base"
 	}
 
-	return nil
+	return cfg, err
 }
 
-func extractFromArchive(r io.Reader, workingDir string) error {
-	zr, err := zstd.NewReader(r)
-	if err != nil {
-		return fmt.Errorf("creating zstd reader: %w", err)
+// baseKey identifies the archive and config an image's base is built from.
+func baseKey(archive os.FileInfo, config []byte) string {
+	return fmt.Sprintf("%d-%d-%x", archive.Size(), archive.ModTime().UnixNano(), sha256.Sum256(config))
+}
+
+// extractOptions allow an image's archive to contain its disk, nvram and
+// config.json, as uploaded archives do, and the files its config declares.
+func (hv *VirtualizationFramework) extractOptions(cfg *VirtualMachineConfig) materialize.ExtractOptions {
+	maxSize := hv.cfg.MaxArchiveSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxArchiveSize
 	}
-	defer zr.Close()
-
-	tr := tar.NewReader(zr)
-	buf := make([]byte, len(sparseBlock))
-	for {
-		hdr, err := tr.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("reading tar entry: %w", err)
-		}
 
-		dstpath := filepath.Join(workingDir, hdr.Name)
+	return materialize.ExtractOptions{
+		Files:   append([]string{"disk.img", "nvram.bin", "config.json"}, cfg.Files...),
+		MaxSize: maxSize,
+		Digests: cfg.Digests,
+	}
+}
 
-		dst, err := os.Create(dstpath)
+// copyFromDisk copies a disk and nvram, an image's or a snapshot's, with the
+// most efficient strategy their filesystem supports.
+func copyFromDisk(ctx context.Context, srcDir, dstDir string) error {
+	for _, pathname := range []string{"disk.img", "nvram.bin"} {
+		strategy, err := materialize.CopyFile(ctx, filepath.Join(dstDir, pathname), filepath.Join(srcDir, pathname), materialize.Strategies())
 		if err != nil {
-			return fmt.Errorf("creating %s: %w", dstpath, err)
+			return err
 		}
-		defer dst.Close()
 
-		if err := sparseCopyBuffer(dst, tr, buf); err != nil {
-			return fmt.Errorf("copying %s -> %s: %w", hdr.Name, dstpath, err)
-		}
-		if err := dst.Close(); err != nil {
-			return fmt.Errorf("flushing %s: %w", dstpath, err)
-		}
+		hvutil.Logger("vz").Debug("vm file copied", "file", pathname, "strategy", strategy)
 	}
 
 	return nil
 }
 
-var sparseBlock = make([]byte, 64*1024)
-
-func sparseCopyBuffer(dst io.WriterAt, src io.Reader, buf []byte) error {
-	if buf == nil || len(buf) < len(sparseBlock) {
-		panic("sparse copy buffer cannot be smaller than the sparse block size")
+// resizeDisk grows a raw disk image to size bytes. The file is extended
+// sparsely, and the guest is responsible for growing its partitions.
+func resizeDisk(path string, size uint64) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("reading disk size: %w", err)
 	}
 
-	var offset int64
-
-	for {
-		n, err := src.Read(buf)
-		if !bytes.Equal(buf[:n], sparseBlock[:n]) {
-			if _, err := dst.WriteAt(buf[:n], offset); err != nil {
-				return err
-			}
-		}
-
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-
-			return err
-		}
+	if size < uint64(fi.Size()) {
+		return fmt.Errorf("%w: disk size cannot be smaller than the image's (%d bytes)", hypervisor.ErrInvalidOption, fi.Size())
+	}
 
-		offset += int64(n)
+	if err := os.Truncate(path, int64(size)); err != nil {
+		return fmt.Errorf("resizing disk: %w", err)
 	}
+
+	return nil
 }
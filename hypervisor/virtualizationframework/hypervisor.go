@@ -10,35 +10,65 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/integrity"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/materialize"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/oci"
+	"gitlab.com/gitlab-org/fleeting/nesting/internal/agent"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Code-Hex/vz/v3"
 )
 
 type VirtualizationFramework struct {
-	mu  sync.Mutex
-	vms map[string]virtualMachine
-	cfg Config
+	mu     sync.Mutex
+	vms    map[string]virtualMachine
+	cfg    Config
+	notify func(hypervisor.Event)
+
+	verifier *integrity.Verifier
+	bases    materialize.BaseCache
 }
 
 type virtualMachine struct {
-	id   string
-	addr string
-	name string
+	id        string
+	addr      string
+	name      string
+	endpoints []hypervisor.Endpoint
+
+	// machine is what the vm was created with, saved with its snapshots
+	machine machineConfig
 
 	vm       *vz.VirtualMachine
 	shutdown func() error
+
+	// stopped is closed once the vm has stopped
+	stopped <-chan struct{}
 }
 
 type Config struct {
 	ImageDirectory   string `json:"image_directory"`
 	WorkingDirectory string `json:"working_directory"`
+
+	// Registries configures access to the registries images are pulled from,
+	// by host, such as ghcr.io
+	Registries map[string]oci.Registry `json:"registries"`
+
+	// MaxArchiveSize is the most bytes an image archive's files can hold
+	// uncompressed, defaulting to defaultMaxArchiveSize
+	MaxArchiveSize int64 `json:"max_archive_size"`
+
+	integrity.Config
 }
 
+// defaultMaxArchiveSize is the default limit of an image archive's files,
+// uncompressed.
+const defaultMaxArchiveSize = 1 << 40
+
 var errVirtualMachineStopped = errors.New("virtual machine stopped")
 
 // VirtualMachineConfig is an indivual VM's configuration, this is modelled after
@@ -53,6 +83,15 @@ type VirtualMachineConfig struct {
 
 	// new fields
 	MTU int `json:"mtu"`
+
+	// Ports are the guest ports, besides SSH's, forwarded from local ports
+	Ports []hypervisor.PortForward `json:"ports"`
+
+	// Files are the files, besides disk.img and nvram.bin, that the image's
+	// archive can contain, and Digests are the sha256 digests its files are
+	// verified against when extracted, by name
+	Files   []string          `json:"files"`
+	Digests map[string]string `json:"digests"`
 }
 
 func New(config []byte) (*VirtualizationFramework, error) {
@@ -66,6 +105,12 @@ func New(config []byte) (*VirtualizationFramework, error) {
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	hv.verifier = verifier
+
 	if hv.cfg.ImageDirectory == "" || hv.cfg.WorkingDirectory == "" {
 		home, err := os.UserHomeDir()
 		if err != nil {
@@ -92,6 +137,12 @@ func (hv *VirtualizationFramework) Init(ctx context.Context, config []byte) erro
 		}
 	}
 
+	verifier, err := integrity.New(hv.cfg.Config)
+	if err != nil {
+		return err
+	}
+	hv.verifier = verifier
+
 	return nil
 }
 
@@ -99,17 +150,119 @@ func (hv *VirtualizationFramework) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm hypervisor.VirtualMachine, err error) {
+// Capabilities reports the Virtualization framework's features. Its version
+// is the version of macOS, and VMs are stopped when the process exits.
+// Addresses are the local port forwarded to the guest's SSH port, and other
+// guest ports are forwarded from local ports too. Snapshots require macOS 14.
+func (hv *VirtualizationFramework) Capabilities(ctx context.Context) (hypervisor.Capabilities, error) {
+	version, err := syscall.Sysctl("kern.osproductversion")
+	if err != nil {
+		return hypervisor.Capabilities{}, fmt.Errorf("fetching macos version: %w", err)
+	}
+
+	features := []hypervisor.Feature{
+		hypervisor.FeatureListNames,
+		hypervisor.FeatureResourceOverrides,
+		hypervisor.FeaturePortForwards,
+		hypervisor.FeatureEvents,
+		hypervisor.FeatureExec,
+		hypervisor.FeatureImages,
+		hypervisor.FeatureImageUpload,
+		hypervisor.FeatureGracefulDelete,
+	}
+	if supportsSnapshots(version) {
+		features = append(features, hypervisor.FeatureSnapshots)
+	}
+
+	return hypervisor.Capabilities{
+		Version:       version,
+		Features:      features,
+		AddressFormat: hypervisor.AddressHostPort,
+	}, nil
+}
+
+func (hv *VirtualizationFramework) Notify(fn func(hypervisor.Event)) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	hv.notify = fn
+}
+
+func (hv *VirtualizationFramework) emit(ev hypervisor.Event) {
+	hv.mu.Lock()
+	notify := hv.notify
+	hv.mu.Unlock()
+
+	if notify != nil {
+		notify(ev)
+	}
+}
+
+func (hv *VirtualizationFramework) Create(ctx context.Context, name string, opts hypervisor.CreateOptions) (vm hypervisor.VirtualMachine, err error) {
+	imageDir, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCreateOptions(opts); err != nil {
+		return nil, err
+	}
+
+	if err := hv.verifier.Verify(ctx, imageDir); err != nil {
+		return nil, err
+	}
+
 	id, err := hvutil.UniqueID()
 	if err != nil {
 		return nil, fmt.Errorf("generating unique id: %w", err)
 	}
 
-	cfg, err := hv.cloneVM(ctx, id, name)
+	if opts.Snapshot != "" {
+		return hv.restore(ctx, id, name, opts)
+	}
+
+	cfg, err := hv.cloneVM(ctx, id, name, imageDir)
 	if err != nil {
 		return nil, fmt.Errorf("cloning vm: %w", err)
 	}
 
+	if opts.CPUs > 0 {
+		cfg.CPUCount = uint(opts.CPUs)
+	}
+	if opts.MemoryBytes > 0 {
+		cfg.MemorySize = opts.MemoryBytes
+	}
+	cfg.Ports = append(cfg.Ports, opts.Ports...)
+	if opts.DiskSizeBytes > 0 {
+		if err := resizeDisk(filepath.Join(hv.cfg.WorkingDirectory, id, "disk.img"), opts.DiskSizeBytes); err != nil {
+			os.RemoveAll(filepath.Join(hv.cfg.WorkingDirectory, id))
+			return nil, err
+		}
+	}
+
+	mac, err := vz.NewRandomLocallyAdministeredMACAddress()
+	if err != nil {
+		return nil, fmt.Errorf("creating mac address: %w", err)
+	}
+
+	machine := machineConfig{Image: name, Config: cfg, MAC: mac.String()}
+	if cfg.OS != "darwin" {
+		machineIdentifier, err := vz.NewGenericMachineIdentifier()
+		if err != nil {
+			return nil, fmt.Errorf("creating machine identifier: %w", err)
+		}
+		machine.MachineIdentifier = machineIdentifier.DataRepresentation()
+	}
+
+	return hv.start(id, machine, "")
+}
+
+// start creates and starts the vm from its files in the working directory.
+// If state is set, the vm is restored from the saved state instead of booted.
+func (hv *VirtualizationFramework) start(id string, machine machineConfig, state string) (hypervisor.VirtualMachine, error) {
+	name, cfg := machine.Image, machine.Config
+
+	var err error
 	var bootloader vz.BootLoader
 	var platformCfg vz.PlatformConfiguration
 	if cfg.OS == "darwin" {
@@ -128,7 +281,13 @@ func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm
 			return nil, fmt.Errorf("creating machine identifier: %w", err)
 		}
 
-		auxStorage, err := vz.NewMacAuxiliaryStorage(filepath.Join(hv.cfg.WorkingDirectory, id, "nvram.bin"), vz.WithCreatingMacAuxiliaryStorage(hardwareModel))
+		// a restored vm's auxiliary storage is part of its saved state
+		var auxOpts []vz.NewMacAuxiliaryStorageOption
+		if state == "" {
+			auxOpts = append(auxOpts, vz.WithCreatingMacAuxiliaryStorage(hardwareModel))
+		}
+
+		auxStorage, err := vz.NewMacAuxiliaryStorage(filepath.Join(hv.cfg.WorkingDirectory, id, "nvram.bin"), auxOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("creating auxiliary storage: %w", err)
 		}
@@ -152,7 +311,7 @@ func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm
 			return nil, fmt.Errorf("creating efi bootloader: %w", err)
 		}
 
-		machineIdentifier, err := vz.NewGenericMachineIdentifier()
+		machineIdentifier, err := vz.NewGenericMachineIdentifierWithData(machine.MachineIdentifier)
 		if err != nil {
 			return nil, fmt.Errorf("creating machine identifier: %w", err)
 		}
@@ -198,7 +357,12 @@ func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm
 
 	vzVMCfg.SetSocketDevicesVirtualMachineConfiguration([]vz.SocketDeviceConfiguration{socketDeviceCfg})
 
-	networkDeviceConfig, cleanup, addr, err := createNetworkDeviceConfiguration(cfg)
+	mac, err := parseMACAddress(machine.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	networkDeviceConfig, cleanup, endpoints, err := createNetworkDeviceConfiguration(cfg, mac)
 	if err != nil {
 		return nil, fmt.Errorf("creating network device config: %w", err)
 	}
@@ -206,30 +370,53 @@ func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm
 		networkDeviceConfig,
 	})
 
+	addr := endpoints[0].String()
+
 	vzvm, err := vz.NewVirtualMachine(vzVMCfg)
 	if err != nil {
+		cleanup()
 		return nil, fmt.Errorf("creating vm: %w", err)
 	}
 
-	if err := vzvm.Start(); err != nil {
-		return nil, fmt.Errorf("starting vm: %w", err)
+	if state != "" {
+		err = restoreState(vzvm, state)
+	} else if err = vzvm.Start(); err != nil {
+		err = fmt.Errorf("starting vm: %w", err)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
 	}
 
+	log := hvutil.Logger("vz").With("id", id, "name", name)
+
 	wg, ctx := errgroup.WithContext(context.Background())
 
 	running := make(chan struct{})
+	stopped := make(chan struct{})
 	wg.Go(func() error {
+		defer close(stopped)
 		defer cleanup()
 
 		for state := range vzvm.StateChangedNotify() {
+			log.Debug("vm state changed", "state", state)
+
 			switch state {
 			case vz.VirtualMachineStateRunning:
-				close(running)
+				// a vm runs again when resumed, after failing to save its state
+				select {
+				case <-running:
+				default:
+					close(running)
+				}
 
 			case vz.VirtualMachineStateError:
+				log.Error("vm errored")
+				hv.emit(hypervisor.Event{Type: hypervisor.EventErrored, Id: id, Name: name, Time: time.Now(), Reason: "internal VM error"})
 				return fmt.Errorf("internal VM error")
 
 			case vz.VirtualMachineStateStopped:
+				hv.emit(hypervisor.Event{Type: hypervisor.EventStopped, Id: id, Name: name, Time: time.Now()})
 				return errVirtualMachineStopped
 			}
 		}
@@ -246,39 +433,92 @@ func (hv *VirtualizationFramework) Create(ctx context.Context, name string) (vm
 
 	hv.mu.Lock()
 	hv.vms[id] = virtualMachine{
-		id:       id,
-		name:     name,
-		addr:     addr,
-		vm:       vzvm,
-		shutdown: wg.Wait,
+		id:        id,
+		name:      name,
+		addr:      addr,
+		endpoints: endpoints,
+		machine:   machine,
+		vm:        vzvm,
+		shutdown:  wg.Wait,
+		stopped:   stopped,
 	}
 	hv.mu.Unlock()
 
+	log.Info("vm started", "addr", addr, "cpus", cfg.CPUCount, "memory_bytes", cfg.MemorySize)
+
 	return hypervisor.VirtualMachineInfo{
-		Id:   id,
-		Name: name,
-		Addr: addr,
+		Id:        id,
+		Name:      name,
+		Addr:      addr,
+		Endpoints: endpoints,
 	}, nil
 }
 
+// validateCreateOptions checks the overrides against the limits of the
+// Virtualization framework, before any work is done.
+func validateCreateOptions(opts hypervisor.CreateOptions) error {
+	if opts.CPUs > 0 {
+		min := vz.VirtualMachineConfigurationMinimumAllowedCPUCount()
+		max := vz.VirtualMachineConfigurationMaximumAllowedCPUCount()
+		if uint(opts.CPUs) < min || uint(opts.CPUs) > max {
+			return fmt.Errorf("%w: cpus must be between %d and %d", hypervisor.ErrInvalidOption, min, max)
+		}
+	}
+
+	if opts.MemoryBytes > 0 {
+		min := vz.VirtualMachineConfigurationMinimumAllowedMemorySize()
+		max := vz.VirtualMachineConfigurationMaximumAllowedMemorySize()
+		if opts.MemoryBytes < min || opts.MemoryBytes > max {
+			return fmt.Errorf("%w: memory must be between %d and %d bytes", hypervisor.ErrInvalidOption, min, max)
+		}
+		if _, err := hvutil.WholeUnits("memory", opts.MemoryBytes, hvutil.MiB); err != nil {
+			return err
+		}
+	}
+
+	for _, port := range opts.Ports {
+		if err := validatePortForward(port); err != nil {
+			return fmt.Errorf("%w: %w", hypervisor.ErrInvalidOption, err)
+		}
+	}
+
+	return nil
+}
+
 func (hv *VirtualizationFramework) Delete(ctx context.Context, id string) error {
+	_, err := hv.delete(ctx, id, 0)
+	return err
+}
+
+// DeleteGracefully requests the guest stops, as if its power button was
+// pressed, and force stops the vm if it hasn't within the grace period.
+func (hv *VirtualizationFramework) DeleteGracefully(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
+	return hv.delete(ctx, id, grace)
+}
+
+func (hv *VirtualizationFramework) delete(ctx context.Context, id string, grace time.Duration) (hypervisor.StopMethod, error) {
 	hv.mu.Lock()
 	vm, ok := hv.vms[id]
 	hv.mu.Unlock()
 
 	if !ok {
-		return fmt.Errorf("no vm (%v) found", id)
+		return "", fmt.Errorf("no vm (%v) found", id)
+	}
+
+	method := hypervisor.StopForced
+	if grace > 0 && requestStop(ctx, vm, grace) {
+		method = hypervisor.StopGraceful
 	}
 
-	for {
+	for method == hypervisor.StopForced {
 		if ctx.Err() != nil {
-			return ctx.Err()
+			return "", ctx.Err()
 		}
 
 		// force stop, if we can
 		if vm.vm.CanStop() {
 			if err := vm.vm.Stop(); err != nil {
-				return fmt.Errorf("stopping vm: %w", err)
+				return "", fmt.Errorf("stopping vm: %w", err)
 			}
 			break
 		}
@@ -287,7 +527,7 @@ func (hv *VirtualizationFramework) Delete(ctx context.Context, id string) error
 		if vm.vm.CanRequestStop() {
 			ok, err := vm.vm.RequestStop()
 			if err != nil {
-				return fmt.Errorf("request stopping vm: %w", err)
+				return "", fmt.Errorf("request stopping vm: %w", err)
 			}
 
 			if ok {
@@ -308,14 +548,63 @@ func (hv *VirtualizationFramework) Delete(ctx context.Context, id string) error
 	vm.shutdown()
 
 	if err := os.RemoveAll(filepath.Join(hv.cfg.WorkingDirectory, id)); err != nil {
-		return fmt.Errorf("deleting vm dir: %w", err)
+		return "", fmt.Errorf("deleting vm dir: %w", err)
 	}
 
 	hv.mu.Lock()
 	delete(hv.vms, id)
 	hv.mu.Unlock()
 
-	return nil
+	hvutil.Logger("vz").Info("vm deleted", "id", id, "stop_method", method)
+
+	return method, nil
+}
+
+// requestStop asks the guest to stop, reporting whether it has within the
+// grace period.
+func requestStop(ctx context.Context, vm virtualMachine, grace time.Duration) bool {
+	if !vm.vm.CanRequestStop() {
+		return false
+	}
+	if ok, err := vm.vm.RequestStop(); err != nil || !ok {
+		return false
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-vm.stopped:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Exec runs a command through the guest agent, which the image must run,
+// listening on agent.Port of the vm's virtio socket device.
+func (hv *VirtualizationFramework) Exec(ctx context.Context, id string, cmd hypervisor.ExecCommand) (int, error) {
+	hv.mu.Lock()
+	vm, ok := hv.vms[id]
+	hv.mu.Unlock()
+
+	if !ok {
+		return 0, fmt.Errorf("no vm (%v) found", id)
+	}
+
+	devices := vm.vm.SocketDevices()
+	if len(devices) == 0 {
+		return 0, fmt.Errorf("vm (%v) has no socket device", id)
+	}
+
+	conn, err := devices[0].Connect(agent.Port)
+	if err != nil {
+		return 0, fmt.Errorf("connecting to guest agent: %w", err)
+	}
+
+	return agent.Exec(ctx, conn, cmd)
 }
 
 func (hv *VirtualizationFramework) List(ctx context.Context) ([]hypervisor.VirtualMachine, error) {
@@ -325,9 +614,10 @@ func (hv *VirtualizationFramework) List(ctx context.Context) ([]hypervisor.Virtu
 	vms := make([]hypervisor.VirtualMachine, 0, len(hv.vms))
 	for _, vm := range hv.vms {
 		vms = append(vms, hypervisor.VirtualMachineInfo{
-			Id:   vm.id,
-			Name: vm.name,
-			Addr: vm.addr,
+			Id:        vm.id,
+			Name:      vm.name,
+			Addr:      vm.addr,
+			Endpoints: vm.endpoints,
 		})
 	}
 
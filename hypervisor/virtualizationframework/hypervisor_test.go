@@ -0,0 +1,27 @@
+//go:build darwin && arm64
+
+package virtualizationframework
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+func TestCreateInvalidImageName(t *testing.T) {
+	config, err := json.Marshal(Config{ImageDirectory: t.TempDir(), WorkingDirectory: t.TempDir()})
+	require.NoError(t, err)
+
+	hv, err := New(config)
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "../image", "images/image", ".snapshots", ".base"} {
+		_, err := hv.Create(context.Background(), name, hypervisor.CreateOptions{})
+		assert.ErrorIs(t, err, hypervisor.ErrInvalidImageName, name)
+	}
+}
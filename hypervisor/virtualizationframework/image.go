@@ -0,0 +1,187 @@
+//go:build darwin && arm64
+
+package virtualizationframework
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/oci"
+)
+
+// maxConfigSize is the largest config.json read from an uploaded archive.
+const maxConfigSize = 1 << 20
+
+// ListImages returns the image directories, those with a config.json, in the
+// image directory.
+func (hv *VirtualizationFramework) ListImages(ctx context.Context) ([]hypervisor.Image, error) {
+	entries, err := hvutil.ListImages(hv.cfg.ImageDirectory, "")
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]hypervisor.Image, 0, len(entries))
+	for _, image := range entries {
+		if _, err := os.Stat(filepath.Join(hv.cfg.ImageDirectory, image.Name, "config.json")); err != nil {
+			continue
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// ImportImage copies an image directory, containing a config.json and either
+// an archive.tar.zst or a disk.img and nvram.bin, into the image directory.
+// A source of oci://<reference> pulls an image stored in Tart's OCI layout
+// instead.
+func (hv *VirtualizationFramework) ImportImage(ctx context.Context, name, source string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, "")
+	if err != nil {
+		return err
+	}
+
+	if ref, ok := strings.CutPrefix(source, "oci://"); ok {
+		return hv.pullImage(ctx, name, path, ref)
+	}
+
+	if _, err := os.Stat(filepath.Join(source, "config.json")); err != nil {
+		return fmt.Errorf("reading import source config: %w", err)
+	}
+
+	if err := hvutil.ImportImage(ctx, source, path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("vz").Info("image imported", "name", name, "source", source)
+
+	return nil
+}
+
+func (hv *VirtualizationFramework) pullImage(ctx context.Context, name, path, reference string) error {
+	ref, err := oci.ParseReference(reference)
+	if err != nil {
+		return err
+	}
+
+	puller := &oci.Puller{Registries: hv.cfg.Registries}
+
+	start := time.Now()
+	err = hvutil.ImportImageFunc(path, func(dst string) error {
+		return puller.Pull(ctx, ref, dst)
+	})
+	if err != nil {
+		return fmt.Errorf("pulling %s: %w", ref, err)
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("vz").Info("image pulled", "name", name, "reference", ref.String(), "duration", time.Since(start))
+
+	return nil
+}
+
+// UploadDirectory is hidden within the image directory, so that a complete
+// upload can be renamed into place.
+func (hv *VirtualizationFramework) UploadDirectory() string {
+	return filepath.Join(hv.cfg.ImageDirectory, ".uploads")
+}
+
+// ImportArchive imports an uploaded archive as the image's archive.tar.zst,
+// alongside the config.json the archive must contain.
+func (hv *VirtualizationFramework) ImportArchive(ctx context.Context, name, path string) error {
+	imagePath, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, "")
+	if err != nil {
+		return err
+	}
+
+	err = hvutil.ImportImageFunc(imagePath, func(dst string) error {
+		if err := os.Mkdir(dst, 0o777); err != nil {
+			return err
+		}
+
+		if err := extractConfig(path, filepath.Join(dst, "config.json")); err != nil {
+			return err
+		}
+
+		return os.Rename(path, filepath.Join(dst, "archive.tar.zst"))
+	})
+	if err != nil {
+		return err
+	}
+	hv.verifier.Forget(imagePath)
+
+	hvutil.Logger("vz").Info("image imported", "name", name, "source", "upload")
+
+	return nil
+}
+
+// extractConfig copies the config.json entry of an archive to dst.
+func extractConfig(archive, dst string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("creating zstd reader: %w", err)
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("archive has no config.json")
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %w", err)
+		}
+
+		if path.Clean(hdr.Name) != "config.json" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		config, err := io.ReadAll(io.LimitReader(tr, maxConfigSize+1))
+		if err != nil {
+			return fmt.Errorf("reading config.json: %w", err)
+		}
+		if len(config) > maxConfigSize || !json.Valid(config) {
+			return fmt.Errorf("archive has an invalid config.json")
+		}
+
+		return os.WriteFile(dst, config, 0o666)
+	}
+}
+
+func (hv *VirtualizationFramework) DeleteImage(ctx context.Context, name string) error {
+	path, err := hvutil.ImagePath(hv.cfg.ImageDirectory, name, "")
+	if err != nil {
+		return err
+	}
+
+	if err := hvutil.DeleteImage(path); err != nil {
+		return err
+	}
+	hv.verifier.Forget(path)
+
+	hvutil.Logger("vz").Info("image deleted", "name", name)
+
+	return nil
+}
@@ -11,38 +11,93 @@ import (
 	"github.com/Code-Hex/vz/v3"
 	"golang.org/x/net/route"
 	"golang.org/x/sys/unix"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
 )
 
 var portMu sync.Mutex
 
-func newLinkDevice(network *vmnet.Network) (*vmnet.LinkDevice, *vz.MACAddress, int, error) {
-	mac, err := vz.NewRandomLocallyAdministeredMACAddress()
-	if err != nil {
-		return nil, nil, 0, fmt.Errorf("creating mac address: %v", err)
+// sshPort is the guest port always forwarded, the VM's address.
+const sshPort = 22
+
+// validatePortForward fails for ports that can't be forwarded. Only tcp ports
+// are supported by the network stack.
+func validatePortForward(port hypervisor.PortForward) error {
+	if port.Port == 0 {
+		return fmt.Errorf("invalid port 0")
+	}
+	if port.Protocol != "" && port.Protocol != hypervisor.ProtocolTCP {
+		return fmt.Errorf("unsupported protocol %q for port %d, only tcp ports can be forwarded", port.Protocol, port.Port)
 	}
 
+	return nil
+}
+
+// newLinkDevice creates a link device forwarding a free local port to each
+// guest port, SSH's first. The endpoints returned are the local ports, in the
+// same order, with a guest port forwarded only once.
+//
+// Each vm has its own network, whose dhcp server leases the same address to
+// a mac address, so a vm restored with its saved mac address is reached at
+// the address its guest already has.
+func newLinkDevice(network *vmnet.Network, mac *vz.MACAddress, ports []hypervisor.PortForward) (*vmnet.LinkDevice, []hypervisor.Endpoint, error) {
+	ports = append([]hypervisor.PortForward{{Port: sshPort, Purpose: hypervisor.PurposeSSH}}, ports...)
+
 	portMu.Lock()
 	defer portMu.Unlock()
 
-	// find a random free local port we can listen on
-	ln, err := net.Listen("tcp4", "127.0.0.1:0")
-	if err != nil {
-		return nil, nil, 0, fmt.Errorf("finding free local port: %w", err)
+	var opts []vmnet.LinkDeviceOpts
+	var endpoints []hypervisor.Endpoint
+	var listeners []net.Listener
+	closeListeners := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+
+	forwarded := make(map[uint16]bool)
+	for _, port := range ports {
+		if err := validatePortForward(port); err != nil {
+			closeListeners()
+			return nil, nil, err
+		}
+		if forwarded[port.Port] {
+			continue
+		}
+		forwarded[port.Port] = true
+
+		// find a random free local port we can listen on, keeping the
+		// listener open until every port is found, so that none is found
+		// twice
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			closeListeners()
+			return nil, nil, fmt.Errorf("finding free local port: %w", err)
+		}
+		listeners = append(listeners, ln)
+
+		hostPort := ln.Addr().(*net.TCPAddr).Port
+		opts = append(opts, vmnet.WithTCPIncomingForward(hostPort, int(port.Port)))
+		endpoints = append(endpoints, hypervisor.Endpoint{
+			Host:      "127.0.0.1",
+			Port:      uint16(hostPort),
+			GuestPort: port.Port,
+			Protocol:  hypervisor.ProtocolTCP,
+			Purpose:   port.Purpose,
+		})
 	}
 
-	// once we have the port, we can immediately close the listener and pass the
-	// port along to the new link device, which will then create a new listener on it.
+	// once we have the ports, we can immediately close the listeners and pass the
+	// ports along to the new link device, which will then create new listeners on them.
 	//
-	// this does mean there's a very slim chance that another process could "steal" this port
+	// this does mean there's a very slim chance that another process could "steal" a port
 	// before we begin listening on it again, but it won't be this process, because we use
 	// the portMu lock above.
 	//
 	// in the event that a port is already being listened on, this will return an error and
 	// the network won't be created.
-	port := ln.Addr().(*net.TCPAddr).Port
-	ln.Close()
+	closeListeners()
 
-	opts := []vmnet.LinkDeviceOpts{vmnet.WithTCPIncomingForward(port, 22)}
 	sendspace, err := unix.SysctlUint32("net.inet.tcp.sendspace")
 	if err == nil {
 		opts = append(opts, vmnet.WithSendBufferSize(int(sendspace)))
@@ -50,10 +105,12 @@ func newLinkDevice(network *vmnet.Network) (*vmnet.LinkDevice, *vz.MACAddress, i
 
 	dev, err := network.NewLinkDevice(mac.HardwareAddr(), opts...)
 
-	return dev, mac, port, err
+	return dev, endpoints, err
 }
 
-func createNetworkDeviceConfiguration(cfg *VirtualMachineConfig) (*vz.VirtioNetworkDeviceConfiguration, func(), string, error) {
+// createNetworkDeviceConfiguration creates the VM's network, returning the
+// endpoints of the guest ports forwarded, SSH's first.
+func createNetworkDeviceConfiguration(cfg *VirtualMachineConfig, mac *vz.MACAddress) (*vz.VirtioNetworkDeviceConfiguration, func(), []hypervisor.Endpoint, error) {
 	mtu := cfg.MTU
 	if mtu == 0 {
 		mtu = getDefaultGatewayInterfaceMTU()
@@ -67,13 +124,13 @@ func createNetworkDeviceConfiguration(cfg *VirtualMachineConfig) (*vz.VirtioNetw
 
 	network, err := vmnet.New("192.168.127.0/24", opts...)
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("creating network: %w", err)
+		return nil, nil, nil, fmt.Errorf("creating network: %w", err)
 	}
 
-	dev, mac, port, err := newLinkDevice(network)
+	dev, endpoints, err := newLinkDevice(network, mac, cfg.Ports)
 	if err != nil {
 		network.Shutdown()
-		return nil, nil, "", fmt.Errorf("creating link device: %w", err)
+		return nil, nil, nil, fmt.Errorf("creating link device: %w", err)
 	}
 
 	cleanup := func() {
@@ -84,19 +141,19 @@ func createNetworkDeviceConfiguration(cfg *VirtualMachineConfig) (*vz.VirtioNetw
 	attachment, err := vz.NewFileHandleNetworkDeviceAttachment(dev.File())
 	if err != nil {
 		cleanup()
-		return nil, nil, "", fmt.Errorf("creating file handle network device attachment: %w", err)
+		return nil, nil, nil, fmt.Errorf("creating file handle network device attachment: %w", err)
 	}
 	_ = attachment.SetMaximumTransmissionUnit(mtu) // this will return an error on unsupported images
 
 	config, err := vz.NewVirtioNetworkDeviceConfiguration(attachment)
 	if err != nil {
 		cleanup()
-		return nil, nil, "", fmt.Errorf("creating virtio netwqork device config: %w", err)
+		return nil, nil, nil, fmt.Errorf("creating virtio netwqork device config: %w", err)
 	}
 
 	config.SetMACAddress(mac)
 
-	return config, cleanup, fmt.Sprintf("127.0.0.1:%d", port), nil
+	return config, cleanup, endpoints, nil
 }
 
 func getDefaultGatewayInterfaceMTU() int {
@@ -0,0 +1,223 @@
+//go:build darwin && arm64
+
+package virtualizationframework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Code-Hex/vz/v3"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor/internal/hvutil"
+)
+
+// snapshotDirectory is where snapshots are saved, within the image directory,
+// hidden from the images listed.
+const snapshotDirectory = ".snapshots"
+
+// Files of a snapshot: the vm's saved memory and device state, and what the
+// vm was created with. The machine config is written last, so a snapshot
+// being saved isn't found until it's complete.
+const (
+	stateFile   = "state.vzvmsave"
+	machineFile = "machine.json"
+)
+
+// machineConfig is what a vm is created with. It's saved with the vm's
+// snapshots, as the Virtualization framework only restores a vm's state to a
+// vm with the same configuration.
+type machineConfig struct {
+	Image             string                `json:"image"`
+	Config            *VirtualMachineConfig `json:"config"`
+	MAC               string                `json:"mac"`
+	MachineIdentifier []byte                `json:"machine_identifier,omitempty"`
+}
+
+// supportsSnapshots reports whether the version of macOS can save and restore
+// a vm's state, which requires macOS 14.
+func supportsSnapshots(version string) bool {
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+
+	return err == nil && n >= 14
+}
+
+func parseMACAddress(s string) (*vz.MACAddress, error) {
+	hwAddr, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mac address: %w", err)
+	}
+
+	mac, err := vz.NewMACAddress(hwAddr)
+	if err != nil {
+		return nil, fmt.Errorf("creating mac address: %w", err)
+	}
+
+	return mac, nil
+}
+
+// Snapshot pauses the vm and saves its state, along with its disk, nvram and
+// what it was created with, as the snapshot. The vm is then deleted.
+func (hv *VirtualizationFramework) Snapshot(ctx context.Context, id, snapshot string) error {
+	hv.mu.Lock()
+	vm, ok := hv.vms[id]
+	hv.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no vm (%v) found", id)
+	}
+
+	dir := filepath.Join(hv.cfg.ImageDirectory, snapshotDirectory, snapshot)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o777); err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	if err := os.Mkdir(dir, 0o777); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotExists, snapshot)
+		}
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	if err := hv.saveSnapshot(ctx, vm, dir); err != nil {
+		os.RemoveAll(dir)
+
+		// the vm keeps running if its state couldn't be saved
+		if vm.vm.CanResume() {
+			vm.vm.Resume()
+		}
+
+		return err
+	}
+
+	if _, err := hv.delete(ctx, id, 0); err != nil {
+		return fmt.Errorf("deleting vm: %w", err)
+	}
+
+	hvutil.Logger("vz").Info("vm snapshot saved", "id", id, "name", vm.name, "snapshot", snapshot)
+
+	return nil
+}
+
+// DeleteSnapshot removes the snapshot's files. VMs restored from it have their
+// own copies of its files, so are unaffected.
+func (hv *VirtualizationFramework) DeleteSnapshot(ctx context.Context, snapshot string) error {
+	dir := filepath.Join(hv.cfg.ImageDirectory, snapshotDirectory, snapshot)
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", hypervisor.ErrSnapshotNotFound, snapshot)
+		}
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("deleting snapshot: %w", err)
+	}
+
+	hvutil.Logger("vz").Info("vm snapshot deleted", "snapshot", snapshot)
+
+	return nil
+}
+
+func (hv *VirtualizationFramework) saveSnapshot(ctx context.Context, vm virtualMachine, dir string) error {
+	if err := vm.vm.Pause(); err != nil {
+		return fmt.Errorf("pausing vm: %w", err)
+	}
+
+	if err := vm.vm.SaveMachineStateToPath(filepath.Join(dir, stateFile)); err != nil {
+		return fmt.Errorf("saving vm state: %w", err)
+	}
+
+	// the files are copied while the vm is paused, consistent with its state
+	if err := copyFromDisk(ctx, filepath.Join(hv.cfg.WorkingDirectory, vm.id), dir); err != nil {
+		return fmt.Errorf("copying vm files: %w", err)
+	}
+
+	data, err := json.Marshal(vm.machine)
+	if err != nil {
+		return fmt.Errorf("marshaling machine config: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, machineFile), data, 0o666); err != nil {
+		return fmt.Errorf("writing machine config: %w", err)
+	}
+
+	return nil
+}
+
+// restore creates a vm from the snapshot, which must have been taken of a vm
+// of the image. Its files are cloned from the snapshot's, and its state
+// restored, so that its guest resumes where it was when it was saved.
+func (hv *VirtualizationFramework) restore(ctx context.Context, id, name string, opts hypervisor.CreateOptions) (vm hypervisor.VirtualMachine, err error) {
+	if opts.CPUs > 0 || opts.MemoryBytes > 0 || opts.DiskSizeBytes > 0 {
+		return nil, fmt.Errorf("%w: a vm restored from a snapshot can't override its resources", hypervisor.ErrInvalidOption)
+	}
+
+	dir := filepath.Join(hv.cfg.ImageDirectory, snapshotDirectory, opts.Snapshot)
+	machine, err := readMachineConfig(dir)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && machine.Image != name) {
+		return nil, fmt.Errorf("%w: %s of image %s", hypervisor.ErrSnapshotNotFound, opts.Snapshot, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	workingDir := filepath.Join(hv.cfg.WorkingDirectory, id)
+	defer func() {
+		if err != nil {
+			os.RemoveAll(workingDir)
+		}
+	}()
+
+	if err := os.MkdirAll(workingDir, 0o777); err != nil {
+		return nil, fmt.Errorf("creating vm directory: %w", err)
+	}
+	if err := copyFromDisk(ctx, dir, workingDir); err != nil {
+		return nil, fmt.Errorf("cloning vm: %w", err)
+	}
+
+	// the vm keeps its mac address, so its guest keeps its address, but ports
+	// are forwarded on the host, so more can be
+	machine.Config.Ports = append(machine.Config.Ports, opts.Ports...)
+
+	return hv.start(id, machine, filepath.Join(dir, stateFile))
+}
+
+func readMachineConfig(dir string) (machineConfig, error) {
+	var machine machineConfig
+
+	data, err := os.ReadFile(filepath.Join(dir, machineFile))
+	if err != nil {
+		return machine, fmt.Errorf("reading machine config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &machine); err != nil {
+		return machine, fmt.Errorf("unmarshaling machine config: %w", err)
+	}
+	if machine.Config == nil {
+		return machine, fmt.Errorf("machine config of snapshot %s has no vm config", filepath.Base(dir))
+	}
+
+	return machine, nil
+}
+
+// restoreState restores the vm's saved state, which leaves it paused, and
+// resumes it.
+func restoreState(vm *vz.VirtualMachine, state string) error {
+	if err := vm.RestoreMachineStateFromURL(state); err != nil {
+		return fmt.Errorf("restoring vm state: %w", err)
+	}
+
+	if err := vm.Resume(); err != nil {
+		return fmt.Errorf("resuming vm: %w", err)
+	}
+
+	return nil
+}
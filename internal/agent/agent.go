@@ -0,0 +1,262 @@
+// Package agent implements the protocol spoken between the host and the guest
+// agent, which runs commands inside Virtualization framework guests on behalf
+// of the host over virtio-vsock.
+//
+// Each connection runs a single command. The host sends a request frame
+// followed by stdin frames, with an empty stdin frame marking EOF. The guest
+// sends stdout and stderr frames, followed by either an exit frame with the
+// command's exit code, or an error frame if the command couldn't be run.
+//
+// A frame is a one byte type, a four byte big-endian payload length and the
+// payload.
+package agent
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// Port is the vsock port the guest agent listens on.
+const Port uint32 = 52000
+
+const (
+	// maxFrameSize bounds the payload of a frame read, so that a corrupt
+	// length can't exhaust memory.
+	maxFrameSize = 1 << 20
+
+	// chunkSize is the most stdin or output sent per frame.
+	chunkSize = 32 * 1024
+)
+
+type frameType byte
+
+const (
+	frameRequest frameType = iota + 1
+	frameStdin
+	frameStdout
+	frameStderr
+	frameExit
+	frameError
+)
+
+type request struct {
+	Args []string `json:"args"`
+}
+
+func writeFrame(w io.Writer, typ frameType, payload []byte) error {
+	header := make([]byte, 5, 5+len(payload))
+	header[0] = byte(typ)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readFrame(r io.Reader) (frameType, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds maximum of %d", size, maxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("reading frame: %w", err)
+	}
+
+	return frameType(header[0]), payload, nil
+}
+
+// frameWriter writes what's written to it as frames of a type. Writes are
+// serialized with other frameWriters sharing the mutex.
+type frameWriter struct {
+	mu  *sync.Mutex
+	w   io.Writer
+	typ frameType
+}
+
+func (fw frameWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for n := 0; n < len(p); n += chunkSize {
+		if err := writeFrame(fw.w, fw.typ, p[n:min(n+chunkSize, len(p))]); err != nil {
+			return n, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Exec runs a command on the guest agent at the other end of conn, and returns
+// its exit code. The connection is closed once the command has exited or the
+// context is cancelled.
+func Exec(ctx context.Context, conn io.ReadWriteCloser, cmd hypervisor.ExecCommand) (int, error) {
+	defer conn.Close()
+
+	if len(cmd.Args) == 0 {
+		return 0, fmt.Errorf("no command given")
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req, err := json.Marshal(request{Args: cmd.Args})
+	if err != nil {
+		return 0, fmt.Errorf("marshaling request: %w", err)
+	}
+	if err := writeFrame(conn, frameRequest, req); err != nil {
+		return 0, fmt.Errorf("sending request: %w", err)
+	}
+
+	go func() {
+		if cmd.Stdin != nil {
+			var mu sync.Mutex
+			if _, err := io.Copy(frameWriter{mu: &mu, w: conn, typ: frameStdin}, cmd.Stdin); err != nil {
+				return
+			}
+		}
+
+		// an empty stdin frame closes stdin
+		writeFrame(conn, frameStdin, nil)
+	}()
+
+	for {
+		typ, payload, err := readFrame(conn)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("guest agent closed the connection without an exit code")
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch typ {
+		case frameStdout:
+			if cmd.Stdout != nil {
+				if _, err := cmd.Stdout.Write(payload); err != nil {
+					return 0, fmt.Errorf("writing stdout: %w", err)
+				}
+			}
+
+		case frameStderr:
+			if cmd.Stderr != nil {
+				if _, err := cmd.Stderr.Write(payload); err != nil {
+					return 0, fmt.Errorf("writing stderr: %w", err)
+				}
+			}
+
+		case frameExit:
+			if len(payload) != 4 {
+				return 0, fmt.Errorf("invalid exit frame")
+			}
+			return int(int32(binary.BigEndian.Uint32(payload))), nil
+
+		case frameError:
+			return 0, fmt.Errorf("guest agent: %s", payload)
+
+		default:
+			return 0, fmt.Errorf("unexpected frame type %d", typ)
+		}
+	}
+}
+
+// Handle runs the command requested on conn, which is closed once the command
+// has exited.
+func Handle(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+
+	typ, payload, err := readFrame(conn)
+	if err != nil {
+		return fmt.Errorf("reading request: %w", err)
+	}
+	if typ != frameRequest {
+		return fmt.Errorf("expected request, got frame type %d", typ)
+	}
+
+	var req request
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("unmarshaling request: %w", err)
+	}
+	if len(req.Args) == 0 {
+		return writeFrame(conn, frameError, []byte("no command given"))
+	}
+
+	var mu sync.Mutex
+
+	cmd := exec.Command(req.Args[0], req.Args[1:]...)
+	cmd.Stdout = frameWriter{mu: &mu, w: conn, typ: frameStdout}
+	cmd.Stderr = frameWriter{mu: &mu, w: conn, typ: frameStderr}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("creating stdin pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return writeFrame(conn, frameError, []byte(err.Error()))
+	}
+
+	// stdin is copied until it's closed by the host. The connection is then
+	// read until it's closed, either by the host going away, in which case
+	// the command is killed, or by the command exiting.
+	go func() {
+		defer stdin.Close()
+
+		open := true
+		for {
+			typ, payload, err := readFrame(conn)
+			if err != nil {
+				cmd.Process.Kill()
+				return
+			}
+
+			if typ != frameStdin || !open {
+				continue
+			}
+			if len(payload) == 0 {
+				stdin.Close()
+				open = false
+				continue
+			}
+			if _, err := stdin.Write(payload); err != nil {
+				open = false
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+
+	var errExit *exec.ExitError
+	if err != nil && !errors.As(err, &errExit) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return writeFrame(conn, frameError, []byte(err.Error()))
+	}
+
+	exitCode := make([]byte, 4)
+	binary.BigEndian.PutUint32(exitCode, uint32(int32(cmd.ProcessState.ExitCode())))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	return writeFrame(conn, frameExit, exitCode)
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/fleeting/nesting/hypervisor"
+)
+
+// exec runs the command through a connected host and guest.
+func run(t *testing.T, ctx context.Context, cmd hypervisor.ExecCommand) (int, error) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	host, guest := net.Pipe()
+
+	handled := make(chan error, 1)
+	go func() {
+		handled <- Handle(guest)
+	}()
+
+	exitCode, err := Exec(ctx, host, cmd)
+	<-handled
+
+	return exitCode, err
+}
+
+func TestExec(t *testing.T) {
+	var stdout, stderr strings.Builder
+	exitCode, err := run(t, context.Background(), hypervisor.ExecCommand{
+		Args:   []string{"sh", "-c", "cat; echo oops >&2; exit 3"},
+		Stdin:  strings.NewReader("hello"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "hello", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestExecLargeOutput(t *testing.T) {
+	input := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+
+	var stdout bytes.Buffer
+	exitCode, err := run(t, context.Background(), hypervisor.ExecCommand{
+		Args:   []string{"cat"},
+		Stdin:  bytes.NewReader(input),
+		Stdout: &stdout,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, input, stdout.Bytes())
+}
+
+func TestExecUnclosedStdin(t *testing.T) {
+	stdin, _ := io.Pipe()
+	defer stdin.Close()
+
+	exitCode, err := run(t, context.Background(), hypervisor.ExecCommand{
+		Args:  []string{"sh", "-c", "exit 1"},
+		Stdin: stdin,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestExecNotFound(t *testing.T) {
+	_, err := run(t, context.Background(), hypervisor.ExecCommand{
+		Args: []string{"nesting-no-such-command"},
+	})
+	assert.ErrorContains(t, err, "guest agent:")
+}
+
+func TestExecCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := run(t, ctx, hypervisor.ExecCommand{
+		Args: []string{"sleep", "1"},
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,127 @@
+// Package metrics holds the Prometheus metrics shared by the API server and
+// the hypervisor drivers.
+package metrics
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nesting"
+
+// Registry is the registry every nesting metric is registered with.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// durationBuckets cover everything from a quick RPC to a multi-minute clone
+// and boot.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+var (
+	RPCRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Total number of RPCs handled, by method and status code.",
+	}, []string{"method", "code"})
+
+	RPCDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Duration of RPCs, by method and status code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "code"})
+
+	VMCreateDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vm_create_duration_seconds",
+		Help:      "Duration of VM creates, by hypervisor, image and result.",
+		Buckets:   durationBuckets,
+	}, []string{"hypervisor", "image", "result"})
+
+	VMDeleteDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vm_delete_duration_seconds",
+		Help:      "Duration of VM deletes, by hypervisor, image and result.",
+		Buckets:   durationBuckets,
+	}, []string{"hypervisor", "image", "result"})
+
+	VMsRunning = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vms_running",
+		Help:      "Number of VMs currently running.",
+	})
+
+	SlotStomps = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slot_stomps_total",
+		Help:      "Total number of VMs deleted because their slot was reused.",
+	})
+
+	PoolReady = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_ready_vms",
+		Help:      "Number of pre-booted VMs ready to be handed out, by image.",
+	}, []string{"image"})
+
+	CloneDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vm_clone_duration_seconds",
+		Help:      "Duration of cloning or extracting an image for a VM, by image source and result.",
+		Buckets:   durationBuckets,
+	}, []string{"source", "result"})
+
+	DriverCommands = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "driver_commands_total",
+		Help:      "Total number of commands run by hypervisor drivers, by command and subcommand.",
+	}, []string{"command", "subcommand"})
+
+	DriverCommandFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "driver_command_failures_total",
+		Help:      "Total number of commands run by hypervisor drivers that failed, by command and subcommand.",
+	}, []string{"command", "subcommand"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result returns the result label for an operation's error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// ObserveCommand records a driver command invocation. Only the base name of
+// the command is used, so that binaries configured by path share a label.
+func ObserveCommand(command, subcommand string, err error) {
+	command = filepath.Base(command)
+
+	DriverCommands.WithLabelValues(command, subcommand).Inc()
+	if err != nil {
+		DriverCommandFailures.WithLabelValues(command, subcommand).Inc()
+	}
+}
+
+// Since returns the seconds elapsed since start, for observing durations.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}